@@ -0,0 +1,35 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/vlxdisluv/shortener/config"
+	"github.com/vlxdisluv/shortener/internal/app/storage/file"
+)
+
+// runCompact shrinks the file store, which keeps every version of a link.
+// It fails while the server or another command holds the store.
+func runCompact(cfg *config.Config, args []string) error {
+	if len(args) != 0 {
+		return errors.New("usage: shortener [flags] compact")
+	}
+	if cfg.DatabaseDSN != "" {
+		return errors.New("compact only applies to the file storage")
+	}
+
+	lock, err := file.Lock(cfg.FileStoragePath)
+	if err != nil {
+		return err
+	}
+	defer lock.Close()
+
+	stats, err := file.Compact(cfg.FileStoragePath)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%s: %d lines (%d bytes) -> %d links (%d bytes)\n",
+		cfg.FileStoragePath, stats.LinesBefore, stats.BytesBefore, stats.Links, stats.BytesAfter)
+	return nil
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/vlxdisluv/shortener/config"
+)
+
+// runConfig prints the configuration after flags and environment are
+// applied, as environment assignments. Secrets are redacted.
+func runConfig(cfg *config.Config, args []string) error {
+	if len(args) != 0 {
+		return errors.New("usage: shortener [flags] config")
+	}
+	for _, v := range cfg.Values() {
+		fmt.Printf("%s=%s\n", v.Setting, v.Value)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+
+	"github.com/vlxdisluv/shortener/config"
+	"github.com/vlxdisluv/shortener/internal/app/exporter"
+	storagefactory "github.com/vlxdisluv/shortener/internal/app/storage/factory"
+)
+
+const exportUsage = "usage: shortener [flags] export [-format csv|ndjson|file] [-o file]"
+
+// runExport dumps all links of the configured storage. It is a backup, not a
+// way to switch backends: the counter and click history are not part of it,
+// see migrate-storage.
+func runExport(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), exportUsage)
+		fs.PrintDefaults()
+	}
+	format := fs.String("format", exporter.NDJSON, "csv, ndjson or file")
+	outPath := fs.String("o", "", "output file, stdout if empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New(exportUsage)
+	}
+	if err := exporter.CheckFormat(*format); err != nil {
+		return err
+	}
+	if *outPath != "" && cfg.DatabaseDSN == "" && samePath(*outPath, cfg.FileStoragePath) {
+		return fmt.Errorf("%s is the storage being exported", *outPath)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	storage, err := storagefactory.New(ctx, cfg, storagefactory.ReadOnly())
+	if err != nil {
+		return fmt.Errorf("init storage: %w", err)
+	}
+	defer storage.Close(context.Background())
+
+	var out io.Writer = os.Stdout
+	var f *os.File
+	if *outPath != "" {
+		if f, err = os.Create(*outPath); err != nil {
+			return err
+		}
+		out = f
+	}
+
+	n, err := exporter.Export(ctx, storage.ShortURLs(), out, *format)
+	// A short write may only show up on sync or close.
+	if f != nil {
+		if err == nil {
+			err = f.Sync()
+		}
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "exported %d links\n", n)
+	return nil
+}
+
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
+}
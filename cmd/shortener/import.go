@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+
+	"github.com/vlxdisluv/shortener/config"
+	"github.com/vlxdisluv/shortener/internal/app/importer"
+	storagefactory "github.com/vlxdisluv/shortener/internal/app/storage/factory"
+)
+
+const importUsage = "usage: shortener [flags] import [-format csv|ndjson] [-user id] [-report file] [-chunk-size n] <file|->"
+
+// runImport loads links from a CSV or NDJSON file straight into the
+// configured storage, applying the same checks as POST /api/import.
+func runImport(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), importUsage)
+		fs.PrintDefaults()
+	}
+	format := fs.String("format", "", "csv or ndjson, taken from the file extension if empty")
+	userID := fs.String("user", "", "user ID that owns the imported links")
+	reportPath := fs.String("report", "", "file for the per-row report, stdout if empty")
+	chunkSize := fs.Int("chunk-size", cfg.ImportChunkSize, "rows saved per transaction")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New(importUsage)
+	}
+
+	path := fs.Arg(0)
+	if *format == "" {
+		*format = strings.TrimPrefix(strings.ToLower(filepath.Ext(path)), ".")
+		if *format == "jsonl" {
+			*format = importer.NDJSON
+		}
+	}
+
+	var in io.Reader = os.Stdin
+	if path != "-" {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		in = f
+	}
+
+	rows, err := importer.NewReader(in, *format)
+	if err != nil {
+		return err
+	}
+
+	var out io.Writer = os.Stdout
+	if *reportPath != "" {
+		f, err := os.Create(*reportPath)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	storage, err := storagefactory.New(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("init storage: %w", err)
+	}
+	defer storage.Close(context.Background())
+
+	check, err := linkChecker(cfg, storage)
+	if err != nil {
+		return err
+	}
+
+	baseURL := strings.TrimRight(cfg.BaseURL, "/")
+	report, err := importer.NewReportWriter(out, *format, func(hash string) string { return baseURL + "/" + hash })
+	if err != nil {
+		return err
+	}
+
+	im := importer.New(storage,
+		importer.WithUserID(*userID),
+		importer.WithCheck(check),
+		importer.WithChunkSize(*chunkSize),
+	)
+	summary, err := im.Run(ctx, rows, report.Write)
+	if flushErr := report.Flush(); err == nil {
+		err = flushErr
+	}
+	fmt.Fprintf(os.Stderr, "created %d, already existing %d, failed %d\n", summary.Created, summary.Exists, summary.Failed)
+	return err
+}
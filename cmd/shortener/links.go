@@ -0,0 +1,182 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/vlxdisluv/shortener/config"
+	"github.com/vlxdisluv/shortener/internal/app/handlers"
+	"github.com/vlxdisluv/shortener/internal/app/importer"
+	"github.com/vlxdisluv/shortener/internal/app/policy"
+	"github.com/vlxdisluv/shortener/internal/app/storage"
+	storagefactory "github.com/vlxdisluv/shortener/internal/app/storage/factory"
+)
+
+const (
+	createUsage = "usage: shortener [flags] create [-user id] [-alias alias] [-tags a,b] [-expires RFC3339] <url>"
+	getUsage    = "usage: shortener [flags] get <hash>"
+	deleteUsage = "usage: shortener [flags] delete <hash>"
+)
+
+// runCreate shortens one URL with the same checks as an import row.
+func runCreate(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("create", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), createUsage)
+		fs.PrintDefaults()
+	}
+	userID := fs.String("user", "", "user ID that owns the link")
+	alias := fs.String("alias", "", "custom short code instead of a generated one")
+	tags := fs.String("tags", "", "comma-separated tags")
+	expires := fs.String("expires", "", "time (RFC3339) after which the link stops redirecting")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return errors.New(createUsage)
+	}
+
+	row := importer.Row{Line: 1, OriginalURL: fs.Arg(0), Alias: *alias}
+	for _, tag := range strings.Split(*tags, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			row.Tags = append(row.Tags, tag)
+		}
+	}
+	if *expires != "" {
+		t, err := time.Parse(time.RFC3339, *expires)
+		if err != nil {
+			return fmt.Errorf("-expires must be an RFC3339 time: %w", err)
+		}
+		row.ExpiresAt = &t
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s, err := storagefactory.New(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("init storage: %w", err)
+	}
+	defer s.Close(context.Background())
+
+	check, err := linkChecker(cfg, s)
+	if err != nil {
+		return err
+	}
+
+	var res importer.Result
+	im := importer.New(s, importer.WithUserID(*userID), importer.WithCheck(check))
+	_, err = im.Run(ctx, &rowList{row}, func(r importer.Result) error {
+		res = r
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	switch res.Status {
+	case importer.StatusFailed:
+		return errors.New(res.Error)
+	case importer.StatusExists:
+		fmt.Fprintln(os.Stderr, "already shortened")
+	}
+	fmt.Println(strings.TrimRight(cfg.BaseURL, "/") + "/" + res.Hash)
+	return nil
+}
+
+func runGet(cfg *config.Config, args []string) error {
+	if len(args) != 1 {
+		return errors.New(getUsage)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s, err := storagefactory.New(ctx, cfg, storagefactory.ReadOnly())
+	if err != nil {
+		return fmt.Errorf("init storage: %w", err)
+	}
+	defer s.Close(context.Background())
+
+	link, err := s.ShortURLs().Get(ctx, args[0])
+	if errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("link %s not found", args[0])
+	}
+	if err != nil {
+		return err
+	}
+
+	// The password hash must not end up in terminals and logs; whether
+	// there is one is enough.
+	protected := link.PasswordHash != ""
+	link.PasswordHash = ""
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(struct {
+		*storage.ShortURL
+		Protected bool  `json:"protected"`
+		Clicks    int64 `json:"clicks"`
+	}{link, protected, link.Clicks})
+}
+
+// runDelete removes a link. Its clicks and revisions stay in the storage.
+func runDelete(cfg *config.Config, args []string) error {
+	if len(args) != 1 {
+		return errors.New(deleteUsage)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	s, err := storagefactory.New(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("init storage: %w", err)
+	}
+	defer s.Close(context.Background())
+
+	err = s.ShortURLs().Delete(ctx, args[0])
+	if errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("link %s not found", args[0])
+	}
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "deleted %s\n", args[0])
+	return nil
+}
+
+// linkChecker validates target URLs the way the server does, against our
+// own domains and the URL policy.
+func linkChecker(cfg *config.Config, s handlers.Storage) (importer.CheckFunc, error) {
+	opts := []handlers.Option{handlers.WithOwnDomains(cfg.BaseURL, cfg.AliasDomains)}
+	if cfg.URLPolicyFile != "" {
+		pe, err := policy.Load(cfg.URLPolicyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load url policy: %w", err)
+		}
+		opts = append(opts, handlers.WithURLPolicy(pe))
+	}
+	return handlers.NewShortURLHandler(s, opts...).CheckImportedLink, nil
+}
+
+// rowList feeds fixed rows to the importer.
+type rowList []importer.Row
+
+func (l *rowList) Next() (importer.Row, error) {
+	if len(*l) == 0 {
+		return importer.Row{}, io.EOF
+	}
+	row := (*l)[0]
+	*l = (*l)[1:]
+	return row, nil
+}
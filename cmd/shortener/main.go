@@ -1,7 +1,11 @@
 package main
 
 import (
+	"errors"
+	"flag"
+	"fmt"
 	"log"
+	"os"
 
 	_ "github.com/joho/godotenv/autoload"
 	"github.com/vlxdisluv/shortener/config"
@@ -9,7 +13,28 @@ import (
 	"github.com/vlxdisluv/shortener/internal/app/server"
 )
 
+type command struct {
+	name    string
+	summary string
+	run     func(*config.Config, []string) error
+}
+
+// commands is in the order they are listed by -h.
+var commands = []command{
+	{"serve", "run the HTTP server (default)", runServe},
+	{"migrate", "apply, roll back or inspect database migrations", runMigrate},
+	{"create", "shorten a URL", runCreate},
+	{"get", "print a link", runGet},
+	{"delete", "delete a link", runDelete},
+	{"import", "load links from a CSV or NDJSON file", runImport},
+	{"export", "dump all links", runExport},
+	{"migrate-storage", "copy all links to another storage backend", runMigrateStorage},
+	{"compact", "rewrite the file store without stale entries", runCompact},
+	{"config", "print the effective configuration", runConfig},
+}
+
 func main() {
+	flag.Usage = usage
 	cfg := config.Load()
 
 	if err := logger.Initialize(cfg); err != nil {
@@ -17,5 +42,43 @@ func main() {
 	}
 	defer logger.Log.Sync()
 
-	server.Start(cfg)
+	name, args := "serve", []string(nil)
+	if flag.NArg() > 0 {
+		name, args = flag.Arg(0), flag.Args()[1:]
+	}
+	for _, c := range commands {
+		if c.name != name {
+			continue
+		}
+		if err := c.run(cfg, args); err != nil {
+			if !errors.Is(err, flag.ErrHelp) {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", name, err)
+			}
+			logger.Log.Sync()
+			os.Exit(1)
+		}
+		return
+	}
+
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", name)
+	usage()
+	os.Exit(2)
+}
+
+func usage() {
+	out := flag.CommandLine.Output()
+	fmt.Fprintln(out, "usage: shortener [flags] [command] [command flags]")
+	fmt.Fprintln(out, "\ncommands:")
+	for _, c := range commands {
+		fmt.Fprintf(out, "  %-16s %s\n", c.name, c.summary)
+	}
+	fmt.Fprintln(out, "\nflags:")
+	flag.PrintDefaults()
+}
+
+func runServe(cfg *config.Config, args []string) error {
+	if len(args) != 0 {
+		return errors.New("usage: shortener [flags] serve")
+	}
+	return server.Start(cfg)
 }
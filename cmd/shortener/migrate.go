@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"syscall"
+
+	"github.com/vlxdisluv/shortener/config"
+	"github.com/vlxdisluv/shortener/internal/app/storage/postgres"
+)
+
+const migrateUsage = "usage: shortener [flags] migrate up | down [n] | status | force <version>"
+
+// runMigrate manages the Postgres schema with the migrations embedded in the
+// binary. Together with -auto-migrate=false it lets rollouts apply
+// migrations as a separate step.
+func runMigrate(cfg *config.Config, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+	if cfg.DatabaseDSN == "" {
+		return errors.New("migrations need a database, set DATABASE_DSN or -d")
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	switch args[0] {
+	case "up":
+		if len(args) != 1 {
+			return errors.New(migrateUsage)
+		}
+		if err := postgres.RunMigrations(ctx, cfg.DatabaseDSN); err != nil {
+			return err
+		}
+	case "down":
+		steps := 1
+		switch len(args) {
+		case 1:
+		case 2:
+			n, err := strconv.Atoi(args[1])
+			if err != nil || n < 1 {
+				return fmt.Errorf("down: %q is not a positive number of steps", args[1])
+			}
+			steps = n
+		default:
+			return errors.New(migrateUsage)
+		}
+		if err := postgres.MigrateDown(ctx, cfg.DatabaseDSN, steps); err != nil {
+			return err
+		}
+	case "force":
+		if len(args) != 2 {
+			return errors.New(migrateUsage)
+		}
+		version, err := strconv.Atoi(args[1])
+		if err != nil || version < -1 {
+			return fmt.Errorf("force: %q is not a migration version", args[1])
+		}
+		if err := postgres.ForceMigration(ctx, cfg.DatabaseDSN, version); err != nil {
+			return err
+		}
+	case "status":
+		if len(args) != 1 {
+			return errors.New(migrateUsage)
+		}
+	default:
+		return errors.New(migrateUsage)
+	}
+
+	state, err := postgres.MigrationStatus(ctx, cfg.DatabaseDSN)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("version %d of %d", state.Version, state.Latest)
+	if state.Dirty {
+		fmt.Print(", dirty: fix the schema and run migrate force <version>")
+	} else if state.Version < state.Latest {
+		fmt.Printf(", %d pending", state.Latest-state.Version)
+	}
+	fmt.Println()
+	return nil
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+
+	"github.com/vlxdisluv/shortener/config"
+	storagefactory "github.com/vlxdisluv/shortener/internal/app/storage/factory"
+	"github.com/vlxdisluv/shortener/internal/app/storage/transfer"
+)
+
+const migrateStorageUsage = "usage: shortener migrate-storage -from file:/path|postgres://... -to file:/path|postgres://... [-verify=false]"
+
+// runMigrateStorage copies all links, campaigns, clicks, revisions and the
+// counter state from one storage backend to another. Running it again after an interruption
+// continues where it stopped.
+func runMigrateStorage(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("migrate-storage", flag.ContinueOnError)
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), migrateStorageUsage)
+		fs.PrintDefaults()
+	}
+	from := fs.String("from", "", "source storage: file:<path> or a postgres DSN")
+	to := fs.String("to", "", "destination storage: file:<path> or a postgres DSN")
+	verify := fs.Bool("verify", true, "compare link counts and checksums after copying")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *from == "" || *to == "" || fs.NArg() != 0 {
+		return errors.New(migrateStorageUsage)
+	}
+	if *from == *to {
+		return errors.New("source and destination are the same")
+	}
+
+	srcCfg, err := storageConfig(cfg, *from)
+	if err != nil {
+		return fmt.Errorf("-from: %w", err)
+	}
+	if srcCfg.DatabaseDSN == "" {
+		// The file backend would silently create an empty source.
+		if _, err := os.Stat(srcCfg.FileStoragePath); err != nil {
+			return fmt.Errorf("-from: %w", err)
+		}
+	}
+	dstCfg, err := storageConfig(cfg, *to)
+	if err != nil {
+		return fmt.Errorf("-to: %w", err)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	src, err := storagefactory.New(ctx, srcCfg)
+	if err != nil {
+		return fmt.Errorf("open source: %w", err)
+	}
+	defer src.Close(context.Background())
+
+	dst, err := storagefactory.New(ctx, dstCfg)
+	if err != nil {
+		return fmt.Errorf("open destination: %w", err)
+	}
+	defer dst.Close(context.Background())
+
+	report, err := transfer.Copy(ctx, src, dst, func(r transfer.Report) {
+		fmt.Fprintf(os.Stderr, "copied %d, already there %d, %d clicks, %d revisions\n", r.Copied, r.Skipped, r.Clicks, r.Revisions)
+	})
+	if err != nil {
+		return fmt.Errorf("copy stopped, run the command again to resume: %w", err)
+	}
+	fmt.Fprintf(os.Stderr, "done: %d campaigns, %d links copied, %d already there, %d clicks, %d revisions, counter at %d\n",
+		report.Campaigns, report.Copied, report.Skipped, report.Clicks, report.Revisions, report.Counter)
+
+	if !*verify {
+		return nil
+	}
+	srcSum, dstSum, err := transfer.Verify(ctx, src, dst)
+	if err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "source:      %d links, %d revisions, checksum %s\n", srcSum.Links, srcSum.Revisions, srcSum.Checksum)
+	fmt.Fprintf(os.Stderr, "destination: %d links, %d revisions, checksum %s\n", dstSum.Links, dstSum.Revisions, dstSum.Checksum)
+	if srcSum != dstSum {
+		return errors.New("verification failed: the destination differs from the source")
+	}
+	return nil
+}
+
+// storageConfig points a copy of cfg at the storage named by target.
+func storageConfig(cfg *config.Config, target string) (*config.Config, error) {
+	c := *cfg
+	switch {
+	case strings.HasPrefix(target, "file:"):
+		c.FileStoragePath = strings.TrimPrefix(target, "file:")
+		c.DatabaseDSN = ""
+		if c.FileStoragePath == "" {
+			return nil, errors.New("file: needs a path")
+		}
+	case strings.HasPrefix(target, "postgres://"), strings.HasPrefix(target, "postgresql://"):
+		c.DatabaseDSN = target
+	default:
+		return nil, fmt.Errorf("%q is neither file:<path> nor a postgres DSN", target)
+	}
+	return &c, nil
+}
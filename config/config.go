@@ -1,74 +1,506 @@
 package config
 
 import (
+	"errors"
 	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgconn"
+	"go.uber.org/zap/zapcore"
 )
 
 type Config struct {
-	Environment     string // "production" or "development"
+	Environment     string // "production" logs JSON; any other name, e.g. "staging", logs for development
 	Addr            string
 	BaseURL         string
 	LogLevel        string
 	FileStoragePath string
 	DatabaseDSN     string
+	URLPolicyFile   string
+	AliasDomains    []string // extra hosts that serve our short links besides BaseURL
+	RedirectType    int      // default redirect status for links without their own
+	AuthSecret      string   // key for signing user cookies
+	GeoIPDatabase   string   // path to a GeoIP2/GeoLite2 country .mmdb file
+	TrustedProxies  []string // CIDRs whose X-Forwarded-For / X-Real-IP are trusted
+	TrustedSubnet   string   // CIDR allowed to read internal statistics, nobody if empty
+	ComingSoonURL   string   // where links that are not active yet redirect, 404 if empty
+	AdminToken      string   // bearer token for the admin API, disabled if empty
+	AutoMigrate     bool     // apply pending database migrations when storage is opened
+
+	PolicyReloadInterval  time.Duration // how often the URL policy file is checked for changes
+	ImportChunkSize       int           // rows saved per transaction by imports
+	PasswordMaxAttempts   int           // wrong link passwords allowed per window
+	PasswordAttemptWindow time.Duration
+	QRCacheSize           int // rendered QR images kept in memory
+
+	// TLSCertFile and TLSKeyFile switch the server to HTTPS. The files are
+	// read again when they change.
+	TLSCertFile      string
+	TLSKeyFile       string
+	HTTPRedirectAddr string        // plain HTTP listener that redirects to HTTPS, none if empty
+	HSTSMaxAge       time.Duration // Strict-Transport-Security max-age on HTTPS responses, none if zero
+
+	// AdminAddr is a separate listener for health, metrics, profiling and the
+	// admin API, host:port or unix:/path/to.sock. They stay on Addr if empty.
+	AdminAddr string
+
+	ConfigFile string // the file the settings were read from, empty if none
 }
 
-var (
-	environment     string
-	addr            string
-	baseURL         string
-	logLevel        string
-	fileStoragePath string
-	databaseDSN     string
-)
+// Default returns the settings used when nothing else is configured. BaseURL
+// is left empty; it follows Addr unless set.
+func Default() *Config {
+	return &Config{
+		Environment:           "development",
+		Addr:                  "localhost:8080",
+		LogLevel:              "info",
+		FileStoragePath:       "/tmp/short-url-db.json",
+		RedirectType:          307,
+		AutoMigrate:           true,
+		PolicyReloadInterval:  5 * time.Second,
+		ImportChunkSize:       500,
+		PasswordMaxAttempts:   5,
+		PasswordAttemptWindow: 15 * time.Minute,
+		QRCacheSize:           1000,
+	}
+}
 
-func init() {
-	flag.StringVar(&addr, "a", "localhost:8080", "HTTP server address")
-	flag.StringVar(&baseURL, "b", "", "Base URL for shortened links")
-	flag.StringVar(&logLevel, "l", "info", "Log Level")
-	flag.StringVar(&environment, "e", "development", "Environment")
-	flag.StringVar(&fileStoragePath, "f", "/tmp/short-url-db.json", "Path to JSON file that stores short and original URLs")
-	flag.StringVar(&databaseDSN, "d", "", "Database DSN")
+// setting is a value that can be given as a flag and as an environment
+// variable. Both are applied through set.
+type setting struct {
+	flag, env, usage string
+	isBool           bool
+	secret           bool
+	set              func(c *Config, v string) error
+	get              func(c *Config) string
 }
 
+var settings = []setting{
+	{flag: "a", env: "SERVER_ADDR", usage: "HTTP server `address`",
+		set: func(c *Config, v string) error { c.Addr = v; return nil },
+		get: func(c *Config) string { return c.Addr }},
+	{flag: "b", env: "BASE_URL", usage: "Base `URL` for shortened links, http://<address> if empty",
+		set: func(c *Config, v string) error { c.BaseURL = v; return nil },
+		get: func(c *Config) string { return c.BaseURL }},
+	{flag: "l", env: "LOG_LEVEL", usage: "Log `level`",
+		set: func(c *Config, v string) error { c.LogLevel = v; return nil },
+		get: func(c *Config) string { return c.LogLevel }},
+	{flag: "e", env: "ENVIRONMENT", usage: "Runtime `environment`: development or production",
+		set: func(c *Config, v string) error { c.Environment = v; return nil },
+		get: func(c *Config) string { return c.Environment }},
+	{flag: "f", env: "FILE_STORAGE_PATH", usage: "JSON file `path` that stores short and original URLs",
+		set: func(c *Config, v string) error { c.FileStoragePath = v; return nil },
+		get: func(c *Config) string { return c.FileStoragePath }},
+	{flag: "d", env: "DATABASE_DSN", usage: "Database `DSN`", secret: true,
+		set: func(c *Config, v string) error { c.DatabaseDSN = v; return nil },
+		get: func(c *Config) string { return c.DatabaseDSN }},
+	{flag: "auto-migrate", env: "AUTO_MIGRATE", usage: "Apply pending database migrations on startup", isBool: true,
+		set: boolField(func(c *Config) *bool { return &c.AutoMigrate }),
+		get: func(c *Config) string { return strconv.FormatBool(c.AutoMigrate) }},
+	{flag: "url-policy-file", env: "URL_POLICY_FILE", usage: "File `path` with allow/deny rules for target URLs",
+		set: func(c *Config, v string) error { c.URLPolicyFile = v; return nil },
+		get: func(c *Config) string { return c.URLPolicyFile }},
+	{flag: "alias-domains", env: "ALIAS_DOMAINS", usage: "Comma-separated extra `domains` serving short links",
+		set: func(c *Config, v string) error { c.AliasDomains = splitList(v); return nil },
+		get: func(c *Config) string { return strings.Join(c.AliasDomains, ",") }},
+	{flag: "redirect-type", env: "REDIRECT_TYPE", usage: "Default redirect status `code` (301, 302, 307 or 308)",
+		set: intField(func(c *Config) *int { return &c.RedirectType }),
+		get: func(c *Config) string { return strconv.Itoa(c.RedirectType) }},
+	{flag: "auth-secret", env: "AUTH_SECRET", usage: "Secret `key` for signing user cookies", secret: true,
+		set: func(c *Config, v string) error { c.AuthSecret = v; return nil },
+		get: func(c *Config) string { return c.AuthSecret }},
+	{flag: "geoip-db", env: "GEOIP_DB", usage: "File `path` of a GeoIP2/GeoLite2 country .mmdb database",
+		set: func(c *Config, v string) error { c.GeoIPDatabase = v; return nil },
+		get: func(c *Config) string { return c.GeoIPDatabase }},
+	{flag: "trusted-proxies", env: "TRUSTED_PROXIES", usage: "Comma-separated `CIDRs` of trusted reverse proxies",
+		set: func(c *Config, v string) error { c.TrustedProxies = splitList(v); return nil },
+		get: func(c *Config) string { return strings.Join(c.TrustedProxies, ",") }},
+	{flag: "t", env: "TRUSTED_SUBNET", usage: "`CIDR` of clients allowed to read /api/internal/stats",
+		set: func(c *Config, v string) error { c.TrustedSubnet = v; return nil },
+		get: func(c *Config) string { return c.TrustedSubnet }},
+	{flag: "coming-soon-url", env: "COMING_SOON_URL", usage: "Redirect target `URL` for links that are not active yet",
+		set: func(c *Config, v string) error { c.ComingSoonURL = v; return nil },
+		get: func(c *Config) string { return c.ComingSoonURL }},
+	{flag: "admin-token", env: "ADMIN_TOKEN", usage: "Bearer `token` for the admin API", secret: true,
+		set: func(c *Config, v string) error { c.AdminToken = v; return nil },
+		get: func(c *Config) string { return c.AdminToken }},
+	{flag: "policy-reload-interval", env: "POLICY_RELOAD_INTERVAL", usage: "How often the URL policy file is checked for changes, as a `duration`",
+		set: durationField(func(c *Config) *time.Duration { return &c.PolicyReloadInterval }),
+		get: func(c *Config) string { return c.PolicyReloadInterval.String() }},
+	{flag: "import-chunk-size", env: "IMPORT_CHUNK_SIZE", usage: "Number of `rows` saved per transaction by imports",
+		set: intField(func(c *Config) *int { return &c.ImportChunkSize }),
+		get: func(c *Config) string { return strconv.Itoa(c.ImportChunkSize) }},
+	{flag: "password-max-attempts", env: "PASSWORD_MAX_ATTEMPTS", usage: "Wrong link password `attempts` allowed per window",
+		set: intField(func(c *Config) *int { return &c.PasswordMaxAttempts }),
+		get: func(c *Config) string { return strconv.Itoa(c.PasswordMaxAttempts) }},
+	{flag: "password-attempt-window", env: "PASSWORD_ATTEMPT_WINDOW", usage: "Time `window` in which wrong link passwords are counted",
+		set: durationField(func(c *Config) *time.Duration { return &c.PasswordAttemptWindow }),
+		get: func(c *Config) string { return c.PasswordAttemptWindow.String() }},
+	{flag: "tls-cert", env: "TLS_CERT_FILE", usage: "PEM certificate `file`, enables HTTPS together with -tls-key",
+		set: func(c *Config, v string) error { c.TLSCertFile = v; return nil },
+		get: func(c *Config) string { return c.TLSCertFile }},
+	{flag: "tls-key", env: "TLS_KEY_FILE", usage: "PEM private key `file` of the TLS certificate",
+		set: func(c *Config, v string) error { c.TLSKeyFile = v; return nil },
+		get: func(c *Config) string { return c.TLSKeyFile }},
+	{flag: "http-redirect-addr", env: "HTTP_REDIRECT_ADDR", usage: "Plain HTTP `address` that redirects to HTTPS",
+		set: func(c *Config, v string) error { c.HTTPRedirectAddr = v; return nil },
+		get: func(c *Config) string { return c.HTTPRedirectAddr }},
+	{flag: "hsts-max-age", env: "HSTS_MAX_AGE", usage: "Strict-Transport-Security max-age `duration` for HTTPS responses, 0 disables it",
+		set: durationField(func(c *Config) *time.Duration { return &c.HSTSMaxAge }),
+		get: func(c *Config) string { return c.HSTSMaxAge.String() }},
+	{flag: "admin-addr", env: "ADMIN_ADDR", usage: "Internal `address` for health, metrics, pprof and the admin API, host:port or unix:/path",
+		set: func(c *Config, v string) error { c.AdminAddr = v; return nil },
+		get: func(c *Config) string { return c.AdminAddr }},
+	{flag: "qr-cache-size", env: "QR_CACHE_SIZE", usage: "Number of rendered QR `images` kept in memory",
+		set: intField(func(c *Config) *int { return &c.QRCacheSize }),
+		get: func(c *Config) string { return strconv.Itoa(c.QRCacheSize) }},
+}
+
+// flagValue records a flag so that it can be applied after the config file
+// and the environment. It prints the default in -h output.
+type flagValue struct {
+	def    string
+	isBool bool
+	name   string
+	values map[string]string
+}
+
+func (v *flagValue) String() string {
+	if v == nil {
+		return ""
+	}
+	if s, ok := v.values[v.name]; ok {
+		return s
+	}
+	return v.def
+}
+
+func (v *flagValue) Set(s string) error {
+	v.values[v.name] = s
+	return nil
+}
+
+func (v *flagValue) IsBoolFlag() bool { return v.isBool }
+
+// Load reads the configuration from the command line, the environment and
+// the config file. It prints every problem and exits if the result is
+// invalid.
 func Load() *Config {
-	if baseURL == "" {
-		baseURL = "http://" + addr
+	cfg, err := Parse(flag.CommandLine, os.Args[1:], os.LookupEnv)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
+	return cfg
+}
 
-	flag.Parse()
+// Parse defines the settings on fs, parses args and builds the
+// configuration. Values are taken from flags, then the environment, then
+// the JSON or YAML file named by -c or CONFIG, then the defaults. The
+// arguments after the flags are left in fs.Args.
+func Parse(fs *flag.FlagSet, args []string, lookupEnv func(string) (string, bool)) (*Config, error) {
+	defaults := Default()
+	flags := make(map[string]string)
+	configFile := fs.String("c", "", "JSON or YAML config file `path`")
+	for _, s := range settings {
+		fs.Var(&flagValue{def: s.get(defaults), isBool: s.isBool, name: s.flag, values: flags}, s.flag, s.usage)
+	}
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
 
-	if envAddr := os.Getenv("SERVER_ADDR"); envAddr != "" {
-		addr = envAddr
+	cfg := Default()
+	var errs ValidationError
+
+	cfg.ConfigFile = *configFile
+	if cfg.ConfigFile == "" {
+		cfg.ConfigFile, _ = lookupEnv("CONFIG")
+	}
+	if cfg.ConfigFile != "" {
+		fileErrs, err := loadFile(cfg, cfg.ConfigFile)
+		if err != nil {
+			return nil, err
+		}
+		errs = append(errs, fileErrs...)
+	}
+
+	for _, s := range settings {
+		if v, ok := lookupEnv(s.env); ok && v != "" {
+			if err := s.set(cfg, v); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", s.env, err))
+			}
+		}
+	}
+	for _, s := range settings {
+		if v, ok := flags[s.flag]; ok {
+			if err := s.set(cfg, v); err != nil {
+				errs = append(errs, fmt.Errorf("-%s: %w", s.flag, err))
+			}
+		}
 	}
 
-	if envBaseURL := os.Getenv("BASE_URL"); envBaseURL != "" {
-		baseURL = envBaseURL
+	if cfg.BaseURL == "" {
+		cfg.BaseURL = defaultBaseURL(cfg.Addr, cfg.TLSEnabled())
 	}
 
-	if envLogLevel := os.Getenv("LOG_LEVEL"); envLogLevel != "" {
-		logLevel = envLogLevel
+	if err := cfg.Validate(); err != nil {
+		errs = append(errs, err.(ValidationError)...)
+	}
+	if len(errs) > 0 {
+		return nil, errs
 	}
+	return cfg, nil
+}
+
+// Reload builds the configuration again from the command line of the
+// process, the current environment and the config file, e.g. after the file
+// was edited.
+func Reload() (*Config, error) {
+	fs := flag.NewFlagSet(os.Args[0], flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return Parse(fs, os.Args[1:], os.LookupEnv)
+}
+
+// Change is a setting that differs between two configurations. Settings are
+// named by their environment variables.
+type Change struct {
+	Setting string `json:"setting"`
+	Old     string `json:"old"`
+	New     string `json:"new"`
+}
 
-	if env := os.Getenv("ENVIRONMENT"); env != "" {
-		environment = env
+const redacted = "<redacted>"
+
+// Diff lists the settings that differ from old to new. Secrets are redacted.
+func Diff(old, new *Config) []Change {
+	var changes []Change
+	for _, s := range settings {
+		o, n := s.get(old), s.get(new)
+		if o == n {
+			continue
+		}
+		if s.secret {
+			o, n = redact(o), redact(n)
+		}
+		changes = append(changes, Change{Setting: s.env, Old: o, New: n})
 	}
+	return changes
+}
+
+// Value is the current value of a setting, named by its environment
+// variable.
+type Value struct {
+	Setting string `json:"setting"`
+	Value   string `json:"value"`
+}
 
-	if envFileStoragePath := os.Getenv("FILE_STORAGE_PATH"); envFileStoragePath != "" {
-		fileStoragePath = envFileStoragePath
+// Values lists every setting of c, followed by CONFIG. Secrets, including
+// the whole database DSN, are redacted.
+func (c *Config) Values() []Value {
+	values := make([]Value, 0, len(settings)+1)
+	for _, s := range settings {
+		v := s.get(c)
+		if s.secret {
+			v = redact(v)
+		}
+		values = append(values, Value{Setting: s.env, Value: v})
 	}
+	return append(values, Value{Setting: "CONFIG", Value: c.ConfigFile})
+}
 
-	if envDatabaseDSN := os.Getenv("DATABASE_DSN"); envDatabaseDSN != "" {
-		databaseDSN = envDatabaseDSN
+func redact(v string) string {
+	if v == "" {
+		return ""
 	}
+	return redacted
+}
 
-	return &Config{
-		Environment:     environment,
-		Addr:            addr,
-		BaseURL:         baseURL,
-		LogLevel:        logLevel,
-		FileStoragePath: fileStoragePath,
-		DatabaseDSN:     databaseDSN,
+// TLSEnabled reports whether the server speaks HTTPS.
+func (c *Config) TLSEnabled() bool {
+	return c.TLSCertFile != "" && c.TLSKeyFile != ""
+}
+
+func defaultBaseURL(addr string, tls bool) string {
+	if strings.HasPrefix(addr, ":") {
+		addr = "localhost" + addr
+	}
+	if tls {
+		return "https://" + strings.TrimSuffix(addr, ":443")
+	}
+	return "http://" + strings.TrimSuffix(addr, ":80")
+}
+
+// ValidationError lists every invalid setting.
+type ValidationError []error
+
+func (e ValidationError) Error() string {
+	var b strings.Builder
+	b.WriteString("invalid configuration:")
+	for _, err := range e {
+		b.WriteString("\n  - ")
+		b.WriteString(err.Error())
+	}
+	return b.String()
+}
+
+// Validate checks all settings and reports every problem at once.
+func (c *Config) Validate() error {
+	var errs ValidationError
+	add := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if err := checkAddr(c.Addr); err != nil {
+		add("server address %q: %v", c.Addr, err)
+	}
+	if err := checkHTTPURL(c.BaseURL); err != nil {
+		add("base URL %q: %v", c.BaseURL, err)
+	}
+	if _, err := zapcore.ParseLevel(c.LogLevel); err != nil {
+		add("log level %q: must be debug, info, warn, error, dpanic, panic or fatal", c.LogLevel)
+	}
+	if c.DatabaseDSN != "" {
+		if _, err := pgconn.ParseConfig(c.DatabaseDSN); err != nil {
+			add("database DSN: %v", err)
+		}
+	} else if c.FileStoragePath == "" {
+		add("file storage path: must be set when no database DSN is given")
+	}
+	switch c.RedirectType {
+	case 301, 302, 307, 308:
+	default:
+		add("redirect type %d: must be 301, 302, 307 or 308", c.RedirectType)
+	}
+	if c.ComingSoonURL != "" {
+		if err := checkHTTPURL(c.ComingSoonURL); err != nil {
+			add("coming soon URL %q: %v", c.ComingSoonURL, err)
+		}
+	}
+	for _, p := range c.TrustedProxies {
+		if net.ParseIP(p) == nil {
+			if _, _, err := net.ParseCIDR(p); err != nil {
+				add("trusted proxy %q: must be an IP address or CIDR", p)
+			}
+		}
+	}
+	if c.TrustedSubnet != "" {
+		if _, _, err := net.ParseCIDR(c.TrustedSubnet); err != nil {
+			add("trusted subnet %q: must be a CIDR", c.TrustedSubnet)
+		}
+	}
+	if c.PolicyReloadInterval <= 0 {
+		add("policy reload interval %s: must be positive", c.PolicyReloadInterval)
+	}
+	if c.ImportChunkSize <= 0 {
+		add("import chunk size %d: must be positive", c.ImportChunkSize)
+	}
+	if c.PasswordMaxAttempts <= 0 {
+		add("password max attempts %d: must be positive", c.PasswordMaxAttempts)
+	}
+	if c.PasswordAttemptWindow <= 0 {
+		add("password attempt window %s: must be positive", c.PasswordAttemptWindow)
+	}
+	if c.QRCacheSize <= 0 {
+		add("QR cache size %d: must be positive", c.QRCacheSize)
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		add("TLS: certificate and key files must be set together")
+	}
+	if c.HTTPRedirectAddr != "" {
+		if !c.TLSEnabled() {
+			add("HTTP redirect address: needs TLS to redirect to")
+		} else if err := checkAddr(c.HTTPRedirectAddr); err != nil {
+			add("HTTP redirect address %q: %v", c.HTTPRedirectAddr, err)
+		}
+	}
+	if c.HSTSMaxAge < 0 {
+		add("HSTS max age %s: must not be negative", c.HSTSMaxAge)
+	}
+	if c.AdminAddr != "" {
+		if path, ok := strings.CutPrefix(c.AdminAddr, "unix:"); ok {
+			if path == "" {
+				add("admin address %q: socket path is empty", c.AdminAddr)
+			}
+		} else if err := checkAddr(c.AdminAddr); err != nil {
+			add("admin address %q: %v", c.AdminAddr, err)
+		} else if c.AdminAddr == c.Addr {
+			add("admin address %q: must differ from the server address", c.AdminAddr)
+		}
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+func checkAddr(addr string) error {
+	_, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return errors.New("must be host:port")
+	}
+	if n, err := strconv.Atoi(port); err != nil || n < 0 || n > 65535 {
+		return errors.New("port must be a number from 0 to 65535")
+	}
+	return nil
+}
+
+func checkHTTPURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// boolField, intField and durationField parse a setting into the field
+// returned by f and leave it unchanged on error.
+func boolField(f func(*Config) *bool) func(*Config, string) error {
+	return func(c *Config, s string) error {
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return fmt.Errorf("%q is not a boolean", s)
+		}
+		*f(c) = v
+		return nil
+	}
+}
+
+func intField(f func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, s string) error {
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return fmt.Errorf("%q is not a number", s)
+		}
+		*f(c) = v
+		return nil
+	}
+}
+
+func durationField(f func(*Config) *time.Duration) func(*Config, string) error {
+	return func(c *Config, s string) error {
+		v, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("%q is not a duration such as 5s or 1m", s)
+		}
+		*f(c) = v
+		return nil
+	}
+}
+
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
 	}
+	return items
 }
@@ -0,0 +1,157 @@
+package config
+
+import (
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func parse(t *testing.T, args []string, env map[string]string) (*Config, error) {
+	t.Helper()
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	return Parse(fs, args, func(key string) (string, bool) {
+		v, ok := env[key]
+		return v, ok
+	})
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestParseDefaults(t *testing.T) {
+	cfg, err := parse(t, nil, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "localhost:8080", cfg.Addr)
+	assert.Equal(t, "http://localhost:8080", cfg.BaseURL)
+	assert.True(t, cfg.AutoMigrate)
+	assert.Equal(t, 5*time.Second, cfg.PolicyReloadInterval)
+
+	cfg, err = parse(t, []string{"-a", ":9090", "serve"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:9090", cfg.BaseURL, "base URL follows the address")
+
+	cfg, err = parse(t, []string{"-a", "example.com:443", "-tls-cert", "cert.pem", "-tls-key", "key.pem"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com", cfg.BaseURL)
+}
+
+func TestParsePrecedence(t *testing.T) {
+	path := writeFile(t, "config.yaml", `
+log_level: warn
+server:
+  addr: localhost:7000
+  base_url: https://file.example
+  alias_domains: [a.example, b.example]
+storage:
+  file_path: /var/lib/shortener/db.json
+  auto_migrate: false
+auth:
+  admin_token: from-file
+workers:
+  policy_reload_interval: 30s
+  import_chunk_size: 100
+`)
+	env := map[string]string{
+		"CONFIG":      path,
+		"BASE_URL":    "https://env.example",
+		"ADMIN_TOKEN": "from-env",
+	}
+
+	cfg, err := parse(t, []string{"-admin-token", "from-flag", "-auto-migrate"}, env)
+	require.NoError(t, err)
+	assert.Equal(t, path, cfg.ConfigFile)
+	assert.Equal(t, "warn", cfg.LogLevel)
+	assert.Equal(t, "localhost:7000", cfg.Addr)
+	assert.Equal(t, "https://env.example", cfg.BaseURL)
+	assert.Equal(t, []string{"a.example", "b.example"}, cfg.AliasDomains)
+	assert.Equal(t, "/var/lib/shortener/db.json", cfg.FileStoragePath)
+	assert.True(t, cfg.AutoMigrate)
+	assert.Equal(t, "from-flag", cfg.AdminToken)
+	assert.Equal(t, 30*time.Second, cfg.PolicyReloadInterval)
+	assert.Equal(t, 100, cfg.ImportChunkSize)
+}
+
+func TestParseJSONFile(t *testing.T) {
+	path := writeFile(t, "config.json", `{"server": {"addr": "localhost:7000", "redirect_type": 301}}`)
+	cfg, err := parse(t, []string{"-c", path}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 301, cfg.RedirectType)
+	assert.Equal(t, "http://localhost:7000", cfg.BaseURL)
+
+	path = writeFile(t, "config.json", `{"server": {"adr": "localhost:7000"}}`)
+	_, err = parse(t, []string{"-c", path}, nil)
+	assert.ErrorContains(t, err, "adr")
+}
+
+func TestParseValidation(t *testing.T) {
+	_, err := parse(t, []string{"-a", "nowhere", "-l", "loud", "-d", "postgres://u@h:port/db"},
+		map[string]string{"BASE_URL": "example.com", "REDIRECT_TYPE": "abc"})
+
+	var verr ValidationError
+	require.ErrorAs(t, err, &verr)
+	msg := err.Error()
+	assert.Contains(t, msg, "REDIRECT_TYPE")
+	assert.Contains(t, msg, "server address")
+	assert.Contains(t, msg, "base URL")
+	assert.Contains(t, msg, "log level")
+	assert.Contains(t, msg, "database DSN")
+	assert.Len(t, verr, 5)
+
+	_, err = parse(t, []string{"-tls-cert", "cert.pem", "-http-redirect-addr", ":80"}, nil)
+	assert.ErrorContains(t, err, "certificate and key files must be set together")
+
+	_, err = parse(t, []string{"-admin-addr", "localhost:8080"}, nil)
+	assert.ErrorContains(t, err, "must differ from the server address")
+	_, err = parse(t, nil, map[string]string{"TRUSTED_SUBNET": "10.0.0.1"})
+	assert.ErrorContains(t, err, "trusted subnet")
+	_, err = parse(t, []string{"-admin-addr", "unix:"}, nil)
+	assert.ErrorContains(t, err, "socket path is empty")
+	_, err = parse(t, []string{"-admin-addr", "unix:/run/shortener/admin.sock"}, nil)
+	assert.NoError(t, err)
+	_, err = parse(t, []string{"-e", "staging"}, nil)
+	assert.NoError(t, err, "environment names other than development and production are allowed")
+}
+
+func TestDiff(t *testing.T) {
+	old := Default()
+	next := Default()
+	next.LogLevel = "debug"
+	next.AdminToken = "secret"
+	next.AliasDomains = []string{"a.example"}
+
+	assert.Equal(t, []Change{
+		{Setting: "LOG_LEVEL", Old: "info", New: "debug"},
+		{Setting: "ALIAS_DOMAINS", Old: "", New: "a.example"},
+		{Setting: "ADMIN_TOKEN", Old: "", New: redacted},
+	}, Diff(old, next))
+	assert.Empty(t, Diff(old, Default()))
+}
+
+func TestValues(t *testing.T) {
+	cfg := Default()
+	cfg.DatabaseDSN = "postgres://shortener:pw@localhost:5432/postgres"
+	cfg.AdminToken = "secret"
+	cfg.ConfigFile = "shortener.yaml"
+
+	values := make(map[string]string)
+	for _, v := range cfg.Values() {
+		values[v.Setting] = v.Value
+	}
+	assert.Len(t, values, len(settings)+1)
+	assert.Equal(t, redacted, values["DATABASE_DSN"])
+	assert.Equal(t, redacted, values["ADMIN_TOKEN"])
+	assert.Equal(t, "", values["AUTH_SECRET"])
+	assert.Equal(t, "info", values["LOG_LEVEL"])
+	assert.Equal(t, "shortener.yaml", values["CONFIG"])
+}
@@ -0,0 +1,155 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// fileConfig is the layout of the config file. Empty values leave the
+// default in place.
+type fileConfig struct {
+	Environment string `json:"environment" yaml:"environment"`
+	LogLevel    string `json:"log_level" yaml:"log_level"`
+
+	Server struct {
+		Addr           string   `json:"addr" yaml:"addr"`
+		BaseURL        string   `json:"base_url" yaml:"base_url"`
+		AliasDomains   []string `json:"alias_domains" yaml:"alias_domains"`
+		RedirectType   int      `json:"redirect_type" yaml:"redirect_type"`
+		TrustedProxies []string `json:"trusted_proxies" yaml:"trusted_proxies"`
+		TrustedSubnet  string   `json:"trusted_subnet" yaml:"trusted_subnet"`
+		GeoIPDatabase  string   `json:"geoip_db" yaml:"geoip_db"`
+		URLPolicyFile  string   `json:"url_policy_file" yaml:"url_policy_file"`
+		ComingSoonURL  string   `json:"coming_soon_url" yaml:"coming_soon_url"`
+		QRCacheSize    int      `json:"qr_cache_size" yaml:"qr_cache_size"`
+
+		TLSCertFile      string `json:"tls_cert_file" yaml:"tls_cert_file"`
+		TLSKeyFile       string `json:"tls_key_file" yaml:"tls_key_file"`
+		HTTPRedirectAddr string `json:"http_redirect_addr" yaml:"http_redirect_addr"`
+		HSTSMaxAge       string `json:"hsts_max_age" yaml:"hsts_max_age"`
+
+		AdminAddr string `json:"admin_addr" yaml:"admin_addr"`
+	} `json:"server" yaml:"server"`
+
+	Storage struct {
+		FilePath    string `json:"file_path" yaml:"file_path"`
+		DatabaseDSN string `json:"database_dsn" yaml:"database_dsn"`
+		AutoMigrate *bool  `json:"auto_migrate" yaml:"auto_migrate"`
+	} `json:"storage" yaml:"storage"`
+
+	Auth struct {
+		Secret     string `json:"secret" yaml:"secret"`
+		AdminToken string `json:"admin_token" yaml:"admin_token"`
+		// PasswordMaxAttempts wrong link passwords are allowed per
+		// PasswordAttemptWindow.
+		PasswordMaxAttempts   int    `json:"password_max_attempts" yaml:"password_max_attempts"`
+		PasswordAttemptWindow string `json:"password_attempt_window" yaml:"password_attempt_window"`
+	} `json:"auth" yaml:"auth"`
+
+	Workers struct {
+		PolicyReloadInterval string `json:"policy_reload_interval" yaml:"policy_reload_interval"`
+		ImportChunkSize      int    `json:"import_chunk_size" yaml:"import_chunk_size"`
+	} `json:"workers" yaml:"workers"`
+}
+
+// loadFile applies the config file at path to cfg. The format follows the
+// extension: .json, or .yaml and .yml. Unknown keys are an error. The
+// returned list holds invalid values; err is set when the file cannot be
+// used at all.
+func loadFile(cfg *Config, path string) (ValidationError, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("config file: %w", err)
+	}
+
+	var fc fileConfig
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".json":
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&fc)
+	case ".yaml", ".yml":
+		dec := yaml.NewDecoder(bytes.NewReader(data))
+		dec.KnownFields(true)
+		if err = dec.Decode(&fc); err == io.EOF {
+			err = nil
+		}
+	default:
+		return nil, fmt.Errorf("config file %s: extension must be .json, .yaml or .yml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", path, err)
+	}
+
+	setString(&cfg.Environment, fc.Environment)
+	setString(&cfg.LogLevel, fc.LogLevel)
+
+	setString(&cfg.Addr, fc.Server.Addr)
+	setString(&cfg.BaseURL, fc.Server.BaseURL)
+	if fc.Server.AliasDomains != nil {
+		cfg.AliasDomains = fc.Server.AliasDomains
+	}
+	if fc.Server.RedirectType != 0 {
+		cfg.RedirectType = fc.Server.RedirectType
+	}
+	if fc.Server.TrustedProxies != nil {
+		cfg.TrustedProxies = fc.Server.TrustedProxies
+	}
+	setString(&cfg.TrustedSubnet, fc.Server.TrustedSubnet)
+	setString(&cfg.GeoIPDatabase, fc.Server.GeoIPDatabase)
+	setString(&cfg.URLPolicyFile, fc.Server.URLPolicyFile)
+	setString(&cfg.ComingSoonURL, fc.Server.ComingSoonURL)
+	if fc.Server.QRCacheSize != 0 {
+		cfg.QRCacheSize = fc.Server.QRCacheSize
+	}
+	setString(&cfg.TLSCertFile, fc.Server.TLSCertFile)
+	setString(&cfg.TLSKeyFile, fc.Server.TLSKeyFile)
+	setString(&cfg.HTTPRedirectAddr, fc.Server.HTTPRedirectAddr)
+	setString(&cfg.AdminAddr, fc.Server.AdminAddr)
+
+	setString(&cfg.FileStoragePath, fc.Storage.FilePath)
+	setString(&cfg.DatabaseDSN, fc.Storage.DatabaseDSN)
+	if fc.Storage.AutoMigrate != nil {
+		cfg.AutoMigrate = *fc.Storage.AutoMigrate
+	}
+
+	setString(&cfg.AuthSecret, fc.Auth.Secret)
+	setString(&cfg.AdminToken, fc.Auth.AdminToken)
+	if fc.Auth.PasswordMaxAttempts != 0 {
+		cfg.PasswordMaxAttempts = fc.Auth.PasswordMaxAttempts
+	}
+
+	var errs ValidationError
+	setDuration := func(dst *time.Duration, key, v string) {
+		if v == "" {
+			return
+		}
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			return
+		}
+		*dst = d
+	}
+	setDuration(&cfg.HSTSMaxAge, "server.hsts_max_age", fc.Server.HSTSMaxAge)
+	setDuration(&cfg.PasswordAttemptWindow, "auth.password_attempt_window", fc.Auth.PasswordAttemptWindow)
+	setDuration(&cfg.PolicyReloadInterval, "workers.policy_reload_interval", fc.Workers.PolicyReloadInterval)
+	if fc.Workers.ImportChunkSize != 0 {
+		cfg.ImportChunkSize = fc.Workers.ImportChunkSize
+	}
+	return errs, nil
+}
+
+func setString(dst *string, v string) {
+	if v != "" {
+		*dst = v
+	}
+}
@@ -0,0 +1 @@
+ALTER TABLE short_urls ADD COLUMN redirect_type SMALLINT NOT NULL DEFAULT 0;
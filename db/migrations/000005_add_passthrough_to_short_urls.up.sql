@@ -0,0 +1 @@
+ALTER TABLE short_urls ADD COLUMN passthrough BOOLEAN NOT NULL DEFAULT false;
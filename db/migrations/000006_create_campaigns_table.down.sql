@@ -0,0 +1,4 @@
+ALTER TABLE short_urls DROP COLUMN campaign;
+ALTER TABLE short_urls DROP COLUMN utm;
+
+DROP TABLE IF EXISTS campaigns;
@@ -0,0 +1,8 @@
+CREATE TABLE campaigns (
+    name TEXT PRIMARY KEY,
+    utm JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+ALTER TABLE short_urls ADD COLUMN utm JSONB;
+ALTER TABLE short_urls ADD COLUMN campaign TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+DROP INDEX IF EXISTS idx_short_urls_user_id;
+
+ALTER TABLE short_urls DROP COLUMN user_id;
+ALTER TABLE short_urls DROP COLUMN targeting;
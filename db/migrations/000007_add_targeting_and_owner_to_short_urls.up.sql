@@ -0,0 +1,4 @@
+ALTER TABLE short_urls ADD COLUMN targeting JSONB;
+ALTER TABLE short_urls ADD COLUMN user_id TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX idx_short_urls_user_id ON short_urls(user_id);
@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS clicks;
+
+ALTER TABLE short_urls DROP COLUMN destinations;
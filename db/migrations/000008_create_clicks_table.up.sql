@@ -0,0 +1,10 @@
+ALTER TABLE short_urls ADD COLUMN destinations JSONB;
+
+CREATE TABLE clicks (
+    id BIGSERIAL PRIMARY KEY,
+    hash TEXT NOT NULL,
+    variant TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_clicks_hash ON clicks(hash);
@@ -0,0 +1,2 @@
+ALTER TABLE short_urls DROP COLUMN uses;
+ALTER TABLE short_urls DROP COLUMN max_clicks;
\ No newline at end of file
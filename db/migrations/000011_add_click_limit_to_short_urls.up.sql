@@ -0,0 +1,2 @@
+ALTER TABLE short_urls ADD COLUMN max_clicks INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE short_urls ADD COLUMN uses INTEGER NOT NULL DEFAULT 0;
\ No newline at end of file
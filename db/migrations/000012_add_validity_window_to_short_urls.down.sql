@@ -0,0 +1,2 @@
+ALTER TABLE short_urls DROP COLUMN valid_until;
+ALTER TABLE short_urls DROP COLUMN valid_from;
\ No newline at end of file
@@ -0,0 +1,2 @@
+ALTER TABLE short_urls ADD COLUMN valid_from TIMESTAMPTZ;
+ALTER TABLE short_urls ADD COLUMN valid_until TIMESTAMPTZ;
\ No newline at end of file
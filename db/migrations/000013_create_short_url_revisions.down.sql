@@ -0,0 +1 @@
+DROP TABLE IF EXISTS short_url_revisions;
\ No newline at end of file
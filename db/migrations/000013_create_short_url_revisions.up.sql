@@ -0,0 +1,11 @@
+CREATE TABLE short_url_revisions (
+    id BIGSERIAL PRIMARY KEY,
+    hash TEXT NOT NULL,
+    old_url TEXT NOT NULL,
+    new_url TEXT NOT NULL,
+    user_id TEXT NOT NULL DEFAULT '',
+    snapshot JSONB NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX idx_short_url_revisions_hash ON short_url_revisions(hash);
\ No newline at end of file
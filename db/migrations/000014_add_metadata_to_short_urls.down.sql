@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS idx_short_urls_tags;
+
+ALTER TABLE short_urls DROP COLUMN tags;
+ALTER TABLE short_urls DROP COLUMN notes;
+ALTER TABLE short_urls DROP COLUMN description;
+ALTER TABLE short_urls DROP COLUMN title;
\ No newline at end of file
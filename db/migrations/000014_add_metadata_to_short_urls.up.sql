@@ -0,0 +1,6 @@
+ALTER TABLE short_urls ADD COLUMN title TEXT NOT NULL DEFAULT '';
+ALTER TABLE short_urls ADD COLUMN description TEXT NOT NULL DEFAULT '';
+ALTER TABLE short_urls ADD COLUMN notes TEXT NOT NULL DEFAULT '';
+ALTER TABLE short_urls ADD COLUMN tags TEXT[];
+
+CREATE INDEX idx_short_urls_tags ON short_urls USING GIN (tags);
\ No newline at end of file
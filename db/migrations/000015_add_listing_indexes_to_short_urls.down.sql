@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS idx_short_urls_user_hash;
+DROP INDEX IF EXISTS idx_short_urls_user_views;
+DROP INDEX IF EXISTS idx_short_urls_user_created_at;
\ No newline at end of file
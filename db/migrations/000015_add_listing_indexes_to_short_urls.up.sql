@@ -0,0 +1,7 @@
+UPDATE short_urls s SET views = c.n
+FROM (SELECT hash, count(*) AS n FROM clicks GROUP BY hash) c
+WHERE s.hash = c.hash;
+
+CREATE INDEX idx_short_urls_user_created_at ON short_urls(user_id, created_at, hash);
+CREATE INDEX idx_short_urls_user_views ON short_urls(user_id, views, hash);
+CREATE INDEX idx_short_urls_user_hash ON short_urls(user_id, hash);
\ No newline at end of file
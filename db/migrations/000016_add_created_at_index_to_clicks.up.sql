@@ -0,0 +1 @@
+CREATE INDEX idx_clicks_created_at ON clicks(created_at);
\ No newline at end of file
@@ -0,0 +1,26 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDerive(t *testing.T) {
+	users := NewSigner("secret")
+	unlock := users.Derive("link-unlock")
+
+	userID, ok := users.Verify(users.Sign("u1"))
+	assert.True(t, ok)
+	assert.Equal(t, "u1", userID)
+
+	_, ok = unlock.Verify(users.Sign("u1"))
+	assert.False(t, ok, "user token accepted as unlock token")
+	_, ok = users.Verify(unlock.Sign("u1"))
+	assert.False(t, ok, "unlock token accepted as user token")
+	_, ok = users.Derive("other").Verify(unlock.Sign("u1"))
+	assert.False(t, ok)
+
+	_, ok = NewSigner("secret").Derive("link-unlock").Verify(unlock.Sign("u1"))
+	assert.True(t, ok, "derived keys must not change between restarts")
+}
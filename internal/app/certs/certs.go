@@ -0,0 +1,123 @@
+// Package certs serves a TLS certificate from disk and picks up rotated
+// files without a restart.
+package certs
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/vlxdisluv/shortener/internal/app/logger"
+	"go.uber.org/zap"
+)
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+}
+
+// Loader holds the certificate and key read from certFile and keyFile.
+type Loader struct {
+	certFile string
+	keyFile  string
+
+	mu        sync.RWMutex
+	cert      *tls.Certificate
+	certState fileState
+	keyState  fileState
+	notAfter  time.Time
+}
+
+// Load reads the certificate and key, which must form a valid pair.
+func Load(certFile, keyFile string) (*Loader, error) {
+	l := &Loader{certFile: certFile, keyFile: keyFile}
+	if _, err := l.Reload(); err != nil {
+		return nil, err
+	}
+	return l, nil
+}
+
+// Reload reads the files again if either changed since the last load. A pair
+// that does not parse or does not match keeps the previous certificate in
+// use, e.g. while the certificate is written but the key is not yet.
+func (l *Loader) Reload() (bool, error) {
+	certState, err := stat(l.certFile)
+	if err != nil {
+		return false, err
+	}
+	keyState, err := stat(l.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	l.mu.RLock()
+	unchanged := l.cert != nil && certState == l.certState && keyState == l.keyState
+	l.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(l.certFile, l.keyFile)
+	if err != nil {
+		return false, fmt.Errorf("load certificate: %w", err)
+	}
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	if err != nil {
+		return false, fmt.Errorf("parse certificate: %w", err)
+	}
+	cert.Leaf = leaf
+
+	l.mu.Lock()
+	l.cert = &cert
+	l.certState, l.keyState = certState, keyState
+	l.notAfter = leaf.NotAfter
+	l.mu.Unlock()
+
+	return true, nil
+}
+
+func stat(path string) (fileState, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fileState{}, fmt.Errorf("stat certificate file: %w", err)
+	}
+	return fileState{modTime: fi.ModTime(), size: fi.Size()}, nil
+}
+
+// Watch polls the files and reloads them on change until ctx is done.
+func (l *Loader) Watch(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			changed, err := l.Reload()
+			if err != nil {
+				logger.Log.Error("certificate reload failed, keeping previous certificate", zap.Error(err))
+				continue
+			}
+			if changed {
+				l.mu.RLock()
+				logger.Log.Info("certificate reloaded",
+					zap.String("path", l.certFile),
+					zap.Time("notAfter", l.notAfter),
+				)
+				l.mu.RUnlock()
+			}
+		}
+	}
+}
+
+// GetCertificate is meant for tls.Config.GetCertificate.
+func (l *Loader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	return l.cert, nil
+}
@@ -0,0 +1,72 @@
+package certs
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writePair writes a self-signed certificate for name and its key.
+func writePair(t *testing.T, certFile, keyFile, name string, modTime time.Time) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	require.NoError(t, os.Chtimes(certFile, modTime, modTime))
+	require.NoError(t, os.Chtimes(keyFile, modTime, modTime))
+}
+
+func TestLoader(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	start := time.Now().Add(-time.Minute)
+	writePair(t, certFile, keyFile, "old.example", start)
+
+	l, err := Load(certFile, keyFile)
+	require.NoError(t, err)
+	cert, err := l.GetCertificate(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "old.example", cert.Leaf.Subject.CommonName)
+
+	changed, err := l.Reload()
+	require.NoError(t, err)
+	assert.False(t, changed)
+
+	// A half-written rotation keeps the old certificate.
+	require.NoError(t, os.WriteFile(keyFile, []byte("garbage"), 0o600))
+	_, err = l.Reload()
+	assert.Error(t, err)
+	cert, _ = l.GetCertificate(nil)
+	assert.Equal(t, "old.example", cert.Leaf.Subject.CommonName)
+
+	writePair(t, certFile, keyFile, "new.example", start.Add(time.Second))
+	changed, err = l.Reload()
+	require.NoError(t, err)
+	assert.True(t, changed)
+	cert, _ = l.GetCertificate(nil)
+	assert.Equal(t, "new.example", cert.Leaf.Subject.CommonName)
+}
@@ -0,0 +1,142 @@
+// Package exporter dumps all links for backups and moves between storage
+// backends.
+package exporter
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vlxdisluv/shortener/internal/app/storage"
+	"github.com/vlxdisluv/shortener/internal/app/storage/file"
+)
+
+// Export formats. NDJSON and File keep every attribute of a link; CSV is
+// meant for spreadsheets and leaves out UTM, targeting and destinations.
+const (
+	CSV    = "csv"
+	NDJSON = "ndjson"
+	// File is the line format of the file storage backend. It holds the
+	// links only, without the counter and clicks kept next to them.
+	File = "file"
+)
+
+// ContentType and FileName describe a format for downloads.
+func ContentType(format string) string {
+	if format == CSV {
+		return "text/csv"
+	}
+	return "application/x-ndjson"
+}
+
+func FileName(format string) string {
+	switch format {
+	case CSV:
+		return "links.csv"
+	case File:
+		return "short-url-db.json"
+	}
+	return "links.ndjson"
+}
+
+func CheckFormat(format string) error {
+	switch format {
+	case CSV, NDJSON, File:
+		return nil
+	}
+	return fmt.Errorf("format must be csv, ndjson or file")
+}
+
+var csvHeader = []string{
+	"hash", "original_url", "user_id", "created_at", "title", "description", "notes", "tags",
+	"valid_from", "valid_until", "max_clicks", "uses", "clicks", "redirect_type", "passthrough",
+	"campaign", "password_protected",
+}
+
+// ndjsonLink is a link with its click count, which the stored form omits.
+type ndjsonLink struct {
+	storage.ShortURL
+	Clicks int64 `json:"clicks"`
+}
+
+// Export writes every link to w in hash order and returns how many were
+// written. Nothing is buffered beyond one CSV row, so exports of any size
+// stream.
+func Export(ctx context.Context, links storage.ShortURLRepository, w io.Writer, format string) (int, error) {
+	if err := CheckFormat(format); err != nil {
+		return 0, err
+	}
+
+	var write func(u *storage.ShortURL) error
+	var cw *csv.Writer
+	switch format {
+	case CSV:
+		cw = csv.NewWriter(w)
+		if err := cw.Write(csvHeader); err != nil {
+			return 0, err
+		}
+		write = func(u *storage.ShortURL) error { return cw.Write(csvRow(u)) }
+	case NDJSON:
+		enc := json.NewEncoder(w)
+		write = func(u *storage.ShortURL) error { return enc.Encode(ndjsonLink{ShortURL: *u, Clicks: u.Clicks}) }
+	case File:
+		write = func(u *storage.ShortURL) error {
+			line, err := file.EncodeEntry(*u)
+			if err != nil {
+				return err
+			}
+			_, err = w.Write(line)
+			return err
+		}
+	}
+
+	n := 0
+	err := links.Each(ctx, func(u *storage.ShortURL) error {
+		if err := write(u); err != nil {
+			return err
+		}
+		n++
+		return nil
+	})
+	if cw != nil {
+		cw.Flush()
+		if err == nil {
+			err = cw.Error()
+		}
+	}
+	return n, err
+}
+
+func csvRow(u *storage.ShortURL) []string {
+	return []string{
+		u.Hash,
+		u.Original,
+		u.UserID,
+		formatTime(&u.CreatedAt),
+		u.Title,
+		u.Description,
+		u.Notes,
+		strings.Join(u.Tags, ";"),
+		formatTime(u.ValidFrom),
+		formatTime(u.ValidUntil),
+		strconv.Itoa(u.MaxClicks),
+		strconv.Itoa(u.Uses),
+		strconv.FormatInt(u.Clicks, 10),
+		strconv.Itoa(u.RedirectType),
+		strconv.FormatBool(u.Passthrough),
+		u.Campaign,
+		strconv.FormatBool(u.PasswordHash != ""),
+	}
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
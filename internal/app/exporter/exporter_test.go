@@ -0,0 +1,110 @@
+package exporter
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vlxdisluv/shortener/internal/app/storage"
+	"github.com/vlxdisluv/shortener/internal/app/storage/file"
+)
+
+func testLinks() []storage.ShortURL {
+	created := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	until := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	return []storage.ShortURL{
+		{
+			Hash:         "EwHXdJfB",
+			Original:     "https://example.com/a",
+			RedirectType: 301,
+			UTM:          &storage.UTM{Source: "news"},
+			Targeting:    []storage.TargetingRule{{Destination: "https://example.com/de", Countries: []string{"DE"}}},
+			Destinations: []storage.Destination{{URL: "https://example.com/a1", Weight: 50}, {URL: "https://example.com/a2", Weight: 50}},
+			PasswordHash: "$2a$10$abc",
+			MaxClicks:    10,
+			Uses:         3,
+			ValidUntil:   &until,
+			Title:        "Spring, sale",
+			Tags:         []string{"news", "promo"},
+			UserID:       "u1",
+			CreatedAt:    created,
+		},
+		{Hash: "old-b", Original: "https://example.com/b", CreatedAt: created},
+	}
+}
+
+func newRepo(t *testing.T, path string) *file.ShortURLRepository {
+	repo, err := file.NewShortURLRepository(path, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { repo.Close() })
+	return repo
+}
+
+func TestExportFileRoundTrip(t *testing.T) {
+	dir := t.TempDir()
+	src := newRepo(t, filepath.Join(dir, "src.json"))
+	for _, u := range testLinks() {
+		u := u
+		require.NoError(t, src.Save(context.Background(), &u))
+	}
+
+	var out bytes.Buffer
+	n, err := Export(context.Background(), src, &out, File)
+	require.NoError(t, err)
+	assert.Equal(t, 2, n)
+
+	dst := filepath.Join(dir, "dst.json")
+	require.NoError(t, os.WriteFile(dst, out.Bytes(), 0o600))
+	loaded := newRepo(t, dst)
+	for _, want := range testLinks() {
+		got, err := loaded.Get(context.Background(), want.Hash)
+		require.NoError(t, err)
+		assert.Equal(t, want, *got)
+	}
+}
+
+func TestExportFormats(t *testing.T) {
+	repo := newRepo(t, filepath.Join(t.TempDir(), "db.json"))
+	for _, u := range testLinks() {
+		u := u
+		require.NoError(t, repo.Save(context.Background(), &u))
+	}
+
+	t.Run("csv", func(t *testing.T) {
+		var out bytes.Buffer
+		_, err := Export(context.Background(), repo, &out, CSV)
+		require.NoError(t, err)
+
+		records, err := csv.NewReader(&out).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, records, 3)
+		assert.Equal(t, csvHeader, records[0])
+		assert.Equal(t, []string{
+			"EwHXdJfB", "https://example.com/a", "u1", "2024-05-01T10:00:00Z", "Spring, sale", "", "", "news;promo",
+			"", "2030-01-01T00:00:00Z", "10", "3", "0", "301", "false", "", "true",
+		}, records[1])
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		var out bytes.Buffer
+		_, err := Export(context.Background(), repo, &out, NDJSON)
+		require.NoError(t, err)
+
+		dec := json.NewDecoder(&out)
+		var first ndjsonLink
+		require.NoError(t, dec.Decode(&first))
+		assert.Equal(t, testLinks()[0], first.ShortURL)
+	})
+
+	t.Run("unknown format", func(t *testing.T) {
+		_, err := Export(context.Background(), repo, &bytes.Buffer{}, "xml")
+		assert.Error(t, err)
+	})
+}
@@ -0,0 +1,44 @@
+package geo
+
+import (
+	"fmt"
+	"net"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// DB looks up countries in a local GeoIP2/GeoLite2 .mmdb file. No network
+// lookups are ever made.
+type DB struct {
+	reader *maxminddb.Reader
+}
+
+type countryRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+}
+
+func Open(path string) (*DB, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open geoip database: %w", err)
+	}
+	return &DB{reader: reader}, nil
+}
+
+// Country returns the ISO 3166-1 alpha-2 code of ip, or "" if unknown.
+func (d *DB) Country(ip net.IP) string {
+	if ip == nil {
+		return ""
+	}
+	var rec countryRecord
+	if err := d.reader.Lookup(ip, &rec); err != nil {
+		return ""
+	}
+	return rec.Country.ISOCode
+}
+
+func (d *DB) Close() error {
+	return d.reader.Close()
+}
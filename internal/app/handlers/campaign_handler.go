@@ -0,0 +1,146 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vlxdisluv/shortener/internal/app/storage"
+)
+
+type CampaignStorage interface {
+	Campaigns() storage.CampaignRepository
+}
+
+type CampaignHandler struct {
+	storage CampaignStorage
+}
+
+func NewCampaignHandler(storage CampaignStorage) *CampaignHandler {
+	return &CampaignHandler{storage: storage}
+}
+
+type CampaignReq struct {
+	Name string      `json:"name"`
+	UTM  storage.UTM `json:"utm"`
+}
+
+type CampaignResp struct {
+	Name string      `json:"name"`
+	UTM  storage.UTM `json:"utm"`
+}
+
+func (h *CampaignHandler) CreateCampaign(w http.ResponseWriter, r *http.Request) {
+	var req CampaignReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Name == "" {
+		http.Error(w, "name is required", http.StatusBadRequest)
+		return
+	}
+	if req.UTM == (storage.UTM{}) {
+		http.Error(w, "utm must set at least one parameter", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.storage.Campaigns().Create(r.Context(), &storage.Campaign{Name: req.Name, UTM: req.UTM}); err != nil {
+		if errors.Is(err, storage.ErrConflict) {
+			http.Error(w, "campaign already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	_ = json.NewEncoder(w).Encode(CampaignResp(req))
+}
+
+func (h *CampaignHandler) ListCampaigns(w http.ResponseWriter, r *http.Request) {
+	campaigns, err := h.storage.Campaigns().List(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]CampaignResp, 0, len(campaigns))
+	for _, c := range campaigns {
+		resp = append(resp, CampaignResp{Name: c.Name, UTM: c.UTM})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+func (h *CampaignHandler) GetCampaign(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	c, err := h.storage.Campaigns().Get(r.Context(), name)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "campaign does not exist", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(CampaignResp{Name: c.Name, UTM: c.UTM})
+}
+
+func (h *CampaignHandler) UpdateCampaign(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	var req CampaignReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if req.Name != "" && req.Name != name {
+		http.Error(w, "campaign name cannot be changed", http.StatusBadRequest)
+		return
+	}
+	if req.UTM == (storage.UTM{}) {
+		http.Error(w, "utm must set at least one parameter", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.storage.Campaigns().Update(r.Context(), &storage.Campaign{Name: name, UTM: req.UTM}); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "campaign does not exist", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(CampaignResp{Name: name, UTM: req.UTM})
+}
+
+func (h *CampaignHandler) DeleteCampaign(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "name")
+
+	if err := h.storage.Campaigns().Delete(r.Context(), name); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "campaign does not exist", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
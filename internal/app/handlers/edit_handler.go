@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vlxdisluv/shortener/internal/app/auth"
+	"github.com/vlxdisluv/shortener/internal/app/storage"
+)
+
+// UpdateShortURLReq holds the attributes to change; absent fields are kept.
+// An empty password removes the protection, an empty tag list all tags.
+type UpdateShortURLReq struct {
+	URL          *string      `json:"url"`
+	RedirectType *int         `json:"redirect_type"`
+	Passthrough  *bool        `json:"passthrough"`
+	UTM          *storage.UTM `json:"utm"`
+	Campaign     *string      `json:"campaign"`
+	Password     *string      `json:"password"`
+	MaxClicks    *int         `json:"max_clicks"`
+	Title        *string      `json:"title"`
+	Description  *string      `json:"description"`
+	Notes        *string      `json:"notes"`
+	Tags         *[]string    `json:"tags"`
+}
+
+type LinkResp struct {
+	Hash              string       `json:"hash"`
+	ShortURL          string       `json:"short_url"`
+	URL               string       `json:"url"`
+	RedirectType      int          `json:"redirect_type,omitempty"`
+	Passthrough       bool         `json:"passthrough,omitempty"`
+	UTM               *storage.UTM `json:"utm,omitempty"`
+	Campaign          string       `json:"campaign,omitempty"`
+	PasswordProtected bool         `json:"password_protected,omitempty"`
+	MaxClicks         int          `json:"max_clicks,omitempty"`
+	Uses              int          `json:"uses,omitempty"`
+	ValidFrom         *time.Time   `json:"valid_from,omitempty"`
+	ValidUntil        *time.Time   `json:"valid_until,omitempty"`
+	Title             string       `json:"title,omitempty"`
+	Description       string       `json:"description,omitempty"`
+	Notes             string       `json:"notes,omitempty"`
+	Tags              []string     `json:"tags,omitempty"`
+	Clicks            int64        `json:"clicks"`
+	CreatedAt         time.Time    `json:"created_at"`
+}
+
+func newLinkResp(r *http.Request, link *storage.ShortURL) LinkResp {
+	return LinkResp{
+		Hash:              link.Hash,
+		ShortURL:          fmt.Sprintf("http://%s/%s", r.Host, link.Hash),
+		URL:               link.Original,
+		RedirectType:      link.RedirectType,
+		Passthrough:       link.Passthrough,
+		UTM:               link.UTM,
+		Campaign:          link.Campaign,
+		PasswordProtected: link.PasswordHash != "",
+		MaxClicks:         link.MaxClicks,
+		Uses:              link.Uses,
+		ValidFrom:         link.ValidFrom,
+		ValidUntil:        link.ValidUntil,
+		Title:             link.Title,
+		Description:       link.Description,
+		Notes:             link.Notes,
+		Tags:              link.Tags,
+		Clicks:            link.Clicks,
+		CreatedAt:         link.CreatedAt,
+	}
+}
+
+type RevisionResp struct {
+	ID     int64     `json:"id"`
+	OldURL string    `json:"old_url"`
+	NewURL string    `json:"new_url"`
+	UserID string    `json:"user_id,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+// UpdateShortURL lets the owner change the target and attributes of a link.
+func (h *ShortURLHandler) UpdateShortURL(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	var req UpdateShortURLReq
+	if err := dec.Decode(&req); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	link, ok := h.ownedLink(w, r)
+	if !ok {
+		return
+	}
+	updated := *link
+
+	if req.URL != nil {
+		target, err := h.checkTarget(r.Context(), *req.URL)
+		if err != nil {
+			http.Error(w, err.Error(), targetStatus(err))
+			return
+		}
+		updated.Original = target
+	}
+	if req.RedirectType != nil {
+		if *req.RedirectType != 0 && !IsRedirectType(*req.RedirectType) {
+			http.Error(w, "redirect_type must be one of 301, 302, 307, 308", http.StatusBadRequest)
+			return
+		}
+		updated.RedirectType = *req.RedirectType
+	}
+	if req.Passthrough != nil {
+		updated.Passthrough = *req.Passthrough
+	}
+	if req.UTM != nil {
+		updated.UTM = nonEmptyUTM(req.UTM)
+	}
+	if req.Campaign != nil {
+		if err := h.checkCampaign(r.Context(), *req.Campaign); err != nil {
+			http.Error(w, err.Error(), targetStatus(err))
+			return
+		}
+		updated.Campaign = *req.Campaign
+	}
+	if req.Password != nil {
+		updated.PasswordHash = ""
+		if *req.Password != "" {
+			passwordHash, err := hashPassword(*req.Password)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			updated.PasswordHash = passwordHash
+		}
+	}
+	if req.MaxClicks != nil {
+		if *req.MaxClicks < 0 {
+			http.Error(w, "max_clicks must not be negative", http.StatusBadRequest)
+			return
+		}
+		updated.MaxClicks = *req.MaxClicks
+	}
+
+	meta := linkMetadata{Title: link.Title, Description: link.Description, Notes: link.Notes, Tags: link.Tags}
+	if req.Title != nil {
+		meta.Title = *req.Title
+	}
+	if req.Description != nil {
+		meta.Description = *req.Description
+	}
+	if req.Notes != nil {
+		meta.Notes = *req.Notes
+	}
+	if req.Tags != nil {
+		meta.Tags = *req.Tags
+	}
+	meta, err := meta.check()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	updated.Title, updated.Description, updated.Notes, updated.Tags = meta.Title, meta.Description, meta.Notes, meta.Tags
+
+	if err := h.updateLink(r.Context(), link, &updated); err != nil {
+		if errors.Is(err, storage.ErrConflict) {
+			http.Error(w, "url already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(newLinkResp(r, &updated))
+}
+
+// GetHistory lists the revisions of a link, newest first.
+func (h *ShortURLHandler) GetHistory(w http.ResponseWriter, r *http.Request) {
+	link, ok := h.ownedLink(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := h.storage.Revisions().List(r.Context(), link.Hash)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := make([]RevisionResp, 0, len(revisions))
+	for _, rev := range revisions {
+		resp = append(resp, RevisionResp{ID: rev.ID, OldURL: rev.OldURL, NewURL: rev.NewURL, UserID: rev.UserID, Time: rev.Time})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
+
+// RollbackShortURL restores the link as it was before the given revision.
+// The rollback is recorded as a new revision, so it can be undone as well.
+func (h *ShortURLHandler) RollbackShortURL(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		http.Error(w, "invalid revision id", http.StatusBadRequest)
+		return
+	}
+
+	link, ok := h.ownedLink(w, r)
+	if !ok {
+		return
+	}
+
+	rev, err := h.storage.Revisions().Get(r.Context(), link.Hash, id)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, fmt.Sprintf("revision %d does not exist for %s", id, link.Hash), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	restored := rev.Before
+	restored.Hash, restored.UserID, restored.Uses = link.Hash, link.UserID, link.Uses
+
+	// The policy may have changed since the revision was made.
+	if restored.Original, err = h.checkTarget(r.Context(), restored.Original); err != nil {
+		http.Error(w, err.Error(), targetStatus(err))
+		return
+	}
+
+	if err := h.updateLink(r.Context(), link, &restored); err != nil {
+		if errors.Is(err, storage.ErrConflict) {
+			http.Error(w, "url already exists", http.StatusConflict)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(newLinkResp(r, &restored))
+}
+
+// updateLink stores the new state of a link together with a revision that
+// remembers the old one.
+func (h *ShortURLHandler) updateLink(ctx context.Context, before, after *storage.ShortURL) error {
+	userID, _ := auth.UserID(ctx)
+
+	tx, err := h.storage.UnitOfWork().Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := h.storage.ShortURLs().WithTx(tx).Update(ctx, after); err != nil {
+		return err
+	}
+
+	rev := &storage.Revision{Hash: before.Hash, OldURL: before.Original, NewURL: after.Original, UserID: userID, Before: *before}
+	if err := h.storage.Revisions().WithTx(tx).Record(ctx, rev); err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/vlxdisluv/shortener/internal/app/exporter"
+	"github.com/vlxdisluv/shortener/internal/app/logger"
+	"go.uber.org/zap"
+)
+
+// ExportURLs streams every link of every user as CSV, NDJSON (default) or
+// the line format of the file storage, picked with ?format=.
+func (h *ShortURLHandler) ExportURLs(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = exporter.NDJSON
+	}
+	if err := exporter.CheckFormat(format); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", exporter.ContentType(format))
+	w.Header().Set("Content-Disposition", `attachment; filename="`+exporter.FileName(format)+`"`)
+	w.WriteHeader(http.StatusOK)
+
+	// The status is already sent; a failure shows up as a truncated file.
+	n, err := exporter.Export(r.Context(), h.storage.ShortURLs(), w, format)
+	if err != nil {
+		logger.Log.Error("export failed", zap.Int("written", n), zap.Error(err))
+		return
+	}
+	logger.Log.Info("links exported", zap.String("format", format), zap.Int("links", n))
+}
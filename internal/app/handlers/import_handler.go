@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"strconv"
+
+	"github.com/vlxdisluv/shortener/internal/app/auth"
+	"github.com/vlxdisluv/shortener/internal/app/importer"
+	"github.com/vlxdisluv/shortener/internal/app/logger"
+	"github.com/vlxdisluv/shortener/internal/app/storage"
+	"go.uber.org/zap"
+)
+
+// WithImportChunkSize sets how many rows an import saves per transaction.
+func WithImportChunkSize(n int) Option {
+	return func(h *ShortURLHandler) { h.next.importChunkSize = n }
+}
+
+// CheckImportedLink applies the checks of link creation to an imported
+// link: the target goes through the URL policy and tags are normalized.
+func (h *ShortURLHandler) CheckImportedLink(ctx context.Context, link *storage.ShortURL) error {
+	target, err := h.checkTarget(ctx, link.Original)
+	if err != nil {
+		return err
+	}
+	tags, err := normalizeTags(link.Tags)
+	if err != nil {
+		return err
+	}
+	link.Original, link.Tags = target, tags
+	return nil
+}
+
+// importFormat takes the format from ?format= or the Content-Type.
+func importFormat(r *http.Request) (string, error) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		if format != importer.CSV && format != importer.NDJSON {
+			return "", fmt.Errorf("format must be csv or ndjson")
+		}
+		return format, nil
+	}
+
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "text/csv":
+		return importer.CSV, nil
+	case "application/x-ndjson", "application/jsonl":
+		return importer.NDJSON, nil
+	}
+	return "", fmt.Errorf("send text/csv or application/x-ndjson, or set ?format=csv|ndjson")
+}
+
+// ImportURLs creates links from a CSV or NDJSON upload owned by the caller.
+// The body is streamed and saved in chunks; the response is a per-row
+// report in the same format, with totals in X-Import-* headers.
+func (h *ShortURLHandler) ImportURLs(w http.ResponseWriter, r *http.Request) {
+	defer r.Body.Close()
+
+	userID, ok := auth.UserID(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	format, err := importFormat(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnsupportedMediaType)
+		return
+	}
+
+	rows, err := importer.NewReader(r.Body, format)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// The report can be as large as the upload, so it is kept on disk
+	// until the import is done.
+	reportFile, err := os.CreateTemp("", "shortener-import-*")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer func() {
+		reportFile.Close()
+		os.Remove(reportFile.Name())
+	}()
+
+	report, err := importer.NewReportWriter(reportFile, format, func(hash string) string { return h.shortURL(r, hash) })
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	im := importer.New(h.storage,
+		importer.WithUserID(userID),
+		importer.WithCheck(h.CheckImportedLink),
+		importer.WithChunkSize(h.settings().importChunkSize),
+	)
+	summary, err := im.Run(r.Context(), rows, report.Write)
+	if err == nil {
+		err = report.Flush()
+	}
+	if err != nil {
+		// Chunks committed before the error stay imported.
+		msg := fmt.Sprintf("import stopped after %d rows: %s", summary.Created+summary.Exists+summary.Failed, err)
+		if errors.Is(err, importer.ErrInput) {
+			http.Error(w, msg, http.StatusBadRequest)
+			return
+		}
+		http.Error(w, msg, http.StatusInternalServerError)
+		return
+	}
+
+	if _, err := reportFile.Seek(0, io.SeekStart); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	contentType := "application/x-ndjson"
+	if format == importer.CSV {
+		contentType = "text/csv"
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="import-report.%s"`, format))
+	w.Header().Set("X-Import-Created", strconv.Itoa(summary.Created))
+	w.Header().Set("X-Import-Exists", strconv.Itoa(summary.Exists))
+	w.Header().Set("X-Import-Failed", strconv.Itoa(summary.Failed))
+	w.WriteHeader(http.StatusOK)
+	if _, err := io.Copy(w, reportFile); err != nil {
+		logger.Log.Warn("failed to send import report", zap.Error(err))
+	}
+}
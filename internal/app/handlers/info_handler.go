@@ -0,0 +1,151 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vlxdisluv/shortener/internal/app/auth"
+	"github.com/vlxdisluv/shortener/internal/app/logger"
+	"github.com/vlxdisluv/shortener/internal/app/storage"
+	"go.uber.org/zap"
+)
+
+// Link statuses reported by the info endpoint and the preview page.
+const (
+	statusActive    = "active"
+	statusScheduled = "scheduled"
+	statusExpired   = "expired"
+	statusExhausted = "exhausted"
+	statusDisabled  = "disabled"
+)
+
+type LinkInfoResp struct {
+	Hash     string `json:"hash"`
+	ShortURL string `json:"short_url"`
+	// URL is left out for password-protected links unless the caller owns
+	// the link.
+	URL               string     `json:"url,omitempty"`
+	PasswordProtected bool       `json:"password_protected,omitempty"`
+	Title             string     `json:"title,omitempty"`
+	Owner             string     `json:"owner,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	ValidFrom         *time.Time `json:"valid_from,omitempty"`
+	ValidUntil        *time.Time `json:"valid_until,omitempty"`
+	MaxClicks         int        `json:"max_clicks,omitempty"`
+	Clicks            int64      `json:"clicks"`
+	Status            string     `json:"status"`
+}
+
+// availability checks the schedule and the click limit of a link.
+func availability(link *storage.ShortURL, now time.Time) string {
+	switch {
+	case link.ValidFrom != nil && now.Before(*link.ValidFrom):
+		return statusScheduled
+	case link.ValidUntil != nil && !now.Before(*link.ValidUntil):
+		return statusExpired
+	case link.MaxClicks > 0 && link.Uses >= link.MaxClicks:
+		return statusExhausted
+	}
+	return statusActive
+}
+
+// linkStatus tells whether the link redirects right now and why not.
+func (h *ShortURLHandler) linkStatus(link *storage.ShortURL, now time.Time) string {
+	if status := availability(link, now); status != statusActive {
+		return status
+	}
+	if policy := h.settings().policy; policy != nil {
+		if _, disabled := policy.Disabled(link.Original); disabled {
+			return statusDisabled
+		}
+	}
+	return statusActive
+}
+
+// linkInfo loads the link named in the URL without following it, so it is
+// not counted as a click.
+func (h *ShortURLHandler) linkInfo(w http.ResponseWriter, r *http.Request) (*LinkInfoResp, bool) {
+	hash := chi.URLParam(r, "hash")
+
+	link, err := h.storage.ShortURLs().Get(r.Context(), hash)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, fmt.Sprintf("short url does not exist for %s", hash), http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	info := &LinkInfoResp{
+		Hash:              link.Hash,
+		ShortURL:          fmt.Sprintf("http://%s/%s", r.Host, link.Hash),
+		URL:               link.Original,
+		PasswordProtected: link.PasswordHash != "",
+		Title:             link.Title,
+		Owner:             link.UserID,
+		CreatedAt:         link.CreatedAt,
+		ValidFrom:         link.ValidFrom,
+		ValidUntil:        link.ValidUntil,
+		MaxClicks:         link.MaxClicks,
+		Clicks:            link.Clicks,
+		Status:            h.linkStatus(link, time.Now()),
+	}
+	if info.PasswordProtected {
+		if userID, ok := auth.UserID(r.Context()); !ok || userID != link.UserID {
+			info.URL = ""
+		}
+	}
+	return info, true
+}
+
+// GetLinkInfo describes a link as JSON.
+func (h *ShortURLHandler) GetLinkInfo(w http.ResponseWriter, r *http.Request) {
+	info, ok := h.linkInfo(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(info)
+}
+
+var previewPage = template.Must(template.New("preview").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>Preview of {{.ShortURL}}</title></head>
+<body>
+<h1>{{if .Title}}{{.Title}}{{else}}{{.ShortURL}}{{end}}</h1>
+<dl>
+<dt>Short link</dt><dd>{{.ShortURL}}</dd>
+<dt>Destination</dt><dd>{{if .URL}}{{.URL}}{{else}}hidden, the link is password-protected{{end}}</dd>
+<dt>Status</dt><dd>{{.Status}}</dd>
+{{if not .CreatedAt.IsZero}}<dt>Created</dt><dd>{{.CreatedAt.Format "2006-01-02 15:04 MST"}}</dd>{{end}}
+{{if .ValidUntil}}<dt>Expires</dt><dd>{{.ValidUntil.Format "2006-01-02 15:04 MST"}}</dd>{{end}}
+<dt>Clicks</dt><dd>{{.Clicks}}{{if .MaxClicks}} of {{.MaxClicks}}{{end}}</dd>
+</dl>
+{{if eq .Status "active"}}<p><a href="/{{.Hash}}" rel="nofollow">Continue to the destination</a></p>{{end}}
+</body>
+</html>
+`))
+
+// PreviewShortURL serves /{hash}+, a page describing the link instead of
+// redirecting to it.
+func (h *ShortURLHandler) PreviewShortURL(w http.ResponseWriter, r *http.Request) {
+	info, ok := h.linkInfo(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, no-cache")
+	w.WriteHeader(http.StatusOK)
+	if err := previewPage.Execute(w, info); err != nil {
+		logger.Log.Warn("failed to render preview page", zap.String("hash", info.Hash), zap.Error(err))
+	}
+}
@@ -0,0 +1,40 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+type InternalStatsResp struct {
+	URLs        int64 `json:"urls"`
+	Users       int64 `json:"users"`
+	ClicksToday int64 `json:"clicks_today"`
+}
+
+// GetInternalStats returns service-wide totals for dashboards. Users are the
+// distinct owners of links; today starts at midnight UTC.
+func (h *ShortURLHandler) GetInternalStats(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+
+	urls, err := h.storage.ShortURLs().CountAll(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	users, err := h.storage.ShortURLs().CountUsers(ctx)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	today := time.Now().UTC().Truncate(24 * time.Hour)
+	clicks, err := h.storage.Clicks().CountSince(ctx, today)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(InternalStatsResp{URLs: urls, Users: users, ClicksToday: clicks})
+}
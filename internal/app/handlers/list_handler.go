@@ -0,0 +1,158 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/vlxdisluv/shortener/internal/app/auth"
+	"github.com/vlxdisluv/shortener/internal/app/storage"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+type ListURLsResp struct {
+	Items []LinkResp `json:"items"`
+	// NextCursor is passed as ?cursor= to get the next page, empty on the
+	// last page.
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// pageCursor is the opaque ?cursor= value. It remembers the order it was
+// issued for, so it cannot be reused with a different one.
+type pageCursor struct {
+	Sort      string    `json:"s"`
+	Desc      bool      `json:"d,omitempty"`
+	CreatedAt time.Time `json:"c,omitempty"`
+	Clicks    int64     `json:"n,omitempty"`
+	Hash      string    `json:"h"`
+}
+
+func encodeCursor(q storage.ListQuery, last storage.ShortURL) string {
+	raw, _ := json.Marshal(pageCursor{Sort: q.Sort, Desc: q.Desc, CreatedAt: last.CreatedAt, Clicks: last.Clicks, Hash: last.Hash})
+	return base64.RawURLEncoding.EncodeToString(raw)
+}
+
+func decodeCursor(s string, q storage.ListQuery) (*storage.ListCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	var c pageCursor
+	if err := json.Unmarshal(raw, &c); err != nil || c.Hash == "" {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	if c.Sort != q.Sort || c.Desc != q.Desc {
+		return nil, fmt.Errorf("cursor was issued for a different sort order")
+	}
+	return &storage.ListCursor{CreatedAt: c.CreatedAt, Clicks: c.Clicks, Hash: c.Hash}, nil
+}
+
+// parseListQuery reads the query string of GET /api/urls:
+// sort=created_at|clicks|hash, order=asc|desc, q, created_from, created_to
+// (RFC 3339), limit and cursor.
+func parseListQuery(r *http.Request, userID string) (storage.ListQuery, error) {
+	params := r.URL.Query()
+	q := storage.ListQuery{
+		UserID: userID,
+		Search: params.Get("q"),
+		Sort:   storage.SortCreatedAt,
+		Desc:   true,
+		Limit:  defaultPageSize,
+	}
+
+	if s := params.Get("sort"); s != "" {
+		switch s {
+		case storage.SortCreatedAt, storage.SortClicks, storage.SortHash:
+			q.Sort = s
+		default:
+			return q, fmt.Errorf("sort must be one of created_at, clicks, hash")
+		}
+	}
+
+	switch params.Get("order") {
+	case "", "desc":
+	case "asc":
+		q.Desc = false
+	default:
+		return q, fmt.Errorf("order must be asc or desc")
+	}
+
+	for name, dst := range map[string]**time.Time{"created_from": &q.CreatedFrom, "created_to": &q.CreatedTo} {
+		if v := params.Get(name); v != "" {
+			t, err := time.Parse(time.RFC3339, v)
+			if err != nil {
+				return q, fmt.Errorf("%s must be an RFC 3339 timestamp", name)
+			}
+			*dst = &t
+		}
+	}
+
+	if v := params.Get("limit"); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxPageSize {
+			return q, fmt.Errorf("limit must be between 1 and %d", maxPageSize)
+		}
+		q.Limit = limit
+	}
+
+	if v := params.Get("cursor"); v != "" {
+		after, err := decodeCursor(v, q)
+		if err != nil {
+			return q, err
+		}
+		q.After = after
+	}
+	return q, nil
+}
+
+// ListURLs returns one page of the caller's links. The total number of
+// matching links is sent in the X-Total-Count header.
+func (h *ShortURLHandler) ListURLs(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.UserID(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	q, err := parseListQuery(r, userID)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	total, err := h.storage.ShortURLs().Count(r.Context(), q)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// One extra link tells whether there is a next page.
+	page := q
+	page.Limit++
+	links, err := h.storage.ShortURLs().List(r.Context(), page)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := ListURLsResp{Items: make([]LinkResp, 0, len(links))}
+	if len(links) > q.Limit {
+		links = links[:q.Limit]
+		resp.NextCursor = encodeCursor(q, links[len(links)-1])
+	}
+	for i := range links {
+		resp.Items = append(resp.Items, newLinkResp(r, &links[i]))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/vlxdisluv/shortener/internal/app/auth"
+	"github.com/vlxdisluv/shortener/internal/app/storage"
+)
+
+const (
+	maxTitleLength       = 200
+	maxDescriptionLength = 1000
+	maxNotesLength       = 10000
+	maxTags              = 20
+	maxTagLength         = 50
+)
+
+// linkMetadata holds the descriptive fields shared by create and update
+// requests.
+type linkMetadata struct {
+	Title       string   `json:"title,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Notes       string   `json:"notes,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+}
+
+// check validates the fields and returns them with normalized tags.
+func (m linkMetadata) check() (linkMetadata, error) {
+	if err := checkLength("title", m.Title, maxTitleLength); err != nil {
+		return linkMetadata{}, err
+	}
+	if err := checkLength("description", m.Description, maxDescriptionLength); err != nil {
+		return linkMetadata{}, err
+	}
+	if err := checkLength("notes", m.Notes, maxNotesLength); err != nil {
+		return linkMetadata{}, err
+	}
+	tags, err := normalizeTags(m.Tags)
+	if err != nil {
+		return linkMetadata{}, err
+	}
+	m.Tags = tags
+	return m, nil
+}
+
+func checkLength(field, value string, limit int) error {
+	if utf8.RuneCountInString(value) > limit {
+		return fmt.Errorf("%s must not be longer than %d characters", field, limit)
+	}
+	return nil
+}
+
+// normalizeTags lower-cases, trims, de-duplicates and sorts tags so that
+// filtering by tag is an exact match.
+func normalizeTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool, len(tags))
+	var normalized []string
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.TrimSpace(tag))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, fmt.Errorf("tag %q must not be longer than %d characters", tag, maxTagLength)
+		}
+		seen[tag] = true
+		normalized = append(normalized, tag)
+	}
+	if len(normalized) > maxTags {
+		return nil, fmt.Errorf("a link can have at most %d tags", maxTags)
+	}
+	sort.Strings(normalized)
+	return normalized, nil
+}
+
+type UserURLResp struct {
+	ShortURL    string   `json:"short_url"`
+	OriginalURL string   `json:"original_url"`
+	Title       string   `json:"title,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Notes       string   `json:"notes,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+}
+
+// GetUserURLs lists the caller's links, optionally filtered by ?tag= and a
+// ?q= search over title, description and notes.
+func (h *ShortURLHandler) GetUserURLs(w http.ResponseWriter, r *http.Request) {
+	userID, ok := auth.UserID(r.Context())
+	if !ok {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	filter := storage.LinkFilter{
+		Tag:    strings.ToLower(strings.TrimSpace(r.URL.Query().Get("tag"))),
+		Search: strings.TrimSpace(r.URL.Query().Get("q")),
+	}
+
+	links, err := h.storage.ShortURLs().ListByUser(r.Context(), userID, filter)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if len(links) == 0 {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	resp := make([]UserURLResp, 0, len(links))
+	for _, link := range links {
+		resp = append(resp, UserURLResp{
+			ShortURL:    fmt.Sprintf("http://%s/%s", r.Host, link.Hash),
+			OriginalURL: link.Original,
+			Title:       link.Title,
+			Description: link.Description,
+			Notes:       link.Notes,
+			Tags:        link.Tags,
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"html/template"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vlxdisluv/shortener/internal/app/logger"
+	"github.com/vlxdisluv/shortener/internal/app/throttle"
+	"go.uber.org/zap"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	passwordCookiePrefix  = "p_"
+	passwordUnlockTTL     = time.Hour
+	passwordMaxAttempts   = 5
+	passwordAttemptWindow = 15 * time.Minute
+	// bcrypt ignores everything after 72 bytes.
+	passwordMaxLength = 72
+)
+
+// TokenSigner signs short values stored in cookies.
+type TokenSigner interface {
+	Sign(msg string) string
+	Verify(token string) (string, bool)
+}
+
+// WithSigner lets visitors who entered a link password skip the prompt on
+// repeat visits for passwordUnlockTTL. s must not sign other tokens, such
+// as user cookies, or one could be passed off as the other.
+func WithSigner(s TokenSigner) Option {
+	return func(h *ShortURLHandler) { h.signer = s }
+}
+
+// WithPasswordThrottle limits wrong password attempts per link to
+// maxAttempts within window. The counts are kept when a reconfiguration
+// does not change the limits.
+func WithPasswordThrottle(maxAttempts int, window time.Duration) Option {
+	return func(h *ShortURLHandler) {
+		s := h.next
+		if s.pwThrottle != nil && s.pwMaxAttempts == maxAttempts && s.pwWindow == window {
+			return
+		}
+		s.pwThrottle = throttle.New(maxAttempts, window)
+		s.pwMaxAttempts, s.pwWindow = maxAttempts, window
+	}
+}
+
+func hashPassword(password string) (string, error) {
+	if len(password) > passwordMaxLength {
+		return "", fmt.Errorf("password must not be longer than %d bytes", passwordMaxLength)
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", err
+	}
+	return string(hash), nil
+}
+
+var passwordForm = template.Must(template.New("password").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>Password required</title></head>
+<body>
+<form method="post" action="{{.Action}}">
+<p>This link is protected. Enter the password to continue.</p>
+{{if .Error}}<p><strong>{{.Error}}</strong></p>{{end}}
+<input type="password" name="password" autofocus required>
+<button type="submit">Continue</button>
+</form>
+</body>
+</html>
+`))
+
+func renderPasswordForm(w http.ResponseWriter, r *http.Request, status int, errMsg string) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "private, no-store")
+	w.WriteHeader(status)
+	err := passwordForm.Execute(w, struct {
+		Action string
+		Error  string
+	}{Action: r.URL.RequestURI(), Error: errMsg})
+	if err != nil {
+		logger.Log.Warn("failed to render password form", zap.Error(err))
+	}
+}
+
+// UnlockShortURL checks the password POSTed from the form rendered by
+// GetShortURL and redirects on success.
+func (h *ShortURLHandler) UnlockShortURL(w http.ResponseWriter, r *http.Request) {
+	link, ok := h.loadLink(w, r)
+	if !ok || h.serveUnavailable(w, r, link) {
+		return
+	}
+	if link.PasswordHash == "" {
+		h.redirect(w, r, link, http.StatusSeeOther)
+		return
+	}
+
+	// The attempt is counted before the slow compare, so that parallel
+	// guesses cannot all pass the limit while the first ones are checked.
+	attempts := h.settings().pwThrottle
+	if ok, wait := attempts.Attempt(link.Hash); !ok {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		renderPasswordForm(w, r, http.StatusTooManyRequests, "Too many attempts, try again later.")
+		return
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(r.PostFormValue("password")))
+	if err != nil {
+		if !errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			logger.Log.Warn("failed to check link password", zap.String("hash", link.Hash), zap.Error(err))
+		}
+		renderPasswordForm(w, r, http.StatusUnauthorized, "Wrong password.")
+		return
+	}
+	attempts.Reset(link.Hash)
+
+	if h.signer != nil {
+		expires := time.Now().Add(passwordUnlockTTL)
+		http.SetCookie(w, &http.Cookie{
+			Name:     passwordCookiePrefix + link.Hash,
+			Value:    h.signer.Sign(unlockMessage(link.Hash, link.PasswordHash, expires)),
+			Path:     "/" + link.Hash,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	h.redirect(w, r, link, http.StatusSeeOther)
+}
+
+// unlocked reports whether the visitor holds a valid unlock cookie. The
+// cookie is bound to the current password, so changing it locks everyone out.
+func (h *ShortURLHandler) unlocked(r *http.Request, hash, passwordHash string) bool {
+	if h.signer == nil {
+		return false
+	}
+
+	c, err := r.Cookie(passwordCookiePrefix + hash)
+	if err != nil {
+		return false
+	}
+	msg, ok := h.signer.Verify(c.Value)
+	if !ok {
+		return false
+	}
+
+	parts := strings.Split(msg, "|")
+	if len(parts) != 3 || parts[0] != hash || parts[2] != passwordFingerprint(passwordHash) {
+		return false
+	}
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	return err == nil && time.Now().Unix() < expires
+}
+
+func unlockMessage(hash, passwordHash string, expires time.Time) string {
+	return hash + "|" + strconv.FormatInt(expires.Unix(), 10) + "|" + passwordFingerprint(passwordHash)
+}
+
+func passwordFingerprint(passwordHash string) string {
+	sum := sha256.Sum256([]byte(passwordHash))
+	return hex.EncodeToString(sum[:8])
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vlxdisluv/shortener/internal/app/qr"
+	"github.com/vlxdisluv/shortener/internal/app/storage"
+)
+
+// qrCacheSize is the default number of rendered QR images kept in memory.
+const qrCacheSize = 1000
+
+// WithQRCacheSize sets how many rendered QR images are kept in memory. The
+// cache is kept when a reconfiguration does not change the size.
+func WithQRCacheSize(size int) Option {
+	return func(h *ShortURLHandler) {
+		s := h.next
+		if s.qrCache != nil && s.qrCacheSize == size {
+			return
+		}
+		s.qrCache, s.qrCacheSize = qr.NewCache(size), size
+	}
+}
+
+// WithBaseURL makes short URLs in QR codes start with baseURL instead of the
+// host of the request.
+func WithBaseURL(baseURL string) Option {
+	return func(h *ShortURLHandler) { h.next.baseURL = strings.TrimRight(baseURL, "/") }
+}
+
+// shortURL is the public address of a link as printed on QR codes.
+func (h *ShortURLHandler) shortURL(r *http.Request, hash string) string {
+	return h.publicURL(r, "/"+hash)
+}
+
+// qrURL is the address of the QR code image of a link: /{hash}/qr, or
+// /api/urls/{hash}/qr for passthrough links, which forward /{hash}/qr to
+// their target like any other path.
+func (h *ShortURLHandler) qrURL(r *http.Request, link *storage.ShortURL) string {
+	if link.Passthrough {
+		return h.publicURL(r, "/api/urls/"+link.Hash+"/qr")
+	}
+	return h.publicURL(r, "/"+link.Hash+"/qr")
+}
+
+func (h *ShortURLHandler) publicURL(r *http.Request, path string) string {
+	if baseURL := h.settings().baseURL; baseURL != "" {
+		return baseURL + path
+	}
+	return fmt.Sprintf("http://%s%s", r.Host, path)
+}
+
+// parseQROptions reads the query string of a QR code request: format=png|svg,
+// size (pixels), level=L|M|Q|H, margin (modules), fg and bg (hex colors).
+func parseQROptions(r *http.Request) (qr.Options, error) {
+	params := r.URL.Query()
+	o := qr.DefaultOptions()
+
+	if v := params.Get("format"); v != "" {
+		o.Format = v
+	}
+	if v := params.Get("level"); v != "" {
+		o.Level = v
+	}
+	for name, dst := range map[string]*int{"size": &o.Size, "margin": &o.Margin} {
+		if v := params.Get(name); v != "" {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return o, fmt.Errorf("%s must be a number", name)
+			}
+			*dst = n
+		}
+	}
+	if v := params.Get("fg"); v != "" {
+		c, err := qr.ParseColor(v)
+		if err != nil {
+			return o, fmt.Errorf("fg: %w", err)
+		}
+		o.Foreground = c
+	}
+	if v := params.Get("bg"); v != "" {
+		c, err := qr.ParseColor(v)
+		if err != nil {
+			return o, fmt.Errorf("bg: %w", err)
+		}
+		o.Background = c
+	}
+	return o, o.Validate()
+}
+
+// GetQRCode serves /api/urls/{hash}/qr, the QR code of any short link.
+// GetShortURL serves the same code under /{hash}/qr. Rendering the code
+// does not follow the link, so it is not counted as a click.
+func (h *ShortURLHandler) GetQRCode(w http.ResponseWriter, r *http.Request) {
+	hash := chi.URLParam(r, "hash")
+
+	o, err := parseQROptions(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if _, err := h.storage.ShortURLs().Get(r.Context(), hash); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, fmt.Sprintf("short url does not exist for %s", hash), http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	h.writeQRCode(w, r, hash, o)
+}
+
+func (h *ShortURLHandler) writeQRCode(w http.ResponseWriter, r *http.Request, hash string, o qr.Options) {
+	img, err := h.settings().qrCache.Render(h.shortURL(r, hash), o)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	contentType := "image/png"
+	if o.Format == qr.SVG {
+		contentType = "image/svg+xml"
+	}
+	w.Header().Set("Content-Type", contentType)
+	// The short URL of a hash never changes, neither does its code.
+	w.Header().Set("Cache-Control", "public, max-age=86400")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(img)
+}
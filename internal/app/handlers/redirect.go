@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/vlxdisluv/shortener/internal/app/logger"
+	"github.com/vlxdisluv/shortener/internal/app/rotation"
+	"github.com/vlxdisluv/shortener/internal/app/storage"
+	"go.uber.org/zap"
+)
+
+// IsRedirectType reports whether code may be used as a link's redirect type.
+func IsRedirectType(code int) bool {
+	switch code {
+	case http.StatusMovedPermanently, http.StatusFound, http.StatusTemporaryRedirect, http.StatusPermanentRedirect:
+		return true
+	}
+	return false
+}
+
+// redirectStatus picks the link's own redirect type, falling back to the
+// service-wide default.
+func (h *ShortURLHandler) redirectStatus(linkType int) int {
+	if linkType != 0 {
+		return linkType
+	}
+	if code := h.settings().defaultRedirect; code != 0 {
+		return code
+	}
+	return http.StatusTemporaryRedirect
+}
+
+// redirectCacheControl lets browsers and proxies cache permanent redirects,
+// while 302 is used for tracked links and must reach us on every click.
+func redirectCacheControl(status int) string {
+	switch status {
+	case http.StatusMovedPermanently, http.StatusPermanentRedirect:
+		return "public, max-age=86400"
+	case http.StatusFound:
+		return "private, no-store"
+	default:
+		return "private, no-cache"
+	}
+}
+
+var (
+	errPassthroughHost = errors.New("passthrough must not change the target host")
+	errPassthroughPath = errors.New("passthrough path must not contain .. segments")
+)
+
+// passthroughURL appends the visitor's extra path to target and merges the
+// visitor's query into it. Parameters already present in target win over
+// the visitor's ones, so a visitor cannot override what the link owner set.
+// The result always keeps the scheme and host of target and stays below
+// its path.
+func passthroughURL(target, suffix string, query url.Values) (string, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return "", err
+	}
+	if u.Host == "" {
+		return "", errPassthroughHost
+	}
+
+	if suffix != "" {
+		// JoinPath cannot reach the host, but ".." would climb above the
+		// target's path. An escaped "%2e%2e" is caught too, browsers
+		// resolve it like "..".
+		for _, seg := range strings.Split(suffix, "/") {
+			s, err := url.PathUnescape(seg)
+			if err != nil {
+				s = seg
+			}
+			if s == ".." {
+				return "", errPassthroughPath
+			}
+		}
+		u = u.JoinPath(suffix)
+	}
+
+	own := u.Query()
+	extra := make(url.Values)
+	for key, values := range query {
+		if _, set := own[key]; !set {
+			extra[key] = values
+		}
+	}
+	if len(extra) > 0 {
+		if u.RawQuery != "" {
+			u.RawQuery += "&"
+		}
+		u.RawQuery += extra.Encode()
+	}
+
+	merged := u.String()
+	check, err := url.Parse(merged)
+	if err != nil || check.Scheme != u.Scheme || check.Host != u.Host {
+		return "", errPassthroughHost
+	}
+	return merged, nil
+}
+
+// linkUTM combines the link's campaign template with its own UTM values,
+// the latter taking precedence. A deleted template is silently ignored.
+func (h *ShortURLHandler) linkUTM(ctx context.Context, link *storage.ShortURL) storage.UTM {
+	var utm storage.UTM
+
+	if link.Campaign != "" {
+		c, err := h.storage.Campaigns().Get(ctx, link.Campaign)
+		switch {
+		case err == nil:
+			utm = c.UTM
+		case !errors.Is(err, storage.ErrNotFound):
+			logger.Log.Warn("failed to load campaign template",
+				zap.String("hash", link.Hash),
+				zap.String("campaign", link.Campaign),
+				zap.Error(err),
+			)
+		}
+	}
+
+	if link.UTM != nil {
+		overlay := func(dst *string, v string) {
+			if v != "" {
+				*dst = v
+			}
+		}
+		overlay(&utm.Source, link.UTM.Source)
+		overlay(&utm.Medium, link.UTM.Medium)
+		overlay(&utm.Campaign, link.UTM.Campaign)
+		overlay(&utm.Term, link.UTM.Term)
+		overlay(&utm.Content, link.UTM.Content)
+	}
+
+	return utm
+}
+
+// withUTM appends the non-empty UTM parameters that destination does not
+// carry yet. Its own query is left as it is, byte for byte, so signed URLs
+// and parameter order survive, and utm_* values already there win.
+func withUTM(destination string, utm storage.UTM) (string, error) {
+	if utm == (storage.UTM{}) {
+		return destination, nil
+	}
+
+	u, err := url.Parse(destination)
+	if err != nil {
+		return "", err
+	}
+
+	own := u.Query()
+	for _, p := range []struct{ key, value string }{
+		{"utm_source", utm.Source},
+		{"utm_medium", utm.Medium},
+		{"utm_campaign", utm.Campaign},
+		{"utm_term", utm.Term},
+		{"utm_content", utm.Content},
+	} {
+		if _, set := own[p.key]; set || p.value == "" {
+			continue
+		}
+		if u.RawQuery != "" {
+			u.RawQuery += "&"
+		}
+		u.RawQuery += p.key + "=" + url.QueryEscape(p.value)
+	}
+	return u.String(), nil
+}
+
+const (
+	variantCookiePrefix = "v_"
+	variantCookieMaxAge = 30 * 24 * 60 * 60
+)
+
+// pickVariant chooses one of the link's weighted destinations. A returning
+// visitor keeps the variant stored in the cookie as long as the link still
+// has it; new visitors are assigned deterministically from their IP and
+// User-Agent.
+func pickVariant(w http.ResponseWriter, r *http.Request, link *storage.ShortURL, ip net.IP) (string, bool) {
+	if len(link.Destinations) == 0 {
+		return "", false
+	}
+
+	name := variantCookiePrefix + link.Hash
+	if c, err := r.Cookie(name); err == nil {
+		for _, d := range link.Destinations {
+			if variantKey(d.URL) == c.Value {
+				return d.URL, true
+			}
+		}
+	}
+
+	i := rotation.Pick(link.Destinations, link.Hash+"|"+ip.String()+"|"+r.UserAgent())
+	http.SetCookie(w, &http.Cookie{
+		Name:     name,
+		Value:    variantKey(link.Destinations[i].URL),
+		Path:     "/" + link.Hash,
+		MaxAge:   variantCookieMaxAge,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+	return link.Destinations[i].URL, true
+}
+
+// variantKey identifies a destination in the variant cookie. Unlike its
+// index it survives edits that reorder, add or remove other destinations.
+func variantKey(destination string) string {
+	sum := sha256.Sum256([]byte(destination))
+	return hex.EncodeToString(sum[:8])
+}
+
+// clientIP returns the visitor's address, looking behind trusted proxies
+// when a resolver is configured.
+func (h *ShortURLHandler) clientIP(r *http.Request) net.IP {
+	if h.realIP != nil {
+		return h.realIP.ClientIP(r)
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
+
+// country resolves the visitor's country, or "" without a geo database.
+func (h *ShortURLHandler) country(ip net.IP) string {
+	if h.geo == nil {
+		return ""
+	}
+	return h.geo.Country(ip)
+}
+
+// recordClick stores the click without failing the redirect.
+func (h *ShortURLHandler) recordClick(ctx context.Context, c storage.Click) {
+	if err := h.storage.Clicks().Record(ctx, c); err != nil {
+		logger.Log.Warn("failed to record click", zap.String("hash", c.Hash), zap.Error(err))
+	}
+}
@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/vlxdisluv/shortener/config"
+)
+
+// ConfigReloader re-reads the configuration and applies what it can without
+// a restart.
+type ConfigReloader interface {
+	Reload() (applied, restartRequired []config.Change, err error)
+}
+
+type ReloadHandler struct {
+	reloader ConfigReloader
+}
+
+func NewReloadHandler(r ConfigReloader) *ReloadHandler {
+	return &ReloadHandler{reloader: r}
+}
+
+type ReloadResp struct {
+	Applied         []config.Change `json:"applied"`
+	RestartRequired []config.Change `json:"restart_required"`
+}
+
+// ReloadConfig does the same as sending SIGHUP to the server. An invalid
+// configuration is answered with 422 and nothing is applied.
+func (h *ReloadHandler) ReloadConfig(w http.ResponseWriter, r *http.Request) {
+	applied, restart, err := h.reloader.Reload()
+	if err != nil {
+		http.Error(w, "reload failed, keeping current configuration: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+
+	resp := ReloadResp{Applied: applied, RestartRequired: restart}
+	if resp.Applied == nil {
+		resp.Applied = []config.Change{}
+	}
+	if resp.RestartRequired == nil {
+		resp.RestartRequired = []config.Change{}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	enc := json.NewEncoder(w)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(resp)
+}
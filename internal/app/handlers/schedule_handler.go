@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// WithComingSoonURL redirects visitors of links that are not active yet to
+// rawURL instead of answering 404.
+func WithComingSoonURL(rawURL string) Option {
+	return func(h *ShortURLHandler) { h.next.comingSoon = rawURL }
+}
+
+type ScheduleReq struct {
+	ValidFrom  *time.Time `json:"valid_from"`
+	ValidUntil *time.Time `json:"valid_until"`
+}
+
+type ScheduleResp struct {
+	Hash       string     `json:"hash"`
+	ValidFrom  *time.Time `json:"valid_from"`
+	ValidUntil *time.Time `json:"valid_until"`
+}
+
+func (h *ShortURLHandler) GetSchedule(w http.ResponseWriter, r *http.Request) {
+	link, ok := h.ownedLink(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(ScheduleResp{Hash: link.Hash, ValidFrom: link.ValidFrom, ValidUntil: link.ValidUntil})
+}
+
+// UpdateSchedule replaces the activation window of a link; a null bound
+// removes it.
+func (h *ShortURLHandler) UpdateSchedule(w http.ResponseWriter, r *http.Request) {
+	var req ScheduleReq
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	if err := checkSchedule(req.ValidFrom, req.ValidUntil); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	link, ok := h.ownedLink(w, r)
+	if !ok {
+		return
+	}
+
+	before := *link
+	link.ValidFrom, link.ValidUntil = req.ValidFrom, req.ValidUntil
+	if err := h.updateLink(r.Context(), &before, link); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(ScheduleResp{Hash: link.Hash, ValidFrom: link.ValidFrom, ValidUntil: link.ValidUntil})
+}
+
+func checkSchedule(from, until *time.Time) error {
+	if from != nil && until != nil && !from.Before(*until) {
+		return fmt.Errorf("valid_from must be before valid_until")
+	}
+	return nil
+}
@@ -5,43 +5,181 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/vlxdisluv/shortener/internal/app/auth"
+	"github.com/vlxdisluv/shortener/internal/app/qr"
 	"github.com/vlxdisluv/shortener/internal/app/shortener"
 	"github.com/vlxdisluv/shortener/internal/app/storage"
+	"github.com/vlxdisluv/shortener/internal/app/targeting"
+	"github.com/vlxdisluv/shortener/internal/app/throttle"
 )
 
+const errClickLimit = "short url has reached its click limit"
+
 type Storage interface {
 	ShortURLs() storage.ShortURLRepository
 	Counters() storage.CounterRepository
+	Campaigns() storage.CampaignRepository
+	Clicks() storage.ClickRepository
+	Revisions() storage.RevisionRepository
 	UnitOfWork() storage.UnitOfWork
 }
 
+// URLPolicy decides which target URLs may be shortened and which stored
+// links must no longer redirect.
+type URLPolicy interface {
+	Allow(rawURL string) (reason string, ok bool)
+	Disabled(rawURL string) (reason string, disabled bool)
+}
+
+// ClientIPResolver finds the visitor's address behind reverse proxies.
+type ClientIPResolver interface {
+	ClientIP(r *http.Request) net.IP
+}
+
+// CountryResolver maps an IP address to an ISO 3166-1 alpha-2 country code.
+type CountryResolver interface {
+	Country(ip net.IP) string
+}
+
 type ShortURLHandler struct {
 	storage Storage
+	realIP  ClientIPResolver
+	geo     CountryResolver
+	signer  TokenSigner
+
+	// cur holds the settings in use. Options write to next while they are
+	// applied, see Reconfigure.
+	cur         atomic.Pointer[settings]
+	next        *settings
+	reconfigure sync.Mutex
 }
 
-func NewShortURLHandler(storage Storage) *ShortURLHandler {
-	return &ShortURLHandler{storage: storage}
+// settings are the parts of the handler that can change while it serves
+// requests.
+type settings struct {
+	policy          URLPolicy
+	ownHosts        map[string]bool
+	defaultRedirect int
+	comingSoon      string
+	baseURL         string
+	importChunkSize int
+
+	pwThrottle    *throttle.Throttle
+	pwMaxAttempts int
+	pwWindow      time.Duration
+	qrCache       *qr.Cache
+	qrCacheSize   int
+}
+
+type Option func(*ShortURLHandler)
+
+func WithURLPolicy(p URLPolicy) Option {
+	return func(h *ShortURLHandler) { h.next.policy = p }
+}
+
+// WithOwnDomains makes the handler recognize targets that point at the
+// shortener itself, so chains are collapsed and loops are rejected.
+func WithOwnDomains(baseURL string, aliases []string) Option {
+	return func(h *ShortURLHandler) { h.next.ownHosts = ownHosts(baseURL, aliases) }
+}
+
+// WithDefaultRedirectType sets the status used for links without their own
+// redirect type.
+func WithDefaultRedirectType(code int) Option {
+	return func(h *ShortURLHandler) { h.next.defaultRedirect = code }
+}
+
+func WithClientIPResolver(r ClientIPResolver) Option {
+	return func(h *ShortURLHandler) { h.realIP = r }
+}
+
+// WithCountryResolver enables country targeting and per-country statistics.
+func WithCountryResolver(g CountryResolver) Option {
+	return func(h *ShortURLHandler) { h.geo = g }
+}
+
+func NewShortURLHandler(storage Storage, opts ...Option) *ShortURLHandler {
+	h := &ShortURLHandler{storage: storage, next: &settings{}}
+	WithPasswordThrottle(passwordMaxAttempts, passwordAttemptWindow)(h)
+	WithQRCacheSize(qrCacheSize)(h)
+	for _, opt := range opts {
+		opt(h)
+	}
+	h.cur.Store(h.next)
+	h.next = nil
+	return h
+}
+
+// Reconfigure applies opts to a running handler. Requests in flight finish
+// with the settings they started with. Options for anything other than the
+// reloadable settings, such as WithSigner, are ignored.
+func (h *ShortURLHandler) Reconfigure(opts ...Option) {
+	h.reconfigure.Lock()
+	defer h.reconfigure.Unlock()
+
+	next := *h.cur.Load()
+	scratch := &ShortURLHandler{next: &next}
+	for _, opt := range opts {
+		opt(scratch)
+	}
+	h.cur.Store(&next)
+}
+
+func (h *ShortURLHandler) settings() *settings {
+	return h.cur.Load()
 }
 
 type CreateShortURLReq struct {
-	URL string `json:"url"`
+	URL          string       `json:"url"`
+	RedirectType int          `json:"redirect_type,omitempty"`
+	Passthrough  bool         `json:"passthrough,omitempty"`
+	UTM          *storage.UTM `json:"utm,omitempty"`
+	Campaign     string       `json:"campaign,omitempty"`
+	Password     string       `json:"password,omitempty"`
+	MaxClicks    int          `json:"max_clicks,omitempty"`
+	ValidFrom    *time.Time   `json:"valid_from,omitempty"`
+	ValidUntil   *time.Time   `json:"valid_until,omitempty"`
+	QR           bool         `json:"qr,omitempty"` // also return the address of the QR code
+	linkMetadata
+
+	Targeting    []storage.TargetingRule `json:"targeting,omitempty"`
+	Destinations []storage.Destination   `json:"destinations,omitempty"`
 }
 
 type CreateShortURLResp struct {
 	ShortURL string `json:"result"`
+	QR       string `json:"qr,omitempty"`
 }
 
 type CreateShortURLBatchReq struct {
-	OrigURL       string `json:"original_url"`
-	CorrelationID string `json:"correlation_id"`
+	OrigURL       string       `json:"original_url"`
+	CorrelationID string       `json:"correlation_id"`
+	RedirectType  int          `json:"redirect_type,omitempty"`
+	Passthrough   bool         `json:"passthrough,omitempty"`
+	UTM           *storage.UTM `json:"utm,omitempty"`
+	Campaign      string       `json:"campaign,omitempty"`
+	Password      string       `json:"password,omitempty"`
+	MaxClicks     int          `json:"max_clicks,omitempty"`
+	ValidFrom     *time.Time   `json:"valid_from,omitempty"`
+	ValidUntil    *time.Time   `json:"valid_until,omitempty"`
+	QR            bool         `json:"qr,omitempty"`
+	linkMetadata
+
+	Targeting    []storage.TargetingRule `json:"targeting,omitempty"`
+	Destinations []storage.Destination   `json:"destinations,omitempty"`
 }
 
 type CreateShortURLBatchResp struct {
 	ShortURL      string `json:"short_url"`
 	CorrelationID string `json:"correlation_id"`
+	QR            string `json:"qr,omitempty"`
 }
 
 func (h *ShortURLHandler) CreateShortURLFromRawBody(w http.ResponseWriter, r *http.Request) {
@@ -57,6 +195,12 @@ func (h *ShortURLHandler) CreateShortURLFromRawBody(w http.ResponseWriter, r *ht
 		return
 	}
 
+	target, err := h.checkTarget(r.Context(), string(body))
+	if err != nil {
+		http.Error(w, err.Error(), targetStatus(err))
+		return
+	}
+
 	id, err := h.storage.Counters().Next(r.Context())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -65,9 +209,11 @@ func (h *ShortURLHandler) CreateShortURLFromRawBody(w http.ResponseWriter, r *ht
 
 	hash := shortener.Generate(id, 7)
 
-	if err := h.storage.ShortURLs().Save(r.Context(), hash, string(body)); err != nil {
+	userID, _ := auth.UserID(r.Context())
+
+	if err := h.storage.ShortURLs().Save(r.Context(), &storage.ShortURL{Hash: hash, Original: target, UserID: userID}); err != nil {
 		if errors.Is(err, storage.ErrConflict) {
-			if existingHash, err := h.storage.ShortURLs().GetByOriginal(r.Context(), string(body)); err == nil {
+			if existingHash, err := h.storage.ShortURLs().GetByOriginal(r.Context(), target); err == nil {
 				host := r.Host
 				shortURL := fmt.Sprintf("http://%s/%s", host, existingHash)
 
@@ -107,6 +253,58 @@ func (h *ShortURLHandler) CreateShortURLFromJSON(w http.ResponseWriter, r *http.
 		return
 	}
 
+	if shortURLReq.RedirectType != 0 && !IsRedirectType(shortURLReq.RedirectType) {
+		http.Error(w, "redirect_type must be one of 301, 302, 307, 308", http.StatusBadRequest)
+		return
+	}
+
+	if shortURLReq.MaxClicks < 0 {
+		http.Error(w, "max_clicks must not be negative", http.StatusBadRequest)
+		return
+	}
+
+	if err := checkSchedule(shortURLReq.ValidFrom, shortURLReq.ValidUntil); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	meta, err := shortURLReq.linkMetadata.check()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if err := h.checkCampaign(r.Context(), shortURLReq.Campaign); err != nil {
+		http.Error(w, err.Error(), targetStatus(err))
+		return
+	}
+
+	rules, err := h.checkTargeting(r.Context(), shortURLReq.Targeting)
+	if err != nil {
+		http.Error(w, err.Error(), targetStatus(err))
+		return
+	}
+
+	destinations, err := h.checkDestinations(r.Context(), shortURLReq.Destinations)
+	if err != nil {
+		http.Error(w, err.Error(), targetStatus(err))
+		return
+	}
+
+	target, err := h.checkTarget(r.Context(), shortURLReq.URL)
+	if err != nil {
+		http.Error(w, err.Error(), targetStatus(err))
+		return
+	}
+
+	var passwordHash string
+	if shortURLReq.Password != "" {
+		if passwordHash, err = hashPassword(shortURLReq.Password); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
 	id, err := h.storage.Counters().Next(r.Context())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -114,16 +312,42 @@ func (h *ShortURLHandler) CreateShortURLFromJSON(w http.ResponseWriter, r *http.
 	}
 
 	hash := shortener.Generate(id, 7)
-
-	if err := h.storage.ShortURLs().Save(r.Context(), hash, shortURLReq.URL); err != nil {
+	userID, _ := auth.UserID(r.Context())
+
+	link := &storage.ShortURL{
+		Hash:         hash,
+		Original:     target,
+		RedirectType: shortURLReq.RedirectType,
+		Passthrough:  shortURLReq.Passthrough,
+		UTM:          nonEmptyUTM(shortURLReq.UTM),
+		Campaign:     shortURLReq.Campaign,
+		Targeting:    rules,
+		Destinations: destinations,
+		PasswordHash: passwordHash,
+		MaxClicks:    shortURLReq.MaxClicks,
+		ValidFrom:    shortURLReq.ValidFrom,
+		ValidUntil:   shortURLReq.ValidUntil,
+		Title:        meta.Title,
+		Description:  meta.Description,
+		Notes:        meta.Notes,
+		Tags:         meta.Tags,
+		UserID:       userID,
+	}
+	if err := h.storage.ShortURLs().Save(r.Context(), link); err != nil {
 		if errors.Is(err, storage.ErrConflict) {
-			if existingHash, err := h.storage.ShortURLs().GetByOriginal(r.Context(), shortURLReq.URL); err == nil {
+			if existingHash, err := h.storage.ShortURLs().GetByOriginal(r.Context(), target); err == nil {
 				host := r.Host
 				shortURL := fmt.Sprintf("http://%s/%s", host, existingHash)
+				resp := CreateShortURLResp{ShortURL: shortURL}
+				if shortURLReq.QR {
+					if existing, err := h.storage.ShortURLs().Get(r.Context(), existingHash); err == nil {
+						resp.QR = h.qrURL(r, existing)
+					}
+				}
 
 				w.Header().Set("Content-Type", "application/json")
 				w.WriteHeader(http.StatusConflict)
-				_ = json.NewEncoder(w).Encode(CreateShortURLResp{ShortURL: shortURL})
+				_ = json.NewEncoder(w).Encode(resp)
 				return
 			}
 
@@ -136,22 +360,157 @@ func (h *ShortURLHandler) CreateShortURLFromJSON(w http.ResponseWriter, r *http.
 
 	host := r.Host
 	shortURL := fmt.Sprintf("http://%s/%s", host, hash)
+	resp := CreateShortURLResp{ShortURL: shortURL}
+	if shortURLReq.QR {
+		resp.QR = h.qrURL(r, link)
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
-	_ = json.NewEncoder(w).Encode(CreateShortURLResp{ShortURL: shortURL})
+	_ = json.NewEncoder(w).Encode(resp)
 }
 
+// GetShortURL serves both /{hash} and /{hash}/*. The path suffix and query
+// are only forwarded for links created with passthrough; for other links
+// /{hash}/qr is their QR code.
 func (h *ShortURLHandler) GetShortURL(w http.ResponseWriter, r *http.Request) {
+	if chi.URLParam(r, "*") == "qr" {
+		link, err := h.storage.ShortURLs().Get(r.Context(), chi.URLParam(r, "hash"))
+		if err == nil && !link.Passthrough {
+			o, err := parseQROptions(r)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			h.writeQRCode(w, r, link.Hash, o)
+			return
+		}
+	}
+
+	link, ok := h.loadLink(w, r)
+	if !ok {
+		return
+	}
+
+	if h.serveUnavailable(w, r, link) {
+		return
+	}
+
+	if link.PasswordHash != "" && !h.unlocked(r, link.Hash, link.PasswordHash) {
+		renderPasswordForm(w, r, http.StatusOK, "")
+		return
+	}
+
+	h.redirect(w, r, link, 0)
+}
+
+// loadLink fetches the link addressed by the request. Extra path segments
+// are only accepted for passthrough links.
+func (h *ShortURLHandler) loadLink(w http.ResponseWriter, r *http.Request) (*storage.ShortURL, bool) {
 	hash := chi.URLParam(r, "hash")
+	suffix := chi.URLParam(r, "*")
 
-	original, err := h.storage.ShortURLs().Get(r.Context(), hash)
+	link, err := h.storage.ShortURLs().Get(r.Context(), hash)
 	if err != nil {
 		http.Error(w, fmt.Sprintf("short url does not exist for %s", hash), http.StatusNotFound)
+		return nil, false
+	}
+
+	if suffix != "" && !link.Passthrough {
+		http.Error(w, fmt.Sprintf("short url does not exist for %s/%s", hash, suffix), http.StatusNotFound)
+		return nil, false
+	}
+	return link, true
+}
+
+// serveUnavailable answers for links that must not redirect right now and
+// reports whether it did.
+func (h *ShortURLHandler) serveUnavailable(w http.ResponseWriter, r *http.Request, link *storage.ShortURL) bool {
+	switch availability(link, time.Now()) {
+	case statusScheduled:
+		// Nothing may be cached: the link goes live at ValidFrom.
+		w.Header().Set("Cache-Control", "private, no-store")
+		if comingSoon := h.settings().comingSoon; comingSoon != "" {
+			http.Redirect(w, r, comingSoon, http.StatusFound)
+			return true
+		}
+		http.Error(w, fmt.Sprintf("short url does not exist for %s", link.Hash), http.StatusNotFound)
+		return true
+	case statusExpired:
+		http.Error(w, "short url has expired", http.StatusGone)
+		return true
+	case statusExhausted:
+		http.Error(w, errClickLimit, http.StatusGone)
+		return true
+	}
+	return false
+}
+
+// redirect sends the visitor to the link's destination for this request
+// and records the click. A zero status uses the link's redirect type.
+func (h *ShortURLHandler) redirect(w http.ResponseWriter, r *http.Request, link *storage.ShortURL, status int) {
+	now := time.Now()
+	ip := h.clientIP(r)
+	click := storage.Click{Hash: link.Hash, Country: h.country(ip), Time: now}
+
+	destination := link.Original
+	if d, ok := targeting.Match(link.Targeting, targeting.NewVisitor(r, click.Country, now)); ok {
+		destination = d
+	} else if d, ok := pickVariant(w, r, link, ip); ok {
+		destination = d
+		click.Variant = d
+	}
+
+	var err error
+	if link.Passthrough {
+		destination, err = passthroughURL(destination, chi.URLParam(r, "*"), r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	destination, err = withUTM(destination, h.linkUTM(r.Context(), link))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	http.Redirect(w, r, original, http.StatusTemporaryRedirect)
+	// The policy sees the URL the visitor is sent to, visitor's suffix and
+	// query included, so passthrough cannot reach what a deny rule blocks.
+	if policy := h.settings().policy; policy != nil {
+		if reason, disabled := policy.Disabled(destination); disabled {
+			http.Error(w, "short url is disabled: "+reason, http.StatusGone)
+			return
+		}
+	}
+
+	// The click is only counted once nothing else can fail, and the storage
+	// decides atomically whether it is still available.
+	if link.MaxClicks > 0 {
+		if _, err := h.storage.ShortURLs().Consume(r.Context(), link.Hash); err != nil {
+			if errors.Is(err, storage.ErrExhausted) {
+				http.Error(w, errClickLimit, http.StatusGone)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	h.recordClick(r.Context(), click)
+
+	if status == 0 {
+		status = h.redirectStatus(link.RedirectType)
+	}
+	cacheControl := redirectCacheControl(status)
+	if link.PasswordHash != "" || link.MaxClicks > 0 || link.ValidUntil != nil {
+		// A cached redirect would skip the password prompt, the click limit
+		// or the expiry.
+		cacheControl = "private, no-store"
+	}
+	w.Header().Set("Cache-Control", cacheControl)
+	http.Redirect(w, r, destination, status)
 }
 
 func (h *ShortURLHandler) CreateShortURLsBatch(w http.ResponseWriter, r *http.Request) {
@@ -169,13 +528,65 @@ func (h *ShortURLHandler) CreateShortURLsBatch(w http.ResponseWriter, r *http.Re
 		http.Error(w, "empty batch", http.StatusBadRequest)
 		return
 	}
+	passwordHashes := make([]string, len(req))
 	for i, item := range req {
 		if item.OrigURL == "" {
 			http.Error(w, fmt.Sprintf("item %d: original_url is required", i), http.StatusBadRequest)
 			return
 		}
+		if item.RedirectType != 0 && !IsRedirectType(item.RedirectType) {
+			http.Error(w, fmt.Sprintf("item %d: redirect_type must be one of 301, 302, 307, 308", i), http.StatusBadRequest)
+			return
+		}
+		if item.MaxClicks < 0 {
+			http.Error(w, fmt.Sprintf("item %d: max_clicks must not be negative", i), http.StatusBadRequest)
+			return
+		}
+		if err := checkSchedule(item.ValidFrom, item.ValidUntil); err != nil {
+			http.Error(w, fmt.Sprintf("item %d: %s", i, err), http.StatusBadRequest)
+			return
+		}
+		meta, err := item.linkMetadata.check()
+		if err != nil {
+			http.Error(w, fmt.Sprintf("item %d: %s", i, err), http.StatusBadRequest)
+			return
+		}
+		req[i].linkMetadata = meta
+		if err := h.checkCampaign(r.Context(), item.Campaign); err != nil {
+			http.Error(w, fmt.Sprintf("item %d: %s", i, err), targetStatus(err))
+			return
+		}
+		target, err := h.checkTarget(r.Context(), item.OrigURL)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("item %d: %s", i, err), targetStatus(err))
+			return
+		}
+		req[i].OrigURL = target
+
+		rules, err := h.checkTargeting(r.Context(), item.Targeting)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("item %d: %s", i, err), targetStatus(err))
+			return
+		}
+		req[i].Targeting = rules
+
+		destinations, err := h.checkDestinations(r.Context(), item.Destinations)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("item %d: %s", i, err), targetStatus(err))
+			return
+		}
+		req[i].Destinations = destinations
+
+		if item.Password != "" {
+			if passwordHashes[i], err = hashPassword(item.Password); err != nil {
+				http.Error(w, fmt.Sprintf("item %d: %s", i, err), http.StatusBadRequest)
+				return
+			}
+		}
 	}
 
+	userID, _ := auth.UserID(r.Context())
+
 	tx, err := h.storage.UnitOfWork().Begin(r.Context())
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -187,7 +598,7 @@ func (h *ShortURLHandler) CreateShortURLsBatch(w http.ResponseWriter, r *http.Re
 	counterRepo := h.storage.Counters().WithTx(tx)
 
 	var results []CreateShortURLBatchResp
-	for _, item := range req {
+	for i, item := range req {
 		id, err := counterRepo.Next(r.Context())
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -196,7 +607,26 @@ func (h *ShortURLHandler) CreateShortURLsBatch(w http.ResponseWriter, r *http.Re
 
 		hash := shortener.Generate(id, 7)
 
-		if err := shortURLRepo.Save(r.Context(), hash, item.OrigURL); err != nil {
+		link := &storage.ShortURL{
+			Hash:         hash,
+			Original:     item.OrigURL,
+			RedirectType: item.RedirectType,
+			Passthrough:  item.Passthrough,
+			UTM:          nonEmptyUTM(item.UTM),
+			Campaign:     item.Campaign,
+			Targeting:    item.Targeting,
+			Destinations: item.Destinations,
+			PasswordHash: passwordHashes[i],
+			MaxClicks:    item.MaxClicks,
+			ValidFrom:    item.ValidFrom,
+			ValidUntil:   item.ValidUntil,
+			Title:        item.Title,
+			Description:  item.Description,
+			Notes:        item.Notes,
+			Tags:         item.Tags,
+			UserID:       userID,
+		}
+		if err := shortURLRepo.Save(r.Context(), link); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -204,7 +634,11 @@ func (h *ShortURLHandler) CreateShortURLsBatch(w http.ResponseWriter, r *http.Re
 		host := r.Host
 		shortURL := fmt.Sprintf("http://%s/%s", host, hash)
 
-		results = append(results, CreateShortURLBatchResp{CorrelationID: item.CorrelationID, ShortURL: shortURL})
+		result := CreateShortURLBatchResp{CorrelationID: item.CorrelationID, ShortURL: shortURL}
+		if item.QR {
+			result.QR = h.qrURL(r, link)
+		}
+		results = append(results, result)
 	}
 	if err := tx.Commit(r.Context()); err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -4,35 +4,96 @@ import (
 	"context"
 	"encoding/json"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"slices"
 	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/mock"
 	"github.com/stretchr/testify/require"
+	"github.com/vlxdisluv/shortener/config"
+	"github.com/vlxdisluv/shortener/internal/app/auth"
+	"github.com/vlxdisluv/shortener/internal/app/middleware"
+	"github.com/vlxdisluv/shortener/internal/app/realip"
 	"github.com/vlxdisluv/shortener/internal/app/shortener"
 	"github.com/vlxdisluv/shortener/internal/app/storage"
 )
 
 type MockShortRepo struct{ mock.Mock }
 
-func (m *MockShortRepo) Save(ctx context.Context, hash, original string) error {
-	args := m.Called(ctx, hash, original)
+func (m *MockShortRepo) Save(ctx context.Context, u *storage.ShortURL) error {
+	args := m.Called(ctx, u.Hash, u.Original)
 	return args.Error(0)
 }
-func (m *MockShortRepo) Get(ctx context.Context, hash string) (string, error) {
+func (m *MockShortRepo) Get(ctx context.Context, hash string) (*storage.ShortURL, error) {
 	args := m.Called(ctx, hash)
-	return args.String(0), args.Error(1)
+	u, _ := args.Get(0).(*storage.ShortURL)
+	return u, args.Error(1)
+}
+func (m *MockShortRepo) Update(ctx context.Context, u *storage.ShortURL) error {
+	args := m.Called(ctx, u)
+	return args.Error(0)
+}
+func (m *MockShortRepo) List(ctx context.Context, q storage.ListQuery) ([]storage.ShortURL, error) {
+	args := m.Called(ctx, q)
+	links, _ := args.Get(0).([]storage.ShortURL)
+	return links, args.Error(1)
+}
+
+func (m *MockShortRepo) Count(ctx context.Context, q storage.ListQuery) (int64, error) {
+	args := m.Called(ctx, q)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockShortRepo) CountAll(ctx context.Context) (int64, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockShortRepo) CountUsers(ctx context.Context) (int64, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(int64), args.Error(1)
+}
+
+func (m *MockShortRepo) ListByUser(ctx context.Context, userID string, f storage.LinkFilter) ([]storage.ShortURL, error) {
+	args := m.Called(ctx, userID, f)
+	links, _ := args.Get(0).([]storage.ShortURL)
+	return links, args.Error(1)
+}
+
+func (m *MockShortRepo) Consume(ctx context.Context, hash string) (int, error) {
+	args := m.Called(ctx, hash)
+	return args.Int(0), args.Error(1)
 }
+
 func (m *MockShortRepo) GetByOriginal(ctx context.Context, url string) (string, error) {
 	args := m.Called(ctx, url)
 	return args.String(0), args.Error(1)
 }
 
 func (m *MockShortRepo) Close() error                                   { return nil }
+func (m *MockShortRepo) Delete(ctx context.Context, hash string) error {
+	args := m.Called(ctx, hash)
+	return args.Error(0)
+}
+
+func (m *MockShortRepo) Each(ctx context.Context, fn func(*storage.ShortURL) error) error {
+	args := m.Called(ctx)
+	for _, u := range args.Get(0).([]storage.ShortURL) {
+		if err := fn(&u); err != nil {
+			return err
+		}
+	}
+	return args.Error(1)
+}
+
 func (m *MockShortRepo) WithTx(_ storage.Tx) storage.ShortURLRepository { return m }
 
 type MockCounterRepo struct{ mock.Mock }
@@ -42,18 +103,155 @@ func (m *MockCounterRepo) Next(ctx context.Context) (uint64, error) {
 	return args.Get(0).(uint64), args.Error(1)
 }
 
+func (m *MockCounterRepo) Current(ctx context.Context) (uint64, error) {
+	args := m.Called(ctx)
+	return args.Get(0).(uint64), args.Error(1)
+}
+
+func (m *MockCounterRepo) AtLeast(ctx context.Context, value uint64) error {
+	args := m.Called(ctx, value)
+	return args.Error(0)
+}
+
 func (m *MockCounterRepo) Close() error                                  { return nil }
 func (m *MockCounterRepo) WithTx(_ storage.Tx) storage.CounterRepository { return m }
 
+type MockCampaignRepo struct{ mock.Mock }
+
+func (m *MockCampaignRepo) Create(ctx context.Context, c *storage.Campaign) error {
+	return m.Called(ctx, c).Error(0)
+}
+func (m *MockCampaignRepo) Update(ctx context.Context, c *storage.Campaign) error {
+	return m.Called(ctx, c).Error(0)
+}
+func (m *MockCampaignRepo) Get(ctx context.Context, name string) (*storage.Campaign, error) {
+	args := m.Called(ctx, name)
+	c, _ := args.Get(0).(*storage.Campaign)
+	return c, args.Error(1)
+}
+func (m *MockCampaignRepo) List(ctx context.Context) ([]storage.Campaign, error) {
+	args := m.Called(ctx)
+	campaigns, _ := args.Get(0).([]storage.Campaign)
+	return campaigns, args.Error(1)
+}
+func (m *MockCampaignRepo) Delete(ctx context.Context, name string) error {
+	return m.Called(ctx, name).Error(0)
+}
+
+func (m *MockCampaignRepo) Close() error { return nil }
+
+type MockClickRepo struct{ mock.Mock }
+
+func (m *MockClickRepo) Record(ctx context.Context, c storage.Click) error {
+	return m.Called(ctx, c.Hash, c.Variant).Error(0)
+}
+func (m *MockClickRepo) Stats(ctx context.Context, hash string) (*storage.LinkStats, error) {
+	args := m.Called(ctx, hash)
+	s, _ := args.Get(0).(*storage.LinkStats)
+	return s, args.Error(1)
+}
+func (m *MockClickRepo) CountSince(ctx context.Context, since time.Time) (int64, error) {
+	args := m.Called(ctx, since)
+	return args.Get(0).(int64), args.Error(1)
+}
+func (m *MockClickRepo) Each(ctx context.Context, fn func(storage.Click) error) error {
+	return m.Called(ctx).Error(0)
+}
+
+func (m *MockClickRepo) Close() error { return nil }
+
+// nopClickRepo is used by tests that do not care about click recording.
+type nopClickRepo struct{}
+
+func (nopClickRepo) Record(context.Context, storage.Click) error { return nil }
+func (nopClickRepo) Stats(context.Context, string) (*storage.LinkStats, error) {
+	return &storage.LinkStats{}, nil
+}
+func (nopClickRepo) CountSince(context.Context, time.Time) (int64, error)     { return 0, nil }
+func (nopClickRepo) Each(context.Context, func(storage.Click) error) error { return nil }
+func (nopClickRepo) Close() error                                           { return nil }
+
+type MockRevisionRepo struct{ mock.Mock }
+
+func (m *MockRevisionRepo) Record(ctx context.Context, rev *storage.Revision) error {
+	return m.Called(ctx, rev).Error(0)
+}
+func (m *MockRevisionRepo) List(ctx context.Context, hash string) ([]storage.Revision, error) {
+	args := m.Called(ctx, hash)
+	revisions, _ := args.Get(0).([]storage.Revision)
+	return revisions, args.Error(1)
+}
+func (m *MockRevisionRepo) Get(ctx context.Context, hash string, id int64) (*storage.Revision, error) {
+	args := m.Called(ctx, hash, id)
+	rev, _ := args.Get(0).(*storage.Revision)
+	return rev, args.Error(1)
+}
+func (m *MockRevisionRepo) Each(ctx context.Context, fn func(*storage.Revision) error) error {
+	return m.Called(ctx).Error(0)
+}
+func (m *MockRevisionRepo) Restore(ctx context.Context, rev *storage.Revision) error {
+	return m.Called(ctx, rev).Error(0)
+}
+func (m *MockRevisionRepo) Close() error                                   { return nil }
+func (m *MockRevisionRepo) WithTx(_ storage.Tx) storage.RevisionRepository { return m }
+
+// nopRevisionRepo is used by tests that do not care about link history.
+type nopRevisionRepo struct{}
+
+func (nopRevisionRepo) Record(context.Context, *storage.Revision) error { return nil }
+func (nopRevisionRepo) List(context.Context, string) ([]storage.Revision, error) {
+	return nil, nil
+}
+func (nopRevisionRepo) Get(context.Context, string, int64) (*storage.Revision, error) {
+	return nil, storage.ErrNotFound
+}
+func (nopRevisionRepo) Each(context.Context, func(*storage.Revision) error) error { return nil }
+func (nopRevisionRepo) Restore(context.Context, *storage.Revision) error        { return nil }
+func (nopRevisionRepo) Close() error                                     { return nil }
+func (r nopRevisionRepo) WithTx(_ storage.Tx) storage.RevisionRepository { return r }
+
+type nopTx struct{}
+
+func (nopTx) Commit(context.Context) error   { return nil }
+func (nopTx) Rollback(context.Context) error { return nil }
+
+type nopUnitOfWork struct{}
+
+func (nopUnitOfWork) Begin(context.Context) (storage.Tx, error) { return nopTx{}, nil }
+
 type MockStorage struct {
-	short   storage.ShortURLRepository
-	counter storage.CounterRepository
-	uow     storage.UnitOfWork
+	short     storage.ShortURLRepository
+	counter   storage.CounterRepository
+	campaigns storage.CampaignRepository
+	clicks    storage.ClickRepository
+	revisions storage.RevisionRepository
+	uow       storage.UnitOfWork
+}
+
+func (m *MockStorage) Revisions() storage.RevisionRepository {
+	if m.revisions == nil {
+		return nopRevisionRepo{}
+	}
+	return m.revisions
+}
+
+func (m *MockStorage) Clicks() storage.ClickRepository {
+	if m.clicks == nil {
+		return nopClickRepo{}
+	}
+	return m.clicks
 }
 
 func (m *MockStorage) ShortURLs() storage.ShortURLRepository { return m.short }
 func (m *MockStorage) Counters() storage.CounterRepository   { return m.counter }
-func (m *MockStorage) UnitOfWork() storage.UnitOfWork        { return m.uow }
+func (m *MockStorage) Campaigns() storage.CampaignRepository { return m.campaigns }
+
+func (m *MockStorage) UnitOfWork() storage.UnitOfWork {
+	if m.uow == nil {
+		return nopUnitOfWork{}
+	}
+	return m.uow
+}
 
 func TestGetShortURL(t *testing.T) {
 	type want struct {
@@ -97,9 +295,14 @@ func TestGetShortURL(t *testing.T) {
 			ms := &MockStorage{short: mockShort, counter: mockCounter}
 			handler := NewShortURLHandler(ms)
 
+			var link *storage.ShortURL
+			if tt.mockReturnErr == nil {
+				link = &storage.ShortURL{Hash: tt.hash, Original: tt.mockReturnURL}
+			}
+
 			mockShort.
 				On("Get", mock.Anything, tt.hash).
-				Return(tt.mockReturnURL, tt.mockReturnErr).
+				Return(link, tt.mockReturnErr).
 				Once()
 
 			req := httptest.NewRequest(http.MethodGet, "/"+tt.hash, nil)
@@ -312,3 +515,1251 @@ func TestCreateShortURLFromJSON(t *testing.T) {
 		})
 	}
 }
+
+type stubPolicy struct {
+	blocked map[string]string
+}
+
+func (p stubPolicy) Allow(rawURL string) (string, bool) {
+	reason, blocked := p.blocked[rawURL]
+	return reason, !blocked
+}
+
+func (p stubPolicy) Disabled(rawURL string) (string, bool) {
+	reason, blocked := p.blocked[rawURL]
+	return reason, blocked
+}
+
+func TestURLPolicy(t *testing.T) {
+	pol := stubPolicy{blocked: map[string]string{"http://evil.example": "target is blocked"}}
+
+	t.Run("create blocked url #1", func(t *testing.T) {
+		mockShort := &MockShortRepo{}
+		mockCounter := &MockCounterRepo{}
+		handler := NewShortURLHandler(&MockStorage{short: mockShort, counter: mockCounter}, WithURLPolicy(pol))
+
+		req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader("http://evil.example"))
+		w := httptest.NewRecorder()
+		handler.CreateShortURLFromRawBody(w, req)
+
+		result := w.Result()
+		defer result.Body.Close()
+
+		assert.Equal(t, http.StatusUnprocessableEntity, result.StatusCode)
+		data, _ := io.ReadAll(result.Body)
+		assert.Contains(t, string(data), "target is blocked")
+
+		mockShort.AssertExpectations(t)
+		mockCounter.AssertExpectations(t)
+	})
+
+	t.Run("redirect to retroactively blocked url #2", func(t *testing.T) {
+		mockShort := &MockShortRepo{}
+		handler := NewShortURLHandler(&MockStorage{short: mockShort}, WithURLPolicy(pol))
+
+		mockShort.On("Get", mock.Anything, "EwHXdJfB").Return(&storage.ShortURL{Hash: "EwHXdJfB", Original: "http://evil.example"}, nil).Once()
+
+		req := httptest.NewRequest(http.MethodGet, "/EwHXdJfB", nil)
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("hash", "EwHXdJfB")
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+		w := httptest.NewRecorder()
+		handler.GetShortURL(w, req)
+
+		result := w.Result()
+		defer result.Body.Close()
+
+		assert.Equal(t, http.StatusGone, result.StatusCode)
+		mockShort.AssertExpectations(t)
+	})
+}
+
+func TestCreateShortURLToOwnDomain(t *testing.T) {
+	tests := []struct {
+		name        string
+		target      string
+		chain       map[string]string
+		passthrough []string
+		wantStatus  int
+		wantSaved   string
+	}{
+		{
+			name:       "chain is collapsed to final destination #1",
+			target:     "http://sho.rt/AAAAAAA",
+			chain:      map[string]string{"AAAAAAA": "http://localhost:8080/BBBBBBB", "BBBBBBB": "http://google.com"},
+			wantStatus: http.StatusCreated,
+			wantSaved:  "http://google.com",
+		},
+		{
+			name:       "loop is rejected #2",
+			target:     "http://localhost:8080/AAAAAAA",
+			chain:      map[string]string{"AAAAAAA": "http://sho.rt/BBBBBBB", "BBBBBBB": "http://localhost:8080/AAAAAAA"},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "unknown own short link is rejected #3",
+			target:     "http://localhost:8080/CCCCCCC",
+			chain:      map[string]string{},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+		{
+			name:        "passthrough link with suffix is resolved #4",
+			target:      "http://sho.rt/PPPPPPP/guide/page?id=1",
+			chain:       map[string]string{"PPPPPPP": "https://example.com/docs"},
+			passthrough: []string{"PPPPPPP"},
+			wantStatus:  http.StatusCreated,
+			wantSaved:   "https://example.com/docs/guide/page?id=1",
+		},
+		{
+			name:        "suffix carried into the next passthrough link #5",
+			target:      "http://sho.rt/AAAAAAA/guide?id=1",
+			chain:       map[string]string{"AAAAAAA": "http://localhost:8080/PPPPPPP/v2", "PPPPPPP": "https://example.com/docs"},
+			passthrough: []string{"AAAAAAA", "PPPPPPP"},
+			wantStatus:  http.StatusCreated,
+			wantSaved:   "https://example.com/docs/v2/guide?id=1",
+		},
+		{
+			name:        "passthrough loop with suffix is rejected #6",
+			target:      "http://localhost:8080/PPPPPPP/x",
+			chain:       map[string]string{"PPPPPPP": "http://sho.rt/PPPPPPP"},
+			passthrough: []string{"PPPPPPP"},
+			wantStatus:  http.StatusUnprocessableEntity,
+		},
+		{
+			name:       "suffix on a plain link is not resolved #7",
+			target:     "http://localhost:8080/AAAAAAA/x",
+			chain:      map[string]string{"AAAAAAA": "http://google.com"},
+			wantStatus: http.StatusCreated,
+			wantSaved:  "http://localhost:8080/AAAAAAA/x",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockShort := &MockShortRepo{}
+			mockCounter := &MockCounterRepo{}
+			handler := NewShortURLHandler(
+				&MockStorage{short: mockShort, counter: mockCounter},
+				WithOwnDomains("http://localhost:8080", []string{"sho.rt"}),
+			)
+
+			for hash, target := range tt.chain {
+				link := &storage.ShortURL{Hash: hash, Original: target, Passthrough: slices.Contains(tt.passthrough, hash)}
+				mockShort.On("Get", mock.Anything, hash).Return(link, nil).Maybe()
+			}
+			mockShort.On("Get", mock.Anything, mock.Anything).Return(nil, storage.ErrNotFound).Maybe()
+
+			if tt.wantSaved != "" {
+				mockCounter.On("Next", mock.Anything).Return(uint64(2), nil).Once()
+				mockShort.On("Save", mock.Anything, shortener.Generate(2, 7), tt.wantSaved).Return(nil).Once()
+			}
+
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.target))
+			w := httptest.NewRecorder()
+			handler.CreateShortURLFromRawBody(w, req)
+
+			result := w.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, result.StatusCode)
+			mockShort.AssertExpectations(t)
+			mockCounter.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetShortURLRedirectType(t *testing.T) {
+	tests := []struct {
+		name         string
+		linkType     int
+		defaultType  int
+		wantStatus   int
+		cacheControl string
+	}{
+		{name: "built-in default #1", wantStatus: http.StatusTemporaryRedirect, cacheControl: "private, no-cache"},
+		{name: "global default #2", defaultType: http.StatusPermanentRedirect, wantStatus: http.StatusPermanentRedirect, cacheControl: "public, max-age=86400"},
+		{name: "permanent link #3", linkType: http.StatusMovedPermanently, defaultType: http.StatusFound, wantStatus: http.StatusMovedPermanently, cacheControl: "public, max-age=86400"},
+		{name: "tracked link #4", linkType: http.StatusFound, wantStatus: http.StatusFound, cacheControl: "private, no-store"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockShort := &MockShortRepo{}
+			handler := NewShortURLHandler(&MockStorage{short: mockShort}, WithDefaultRedirectType(tt.defaultType))
+
+			mockShort.On("Get", mock.Anything, "EwHXdJfB").
+				Return(&storage.ShortURL{Hash: "EwHXdJfB", Original: "http://google.com", RedirectType: tt.linkType}, nil).
+				Once()
+
+			req := httptest.NewRequest(http.MethodGet, "/EwHXdJfB", nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("hash", "EwHXdJfB")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			w := httptest.NewRecorder()
+			handler.GetShortURL(w, req)
+
+			result := w.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, result.StatusCode)
+			assert.Equal(t, tt.cacheControl, result.Header.Get("Cache-Control"))
+			assert.Equal(t, "http://google.com", result.Header.Get("Location"))
+		})
+	}
+}
+
+func TestPassthroughURL(t *testing.T) {
+	tests := []struct {
+		name   string
+		target string
+		suffix string
+		query  string
+		want   string
+		err    error
+	}{
+		{name: "query appended #1", target: "https://example.com/landing", query: "utm_source=mail", want: "https://example.com/landing?utm_source=mail"},
+		{name: "target params win #2", target: "https://example.com/?ref=partner&b=1", query: "ref=visitor&c=2", want: "https://example.com/?ref=partner&b=1&c=2"},
+		{name: "path suffix appended #3", target: "https://example.com/docs/", suffix: "guide/page", want: "https://example.com/docs/guide/page"},
+		{name: "dot segments rejected #4", target: "https://example.com/docs", suffix: "../../etc", err: errPassthroughPath},
+		{name: "protocol-relative suffix keeps host #5", target: "https://example.com", suffix: "/evil.example/x", want: "https://example.com/evil.example/x"},
+		{name: "at-sign suffix keeps host #6", target: "https://example.com", suffix: "@evil.example", want: "https://example.com/@evil.example"},
+		{name: "escaped dot segments rejected #7", target: "https://example.com/docs/", suffix: "a/%2e%2e/%2E%2E/etc", err: errPassthroughPath},
+		{name: "single dots are cleaned #8", target: "https://example.com/docs/", suffix: "./a/./b", want: "https://example.com/docs/a/b"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := url.ParseQuery(tt.query)
+			require.NoError(t, err)
+
+			got, err := passthroughURL(tt.target, tt.suffix, query)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestGetShortURLPassthrough(t *testing.T) {
+	tests := []struct {
+		name        string
+		passthrough bool
+		wantStatus  int
+		wantLoc     string
+	}{
+		{name: "passthrough link #1", passthrough: true, wantStatus: http.StatusTemporaryRedirect, wantLoc: "https://example.com/docs/page?utm_source=mail"},
+		{name: "plain link rejects suffix #2", passthrough: false, wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockShort := &MockShortRepo{}
+			handler := NewShortURLHandler(&MockStorage{short: mockShort})
+
+			mockShort.On("Get", mock.Anything, "EwHXdJfB").
+				Return(&storage.ShortURL{Hash: "EwHXdJfB", Original: "https://example.com/docs", Passthrough: tt.passthrough}, nil).
+				Once()
+
+			r := chi.NewRouter()
+			r.Get("/{hash}/*", handler.GetShortURL)
+
+			req := httptest.NewRequest(http.MethodGet, "/EwHXdJfB/page?utm_source=mail", nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			result := w.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, result.StatusCode)
+			assert.Equal(t, tt.wantLoc, result.Header.Get("Location"))
+			mockShort.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetShortURLPassthroughPolicy(t *testing.T) {
+	pol := stubPolicy{blocked: map[string]string{"https://example.com/docs/admin": "target is blocked"}}
+	mockShort := &MockShortRepo{}
+	handler := NewShortURLHandler(&MockStorage{short: mockShort}, WithURLPolicy(pol))
+
+	mockShort.On("Get", mock.Anything, "EwHXdJfB").
+		Return(&storage.ShortURL{Hash: "EwHXdJfB", Original: "https://example.com/docs", Passthrough: true}, nil).
+		Once()
+
+	r := chi.NewRouter()
+	r.Get("/{hash}/*", handler.GetShortURL)
+
+	req := httptest.NewRequest(http.MethodGet, "/EwHXdJfB/admin", nil)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	result := w.Result()
+	defer result.Body.Close()
+
+	assert.Equal(t, http.StatusGone, result.StatusCode)
+	assert.Empty(t, result.Header.Get("Location"))
+	mockShort.AssertExpectations(t)
+}
+
+func TestGetShortURLWithUTM(t *testing.T) {
+	mockShort := &MockShortRepo{}
+	mockCampaigns := &MockCampaignRepo{}
+	handler := NewShortURLHandler(&MockStorage{short: mockShort, campaigns: mockCampaigns})
+
+	mockShort.On("Get", mock.Anything, "EwHXdJfB").
+		Return(&storage.ShortURL{
+			Hash:     "EwHXdJfB",
+			Original: "https://example.com/?utm_source=old&id=7&q=a+b",
+			UTM:      &storage.UTM{Content: "banner"},
+			Campaign: "spring",
+		}, nil).
+		Once()
+	mockCampaigns.On("Get", mock.Anything, "spring").
+		Return(&storage.Campaign{Name: "spring", UTM: storage.UTM{Source: "mail", Medium: "email", Content: "text"}}, nil).
+		Once()
+
+	req := httptest.NewRequest(http.MethodGet, "/EwHXdJfB", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("hash", "EwHXdJfB")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	w := httptest.NewRecorder()
+	handler.GetShortURL(w, req)
+
+	result := w.Result()
+	defer result.Body.Close()
+
+	assert.Equal(t, http.StatusTemporaryRedirect, result.StatusCode)
+	assert.Equal(t, "https://example.com/?utm_source=old&id=7&q=a+b&utm_medium=email&utm_content=banner", result.Header.Get("Location"))
+	mockShort.AssertExpectations(t)
+	mockCampaigns.AssertExpectations(t)
+}
+
+func TestUpdateTargeting(t *testing.T) {
+	rules := `[{"destination":"https://apps.apple.com/app/1","os":["ios"]},{"destination":"https://example.com/de","languages":["de"]}]`
+
+	tests := []struct {
+		name       string
+		owner      string
+		caller     string
+		body       string
+		wantStatus int
+	}{
+		{name: "owner replaces rules #1", owner: "u1", caller: "u1", body: rules, wantStatus: http.StatusOK},
+		{name: "other user is forbidden #2", owner: "u1", caller: "u2", body: rules, wantStatus: http.StatusForbidden},
+		{name: "anonymous link is forbidden #3", owner: "", caller: "u1", body: rules, wantStatus: http.StatusForbidden},
+		{name: "unknown os is rejected #4", owner: "u1", caller: "u1", body: `[{"destination":"https://example.com","os":["beos"]}]`, wantStatus: http.StatusUnprocessableEntity},
+		{name: "rule without conditions is rejected #5", owner: "u1", caller: "u1", body: `[{"destination":"https://example.com"}]`, wantStatus: http.StatusUnprocessableEntity},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockShort := &MockShortRepo{}
+			handler := NewShortURLHandler(&MockStorage{short: mockShort})
+
+			mockShort.On("Get", mock.Anything, "EwHXdJfB").
+				Return(&storage.ShortURL{Hash: "EwHXdJfB", Original: "https://example.com", UserID: tt.owner}, nil).
+				Once()
+			if tt.wantStatus == http.StatusOK {
+				mockShort.On("Update", mock.Anything, mock.MatchedBy(func(u *storage.ShortURL) bool {
+					return len(u.Targeting) == 2 && u.Targeting[0].OS[0] == "ios"
+				})).Return(nil).Once()
+			}
+
+			req := httptest.NewRequest(http.MethodPut, "/api/urls/EwHXdJfB/targeting", strings.NewReader(tt.body))
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("hash", "EwHXdJfB")
+			ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+			req = req.WithContext(auth.WithUserID(ctx, tt.caller))
+
+			w := httptest.NewRecorder()
+			handler.UpdateTargeting(w, req)
+
+			result := w.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, result.StatusCode)
+			mockShort.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetShortURLRotation(t *testing.T) {
+	link := &storage.ShortURL{
+		Hash:     "EwHXdJfB",
+		Original: "https://example.com",
+		Destinations: []storage.Destination{
+			{URL: "https://example.com/a", Weight: 1},
+			{URL: "https://example.com/b", Weight: 1},
+		},
+	}
+
+	serve := func(cookie *http.Cookie, wantVariant string) *http.Response {
+		mockShort := &MockShortRepo{}
+		mockClicks := &MockClickRepo{}
+		handler := NewShortURLHandler(&MockStorage{short: mockShort, clicks: mockClicks})
+
+		mockShort.On("Get", mock.Anything, "EwHXdJfB").Return(link, nil).Once()
+		mockClicks.On("Record", mock.Anything, "EwHXdJfB", wantVariant).Return(nil).Once()
+
+		req := httptest.NewRequest(http.MethodGet, "/EwHXdJfB", nil)
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rctx := chi.NewRouteContext()
+		rctx.URLParams.Add("hash", "EwHXdJfB")
+		req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+		w := httptest.NewRecorder()
+		handler.GetShortURL(w, req)
+
+		mockClicks.AssertExpectations(t)
+		return w.Result()
+	}
+
+	result := serve(&http.Cookie{Name: "v_EwHXdJfB", Value: variantKey("https://example.com/b")}, "https://example.com/b")
+	defer result.Body.Close()
+	assert.Equal(t, "https://example.com/b", result.Header.Get("Location"), "variant from cookie must be kept")
+
+	result = serve(&http.Cookie{Name: "v_EwHXdJfB", Value: variantKey("https://example.com/a")}, "https://example.com/a")
+	defer result.Body.Close()
+	assert.Equal(t, "https://example.com/a", result.Header.Get("Location"))
+
+	// An edit that puts a new destination first must not move the visitor.
+	link.Destinations = []storage.Destination{
+		{URL: "https://example.com/c", Weight: 1},
+		{URL: "https://example.com/a", Weight: 1},
+		{URL: "https://example.com/b", Weight: 1},
+	}
+	result = serve(&http.Cookie{Name: "v_EwHXdJfB", Value: variantKey("https://example.com/b")}, "https://example.com/b")
+	defer result.Body.Close()
+	assert.Equal(t, "https://example.com/b", result.Header.Get("Location"), "variant must survive reordering")
+	assert.Empty(t, result.Cookies())
+
+	// A removed variant gets the visitor a fresh pick and a new cookie.
+	link.Destinations = link.Destinations[:1]
+	result = serve(&http.Cookie{Name: "v_EwHXdJfB", Value: variantKey("https://example.com/b")}, "https://example.com/c")
+	defer result.Body.Close()
+	assert.Equal(t, "https://example.com/c", result.Header.Get("Location"))
+	require.Len(t, result.Cookies(), 1)
+	assert.Equal(t, variantKey("https://example.com/c"), result.Cookies()[0].Value)
+}
+
+func TestPasswordProtectedShortURL(t *testing.T) {
+	passwordHash, err := hashPassword("s3cret")
+	require.NoError(t, err)
+	link := &storage.ShortURL{Hash: "EwHXdJfB", Original: "https://example.com/doc", PasswordHash: passwordHash}
+
+	mockShort := &MockShortRepo{}
+	mockShort.On("Get", mock.Anything, "EwHXdJfB").Return(link, nil)
+	handler := NewShortURLHandler(&MockStorage{short: mockShort}, WithSigner(auth.NewSigner("test-secret")))
+
+	r := chi.NewRouter()
+	r.Get("/{hash}", handler.GetShortURL)
+	r.Post("/{hash}", handler.UnlockShortURL)
+
+	serve := func(method, password string, cookie *http.Cookie) *http.Response {
+		var body io.Reader
+		if method == http.MethodPost {
+			body = strings.NewReader(url.Values{"password": {password}}.Encode())
+		}
+		req := httptest.NewRequest(method, "/EwHXdJfB", body)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		}
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Result()
+	}
+
+	result := serve(http.MethodGet, "", nil)
+	defer result.Body.Close()
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Contains(t, result.Header.Get("Content-Type"), "text/html")
+	assert.Empty(t, result.Header.Get("Location"))
+
+	result = serve(http.MethodPost, "wrong", nil)
+	defer result.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, result.StatusCode)
+
+	result = serve(http.MethodPost, "s3cret", nil)
+	defer result.Body.Close()
+	assert.Equal(t, http.StatusSeeOther, result.StatusCode)
+	assert.Equal(t, "https://example.com/doc", result.Header.Get("Location"))
+	require.Len(t, result.Cookies(), 1)
+	unlock := result.Cookies()[0]
+
+	result = serve(http.MethodGet, "", unlock)
+	defer result.Body.Close()
+	assert.Equal(t, http.StatusTemporaryRedirect, result.StatusCode, "unlock cookie must skip the prompt")
+	assert.Equal(t, "private, no-store", result.Header.Get("Cache-Control"))
+
+	for i := 0; i <= passwordMaxAttempts; i++ {
+		result = serve(http.MethodPost, "wrong", nil)
+		result.Body.Close()
+	}
+	assert.Equal(t, http.StatusTooManyRequests, result.StatusCode)
+	assert.NotEmpty(t, result.Header.Get("Retry-After"))
+}
+
+func TestUnlockShortURLConcurrentGuesses(t *testing.T) {
+	passwordHash, err := hashPassword("s3cret")
+	require.NoError(t, err)
+	link := &storage.ShortURL{Hash: "EwHXdJfB", Original: "https://example.com/doc", PasswordHash: passwordHash}
+
+	mockShort := &MockShortRepo{}
+	mockShort.On("Get", mock.Anything, "EwHXdJfB").Return(link, nil)
+	handler := NewShortURLHandler(&MockStorage{short: mockShort})
+
+	r := chi.NewRouter()
+	r.Post("/{hash}", handler.UnlockShortURL)
+
+	// Every request that gets past the throttle is compared with bcrypt and
+	// answered 401, the others are answered 429 without a compare.
+	const guesses = 50
+	statuses := make(chan int, guesses)
+	var wg sync.WaitGroup
+	for i := 0; i < guesses; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req := httptest.NewRequest(http.MethodPost, "/EwHXdJfB", strings.NewReader("password=wrong"))
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+			statuses <- w.Code
+		}()
+	}
+	wg.Wait()
+	close(statuses)
+
+	compared := 0
+	for status := range statuses {
+		if status == http.StatusUnauthorized {
+			compared++
+		} else {
+			assert.Equal(t, http.StatusTooManyRequests, status)
+		}
+	}
+	assert.Equal(t, passwordMaxAttempts, compared)
+}
+
+func TestReconfigureKeepsPasswordAttempts(t *testing.T) {
+	passwordHash, err := hashPassword("s3cret")
+	require.NoError(t, err)
+	link := &storage.ShortURL{Hash: "EwHXdJfB", Original: "https://example.com/doc", PasswordHash: passwordHash}
+
+	mockShort := &MockShortRepo{}
+	mockShort.On("Get", mock.Anything, "EwHXdJfB").Return(link, nil)
+	handler := NewShortURLHandler(&MockStorage{short: mockShort}, WithPasswordThrottle(2, time.Hour))
+
+	r := chi.NewRouter()
+	r.Post("/{hash}", handler.UnlockShortURL)
+	guess := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/EwHXdJfB", strings.NewReader("password=wrong"))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusUnauthorized, guess())
+	assert.Equal(t, http.StatusUnauthorized, guess())
+	assert.Equal(t, http.StatusTooManyRequests, guess())
+
+	handler.Reconfigure(WithBaseURL("https://sho.rt"), WithPasswordThrottle(2, time.Hour))
+	assert.Equal(t, http.StatusTooManyRequests, guess(), "a reload must not reset the attempts")
+
+	handler.Reconfigure(WithPasswordThrottle(3, time.Hour))
+	assert.Equal(t, http.StatusUnauthorized, guess(), "new limits start counting afresh")
+}
+
+func TestGetShortURLClickLimit(t *testing.T) {
+	tests := []struct {
+		name       string
+		link       storage.ShortURL
+		consumeErr error
+		wantStatus int
+	}{
+		{name: "click left #1", link: storage.ShortURL{MaxClicks: 1}, wantStatus: http.StatusTemporaryRedirect},
+		{name: "used up before the request #2", link: storage.ShortURL{MaxClicks: 1, Uses: 1}, wantStatus: http.StatusGone},
+		{name: "used up by a concurrent request #3", link: storage.ShortURL{MaxClicks: 1}, consumeErr: storage.ErrExhausted, wantStatus: http.StatusGone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockShort := &MockShortRepo{}
+			handler := NewShortURLHandler(&MockStorage{short: mockShort})
+
+			link := tt.link
+			link.Hash, link.Original = "EwHXdJfB", "https://example.com/file.zip"
+			mockShort.On("Get", mock.Anything, "EwHXdJfB").Return(&link, nil).Once()
+			if link.Uses < link.MaxClicks {
+				mockShort.On("Consume", mock.Anything, "EwHXdJfB").Return(0, tt.consumeErr).Once()
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/EwHXdJfB", nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("hash", "EwHXdJfB")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			w := httptest.NewRecorder()
+			handler.GetShortURL(w, req)
+
+			result := w.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, result.StatusCode)
+			mockShort.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetShortURLSchedule(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+	future := time.Now().Add(time.Hour)
+
+	tests := []struct {
+		name       string
+		from       *time.Time
+		until      *time.Time
+		comingSoon string
+		wantStatus int
+		wantLoc    string
+	}{
+		{name: "inside the window #1", from: &past, until: &future, wantStatus: http.StatusTemporaryRedirect, wantLoc: "https://example.com/launch"},
+		{name: "not active yet #2", from: &future, wantStatus: http.StatusNotFound},
+		{name: "not active yet with coming soon page #3", from: &future, comingSoon: "https://example.com/soon", wantStatus: http.StatusFound, wantLoc: "https://example.com/soon"},
+		{name: "expired #4", until: &past, wantStatus: http.StatusGone},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockShort := &MockShortRepo{}
+			handler := NewShortURLHandler(&MockStorage{short: mockShort}, WithComingSoonURL(tt.comingSoon))
+
+			mockShort.On("Get", mock.Anything, "EwHXdJfB").
+				Return(&storage.ShortURL{Hash: "EwHXdJfB", Original: "https://example.com/launch", ValidFrom: tt.from, ValidUntil: tt.until}, nil).
+				Once()
+
+			req := httptest.NewRequest(http.MethodGet, "/EwHXdJfB", nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("hash", "EwHXdJfB")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			w := httptest.NewRecorder()
+			handler.GetShortURL(w, req)
+
+			result := w.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, result.StatusCode)
+			assert.Equal(t, tt.wantLoc, result.Header.Get("Location"))
+			mockShort.AssertExpectations(t)
+		})
+	}
+}
+
+func TestUpdateShortURL(t *testing.T) {
+	tests := []struct {
+		name       string
+		caller     string
+		body       string
+		wantStatus int
+		wantURL    string
+	}{
+		{name: "owner changes target #1", caller: "u1", body: `{"url":"https://example.com/fixed"}`, wantStatus: http.StatusOK, wantURL: "https://example.com/fixed"},
+		{name: "other user is forbidden #2", caller: "u2", body: `{"url":"https://example.com/fixed"}`, wantStatus: http.StatusForbidden},
+		{name: "unknown field is rejected #3", caller: "u1", body: `{"target":"https://example.com/fixed"}`, wantStatus: http.StatusBadRequest},
+		{name: "attributes only keep the target #4", caller: "u1", body: `{"redirect_type":301}`, wantStatus: http.StatusOK, wantURL: "https://example.com/typo"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockShort := &MockShortRepo{}
+			mockRevisions := &MockRevisionRepo{}
+			handler := NewShortURLHandler(&MockStorage{short: mockShort, revisions: mockRevisions})
+
+			mockShort.On("Get", mock.Anything, "EwHXdJfB").
+				Return(&storage.ShortURL{Hash: "EwHXdJfB", Original: "https://example.com/typo", UserID: "u1"}, nil).
+				Maybe()
+			if tt.wantStatus == http.StatusOK {
+				mockShort.On("Update", mock.Anything, mock.MatchedBy(func(u *storage.ShortURL) bool {
+					return u.Original == tt.wantURL
+				})).Return(nil).Once()
+				mockRevisions.On("Record", mock.Anything, mock.MatchedBy(func(rev *storage.Revision) bool {
+					return rev.OldURL == "https://example.com/typo" && rev.NewURL == tt.wantURL && rev.UserID == "u1" &&
+						rev.Before.Original == "https://example.com/typo"
+				})).Return(nil).Once()
+			}
+
+			req := httptest.NewRequest(http.MethodPatch, "/api/urls/EwHXdJfB", strings.NewReader(tt.body))
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("hash", "EwHXdJfB")
+			ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+			req = req.WithContext(auth.WithUserID(ctx, tt.caller))
+
+			w := httptest.NewRecorder()
+			handler.UpdateShortURL(w, req)
+
+			result := w.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, result.StatusCode)
+			mockShort.AssertExpectations(t)
+			mockRevisions.AssertExpectations(t)
+		})
+	}
+}
+
+func TestRollbackShortURL(t *testing.T) {
+	mockShort := &MockShortRepo{}
+	mockRevisions := &MockRevisionRepo{}
+	handler := NewShortURLHandler(&MockStorage{short: mockShort, revisions: mockRevisions})
+
+	mockShort.On("Get", mock.Anything, "EwHXdJfB").
+		Return(&storage.ShortURL{Hash: "EwHXdJfB", Original: "https://example.com/new", UserID: "u1", Uses: 3}, nil).
+		Once()
+	mockRevisions.On("Get", mock.Anything, "EwHXdJfB", int64(7)).
+		Return(&storage.Revision{ID: 7, Hash: "EwHXdJfB", OldURL: "https://example.com/old", NewURL: "https://example.com/new",
+			Before: storage.ShortURL{Hash: "EwHXdJfB", Original: "https://example.com/old", RedirectType: 301, UserID: "u1"}}, nil).
+		Once()
+	mockShort.On("Update", mock.Anything, mock.MatchedBy(func(u *storage.ShortURL) bool {
+		return u.Original == "https://example.com/old" && u.RedirectType == 301 && u.Uses == 3
+	})).Return(nil).Once()
+	mockRevisions.On("Record", mock.Anything, mock.MatchedBy(func(rev *storage.Revision) bool {
+		return rev.OldURL == "https://example.com/new" && rev.NewURL == "https://example.com/old"
+	})).Return(nil).Once()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/urls/EwHXdJfB/history/7/rollback", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("hash", "EwHXdJfB")
+	rctx.URLParams.Add("id", "7")
+	ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+	req = req.WithContext(auth.WithUserID(ctx, "u1"))
+
+	w := httptest.NewRecorder()
+	handler.RollbackShortURL(w, req)
+
+	result := w.Result()
+	defer result.Body.Close()
+
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	mockShort.AssertExpectations(t)
+	mockRevisions.AssertExpectations(t)
+}
+
+func TestNormalizeTags(t *testing.T) {
+	tags, err := normalizeTags([]string{" Launch", "q3", "launch", "", "Docs"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"docs", "launch", "q3"}, tags)
+
+	_, err = normalizeTags([]string{strings.Repeat("x", maxTagLength+1)})
+	assert.Error(t, err)
+}
+
+func TestGetUserURLs(t *testing.T) {
+	tests := []struct {
+		name       string
+		query      string
+		filter     storage.LinkFilter
+		links      []storage.ShortURL
+		wantStatus int
+	}{
+		{
+			name:       "filter by tag and search #1",
+			query:      "?tag=Launch&q=pricing",
+			filter:     storage.LinkFilter{Tag: "launch", Search: "pricing"},
+			links:      []storage.ShortURL{{Hash: "EwHXdJfB", Original: "https://example.com/pricing", Title: "Pricing page", Tags: []string{"launch"}}},
+			wantStatus: http.StatusOK,
+		},
+		{name: "no links #2", wantStatus: http.StatusNoContent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockShort := &MockShortRepo{}
+			handler := NewShortURLHandler(&MockStorage{short: mockShort})
+
+			mockShort.On("ListByUser", mock.Anything, "u1", tt.filter).Return(tt.links, nil).Once()
+
+			req := httptest.NewRequest(http.MethodGet, "/api/user/urls"+tt.query, nil)
+			req = req.WithContext(auth.WithUserID(req.Context(), "u1"))
+
+			w := httptest.NewRecorder()
+			handler.GetUserURLs(w, req)
+
+			result := w.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, result.StatusCode)
+			if tt.wantStatus == http.StatusOK {
+				var resp []UserURLResp
+				require.NoError(t, json.NewDecoder(result.Body).Decode(&resp))
+				require.Len(t, resp, 1)
+				assert.Equal(t, "http://example.com/EwHXdJfB", resp[0].ShortURL)
+				assert.Equal(t, "Pricing page", resp[0].Title)
+			}
+			mockShort.AssertExpectations(t)
+		})
+	}
+}
+
+func TestListURLs(t *testing.T) {
+	created := time.Date(2025, 3, 1, 9, 0, 0, 0, time.UTC)
+	links := []storage.ShortURL{
+		{Hash: "b", Original: "https://example.com/2", UserID: "u1", CreatedAt: created.Add(time.Minute), Clicks: 4},
+		{Hash: "a", Original: "https://example.com/1", UserID: "u1", CreatedAt: created},
+	}
+
+	mockShort := &MockShortRepo{}
+	handler := NewShortURLHandler(&MockStorage{short: mockShort})
+
+	first := storage.ListQuery{UserID: "u1", Search: "example", Sort: storage.SortCreatedAt, Desc: true, Limit: 1}
+	mockShort.On("Count", mock.Anything, first).Return(int64(2), nil).Once()
+	page := first
+	page.Limit = 2
+	mockShort.On("List", mock.Anything, page).Return(links, nil).Once()
+
+	serve := func(query string) *http.Response {
+		req := httptest.NewRequest(http.MethodGet, "/api/urls"+query, nil)
+		req = req.WithContext(auth.WithUserID(req.Context(), "u1"))
+		w := httptest.NewRecorder()
+		handler.ListURLs(w, req)
+		return w.Result()
+	}
+
+	result := serve("?q=example&limit=1")
+	defer result.Body.Close()
+	require.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Equal(t, "2", result.Header.Get("X-Total-Count"))
+
+	var resp ListURLsResp
+	require.NoError(t, json.NewDecoder(result.Body).Decode(&resp))
+	require.Len(t, resp.Items, 1)
+	assert.Equal(t, "b", resp.Items[0].Hash)
+	require.NotEmpty(t, resp.NextCursor)
+
+	second := first
+	second.After = &storage.ListCursor{CreatedAt: links[0].CreatedAt, Clicks: 4, Hash: "b"}
+	mockShort.On("Count", mock.Anything, second).Return(int64(2), nil).Once()
+	page = second
+	page.Limit = 2
+	mockShort.On("List", mock.Anything, page).Return(links[1:], nil).Once()
+
+	result = serve("?q=example&limit=1&cursor=" + resp.NextCursor)
+	defer result.Body.Close()
+	require.Equal(t, http.StatusOK, result.StatusCode)
+	resp = ListURLsResp{}
+	require.NoError(t, json.NewDecoder(result.Body).Decode(&resp))
+	require.Len(t, resp.Items, 1)
+	assert.Equal(t, "a", resp.Items[0].Hash)
+	assert.Empty(t, resp.NextCursor)
+
+	result = serve("?sort=clicks&cursor=" + resp.NextCursor + "x")
+	defer result.Body.Close()
+	assert.Equal(t, http.StatusBadRequest, result.StatusCode)
+
+	mockShort.AssertExpectations(t)
+}
+
+func TestGetLinkInfo(t *testing.T) {
+	past := time.Now().Add(-time.Hour)
+
+	tests := []struct {
+		name       string
+		link       storage.ShortURL
+		caller     string
+		wantURL    string
+		wantStatus string
+	}{
+		{name: "active link #1", link: storage.ShortURL{UserID: "u1"}, wantURL: "https://example.com/page", wantStatus: "active"},
+		{name: "expired link #2", link: storage.ShortURL{UserID: "u1", ValidUntil: &past}, wantURL: "https://example.com/page", wantStatus: "expired"},
+		{name: "used up link #3", link: storage.ShortURL{UserID: "u1", MaxClicks: 2, Uses: 2}, wantURL: "https://example.com/page", wantStatus: "exhausted"},
+		{name: "protected link seen by a stranger #4", link: storage.ShortURL{UserID: "u1", PasswordHash: "x"}, caller: "u2", wantStatus: "active"},
+		{name: "protected link seen by the owner #5", link: storage.ShortURL{UserID: "u1", PasswordHash: "x"}, caller: "u1", wantURL: "https://example.com/page", wantStatus: "active"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockShort := &MockShortRepo{}
+			// No clicks repository: looking at a link must not count as a click.
+			handler := NewShortURLHandler(&MockStorage{short: mockShort})
+
+			link := tt.link
+			link.Hash, link.Original, link.Clicks = "EwHXdJfB", "https://example.com/page", 7
+			mockShort.On("Get", mock.Anything, "EwHXdJfB").Return(&link, nil).Once()
+
+			req := httptest.NewRequest(http.MethodGet, "/api/urls/EwHXdJfB", nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("hash", "EwHXdJfB")
+			ctx := context.WithValue(req.Context(), chi.RouteCtxKey, rctx)
+			if tt.caller != "" {
+				ctx = auth.WithUserID(ctx, tt.caller)
+			}
+			req = req.WithContext(ctx)
+
+			w := httptest.NewRecorder()
+			handler.GetLinkInfo(w, req)
+
+			result := w.Result()
+			defer result.Body.Close()
+
+			require.Equal(t, http.StatusOK, result.StatusCode)
+			var resp LinkInfoResp
+			require.NoError(t, json.NewDecoder(result.Body).Decode(&resp))
+			assert.Equal(t, tt.wantURL, resp.URL)
+			assert.Equal(t, tt.wantStatus, resp.Status)
+			assert.Equal(t, int64(7), resp.Clicks)
+			mockShort.AssertExpectations(t)
+		})
+	}
+}
+
+func TestPreviewShortURL(t *testing.T) {
+	mockShort := &MockShortRepo{}
+	handler := NewShortURLHandler(&MockStorage{short: mockShort})
+
+	link := storage.ShortURL{Hash: "EwHXdJfB", Original: "https://example.com/page?a=1&b=2", Title: "<Launch>"}
+	mockShort.On("Get", mock.Anything, "EwHXdJfB").Return(&link, nil).Once()
+
+	req := httptest.NewRequest(http.MethodGet, "/EwHXdJfB+", nil)
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("hash", "EwHXdJfB")
+	req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+	w := httptest.NewRecorder()
+	handler.PreviewShortURL(w, req)
+
+	result := w.Result()
+	defer result.Body.Close()
+	body, _ := io.ReadAll(result.Body)
+
+	assert.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Equal(t, "text/html; charset=utf-8", result.Header.Get("Content-Type"))
+	assert.Contains(t, string(body), "https://example.com/page?a=1&amp;b=2")
+	assert.Contains(t, string(body), "&lt;Launch&gt;")
+	mockShort.AssertExpectations(t)
+}
+
+func TestGetQRCode(t *testing.T) {
+	tests := []struct {
+		name            string
+		query           string
+		found           bool
+		wantStatus      int
+		wantContentType string
+	}{
+		{name: "png by default #1", found: true, wantStatus: http.StatusOK, wantContentType: "image/png"},
+		{name: "svg #2", query: "?format=svg&size=512&level=H&margin=2&fg=%23112233&bg=fff", found: true, wantStatus: http.StatusOK, wantContentType: "image/svg+xml"},
+		{name: "invalid size #3", query: "?size=5", wantStatus: http.StatusBadRequest},
+		{name: "invalid color #4", query: "?fg=blue", wantStatus: http.StatusBadRequest},
+		{name: "unknown link #5", wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockShort := &MockShortRepo{}
+			handler := NewShortURLHandler(&MockStorage{short: mockShort}, WithBaseURL("https://sho.rt/"))
+
+			if tt.wantStatus != http.StatusBadRequest {
+				if tt.found {
+					mockShort.On("Get", mock.Anything, "EwHXdJfB").Return(&storage.ShortURL{Hash: "EwHXdJfB", Original: "https://example.com/page"}, nil).Once()
+				} else {
+					mockShort.On("Get", mock.Anything, "EwHXdJfB").Return(nil, storage.ErrNotFound).Once()
+				}
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/urls/EwHXdJfB/qr"+tt.query, nil)
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("hash", "EwHXdJfB")
+			req = req.WithContext(context.WithValue(req.Context(), chi.RouteCtxKey, rctx))
+
+			w := httptest.NewRecorder()
+			handler.GetQRCode(w, req)
+
+			result := w.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, result.StatusCode)
+			if tt.wantContentType != "" {
+				assert.Equal(t, tt.wantContentType, result.Header.Get("Content-Type"))
+			}
+			mockShort.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetShortURLQRPath(t *testing.T) {
+	tests := []struct {
+		name            string
+		passthrough     bool
+		wantStatus      int
+		wantContentType string
+		wantLoc         string
+	}{
+		{name: "qr code of a plain link #1", wantStatus: http.StatusOK, wantContentType: "image/png"},
+		{name: "passthrough link forwards /qr #2", passthrough: true, wantStatus: http.StatusTemporaryRedirect, wantLoc: "https://example.com/docs/qr"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockShort := &MockShortRepo{}
+			handler := NewShortURLHandler(&MockStorage{short: mockShort}, WithBaseURL("https://sho.rt"))
+
+			mockShort.On("Get", mock.Anything, "EwHXdJfB").
+				Return(&storage.ShortURL{Hash: "EwHXdJfB", Original: "https://example.com/docs", Passthrough: tt.passthrough}, nil)
+
+			r := chi.NewRouter()
+			r.Get("/{hash}/*", handler.GetShortURL)
+
+			req := httptest.NewRequest(http.MethodGet, "/EwHXdJfB/qr", nil)
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			result := w.Result()
+			defer result.Body.Close()
+
+			assert.Equal(t, tt.wantStatus, result.StatusCode)
+			if tt.wantContentType != "" {
+				assert.Equal(t, tt.wantContentType, result.Header.Get("Content-Type"))
+			}
+			assert.Equal(t, tt.wantLoc, result.Header.Get("Location"))
+		})
+	}
+}
+
+func TestImportURLs(t *testing.T) {
+	mockShort := &MockShortRepo{}
+	mockCounter := &MockCounterRepo{}
+	handler := NewShortURLHandler(&MockStorage{short: mockShort, counter: mockCounter}, WithBaseURL("https://sho.rt"))
+
+	mockShort.On("GetByOriginal", mock.Anything, "https://example.com/new").Return("", storage.ErrNotFound).Once()
+	mockShort.On("GetByOriginal", mock.Anything, "https://example.com/old").Return("EwHXdJfB", nil).Once()
+	mockCounter.On("Next", mock.Anything).Return(uint64(1), nil).Once()
+	mockShort.On("Save", mock.Anything, "1111112", "https://example.com/new").Return(nil).Once()
+
+	body := `{"original_url":"https://example.com/new","tags":["Promo","news"]}` + "\n" +
+		`{"original_url":"https://example.com/old"}` + "\n" +
+		`{"original_url":""}` + "\n"
+	req := httptest.NewRequest(http.MethodPost, "/api/import", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/x-ndjson")
+	req = req.WithContext(auth.WithUserID(req.Context(), "u1"))
+
+	w := httptest.NewRecorder()
+	handler.ImportURLs(w, req)
+
+	result := w.Result()
+	defer result.Body.Close()
+	report, _ := io.ReadAll(result.Body)
+
+	require.Equal(t, http.StatusOK, result.StatusCode)
+	assert.Equal(t, "1", result.Header.Get("X-Import-Created"))
+	assert.Equal(t, "1", result.Header.Get("X-Import-Exists"))
+	assert.Equal(t, "1", result.Header.Get("X-Import-Failed"))
+	assert.Equal(t, `{"line":1,"original_url":"https://example.com/new","status":"created","short_url":"https://sho.rt/1111112"}
+{"line":2,"original_url":"https://example.com/old","status":"exists","short_url":"https://sho.rt/EwHXdJfB"}
+{"line":3,"original_url":"","status":"failed","error":"original_url is required"}
+`, string(report))
+	mockShort.AssertExpectations(t)
+	mockCounter.AssertExpectations(t)
+}
+
+func TestExportURLs(t *testing.T) {
+	links := []storage.ShortURL{
+		{Hash: "EwHXdJfB", Original: "https://example.com/a", UserID: "u1"},
+		{Hash: "EwHXdJfC", Original: "https://example.com/b", UserID: "u2"},
+	}
+
+	tests := []struct {
+		name            string
+		query           string
+		wantStatus      int
+		wantContentType string
+		wantLines       int
+	}{
+		{name: "ndjson by default #1", wantStatus: http.StatusOK, wantContentType: "application/x-ndjson", wantLines: 2},
+		{name: "csv #2", query: "?format=csv", wantStatus: http.StatusOK, wantContentType: "text/csv", wantLines: 3},
+		{name: "file format #3", query: "?format=file", wantStatus: http.StatusOK, wantContentType: "application/x-ndjson", wantLines: 2},
+		{name: "unknown format #4", query: "?format=xml", wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockShort := &MockShortRepo{}
+			handler := NewShortURLHandler(&MockStorage{short: mockShort})
+			if tt.wantStatus == http.StatusOK {
+				mockShort.On("Each", mock.Anything).Return(links, nil).Once()
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/api/export"+tt.query, nil)
+			w := httptest.NewRecorder()
+			handler.ExportURLs(w, req)
+
+			result := w.Result()
+			defer result.Body.Close()
+			body, _ := io.ReadAll(result.Body)
+
+			assert.Equal(t, tt.wantStatus, result.StatusCode)
+			if tt.wantStatus == http.StatusOK {
+				assert.Equal(t, tt.wantContentType, result.Header.Get("Content-Type"))
+				assert.Len(t, strings.Split(strings.TrimSpace(string(body)), "\n"), tt.wantLines)
+			}
+			mockShort.AssertExpectations(t)
+		})
+	}
+}
+
+func TestReconfigure(t *testing.T) {
+	handler := NewShortURLHandler(&MockStorage{}, WithBaseURL("https://old.example"), WithDefaultRedirectType(http.StatusFound))
+	throttle := handler.settings().pwThrottle
+
+	handler.Reconfigure(WithBaseURL("https://new.example"), WithPasswordThrottle(passwordMaxAttempts, passwordAttemptWindow))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	assert.Equal(t, "https://new.example/EwHXdJfB", handler.shortURL(req, "EwHXdJfB"))
+	assert.Equal(t, http.StatusFound, handler.redirectStatus(0), "settings not passed are kept")
+	assert.Same(t, throttle, handler.settings().pwThrottle, "unchanged limits keep the attempt counts")
+
+	handler.Reconfigure(WithPasswordThrottle(1, time.Minute))
+	assert.NotSame(t, throttle, handler.settings().pwThrottle)
+}
+
+type MockReloader struct{ mock.Mock }
+
+func (m *MockReloader) Reload() ([]config.Change, []config.Change, error) {
+	args := m.Called()
+	applied, _ := args.Get(0).([]config.Change)
+	restart, _ := args.Get(1).([]config.Change)
+	return applied, restart, args.Error(2)
+}
+
+func TestReloadConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		applied    []config.Change
+		err        error
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "applied #1",
+			applied:    []config.Change{{Setting: "LOG_LEVEL", Old: "info", New: "debug"}},
+			wantStatus: http.StatusOK,
+			wantBody:   `{"applied":[{"setting":"LOG_LEVEL","old":"info","new":"debug"}],"restart_required":[]}`,
+		},
+		{
+			name:       "invalid config #2",
+			err:        config.ValidationError{assert.AnError},
+			wantStatus: http.StatusUnprocessableEntity,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reloader := &MockReloader{}
+			reloader.On("Reload").Return(tt.applied, nil, tt.err).Once()
+			handler := NewReloadHandler(reloader)
+
+			req := httptest.NewRequest(http.MethodPost, "/api/admin/reload", nil)
+			w := httptest.NewRecorder()
+			handler.ReloadConfig(w, req)
+
+			result := w.Result()
+			defer result.Body.Close()
+			body, _ := io.ReadAll(result.Body)
+
+			assert.Equal(t, tt.wantStatus, result.StatusCode)
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, string(body))
+			}
+			reloader.AssertExpectations(t)
+		})
+	}
+}
+
+func TestGetInternalStats(t *testing.T) {
+	_, subnet, _ := net.ParseCIDR("10.1.0.0/16")
+	// The second proxy sits inside the trusted subnet itself.
+	proxies, err := realip.New([]string{"192.0.2.1", "10.1.0.1"})
+	require.NoError(t, err)
+	noProxies, err := realip.New(nil)
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		subnet     *net.IPNet
+		resolver   *realip.Resolver
+		remoteAddr string
+		realIP     string
+		xff        string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "real ip from proxy in subnet #1", subnet: subnet, remoteAddr: "192.0.2.1:4000", realIP: "10.1.2.3",
+			wantStatus: http.StatusOK, wantBody: `{"urls":12,"users":3,"clicks_today":40}`},
+		{name: "real ip outside subnet #2", subnet: subnet, remoteAddr: "192.0.2.1:4000", realIP: "10.2.0.1",
+			wantStatus: http.StatusForbidden},
+		{name: "spoofed header from untrusted peer #3", subnet: subnet, remoteAddr: "203.0.113.5:4000", realIP: "10.1.2.3",
+			wantStatus: http.StatusForbidden},
+		{name: "no subnet configured #4", remoteAddr: "10.1.2.3:4000", wantStatus: http.StatusForbidden},
+		{name: "proxy peer in subnet, real ip outside #5", subnet: subnet, remoteAddr: "10.1.0.1:4000", realIP: "203.0.113.7",
+			wantStatus: http.StatusForbidden},
+		{name: "x-forwarded-for is not used #6", subnet: subnet, remoteAddr: "192.0.2.1:4000", realIP: "203.0.113.7", xff: "10.1.2.3",
+			wantStatus: http.StatusForbidden},
+		{name: "peer address without proxies #7", subnet: subnet, resolver: noProxies, remoteAddr: "10.1.2.3:4000", realIP: "203.0.113.7",
+			wantStatus: http.StatusOK, wantBody: `{"urls":12,"users":3,"clicks_today":40}`},
+		{name: "header ignored without proxies #8", subnet: subnet, resolver: noProxies, remoteAddr: "203.0.113.7:4000", realIP: "10.1.2.3",
+			wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mockShort := &MockShortRepo{}
+			mockClicks := &MockClickRepo{}
+			handler := NewShortURLHandler(&MockStorage{short: mockShort, clicks: mockClicks})
+			if tt.wantStatus == http.StatusOK {
+				mockShort.On("CountAll", mock.Anything).Return(int64(12), nil).Once()
+				mockShort.On("CountUsers", mock.Anything).Return(int64(3), nil).Once()
+				mockClicks.On("CountSince", mock.Anything, mock.MatchedBy(func(since time.Time) bool {
+					return since.Equal(time.Now().UTC().Truncate(24 * time.Hour))
+				})).Return(int64(40), nil).Once()
+			}
+			resolver := proxies
+			if tt.resolver != nil {
+				resolver = tt.resolver
+			}
+			h := middleware.TrustedSubnet(tt.subnet, resolver.RealIP)(http.HandlerFunc(handler.GetInternalStats))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/internal/stats", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.realIP != "" {
+				req.Header.Set("X-Real-IP", tt.realIP)
+			}
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			result := w.Result()
+			defer result.Body.Close()
+			body, _ := io.ReadAll(result.Body)
+
+			assert.Equal(t, tt.wantStatus, result.StatusCode)
+			if tt.wantBody != "" {
+				assert.JSONEq(t, tt.wantBody, string(body))
+			}
+			mockShort.AssertExpectations(t)
+			mockClicks.AssertExpectations(t)
+		})
+	}
+}
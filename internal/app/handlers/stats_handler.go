@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+)
+
+type LinkStatsResp struct {
+	Hash      string             `json:"hash"`
+	Clicks    int64              `json:"clicks"`
+	Variants  []VariantStatsResp `json:"variants,omitempty"`
+	Countries map[string]int64   `json:"countries,omitempty"`
+}
+
+type VariantStatsResp struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+	Clicks int64  `json:"clicks"`
+}
+
+// GetLinkStats returns click counts of a link, split per A/B variant.
+// Variants removed from the link are listed with weight 0.
+func (h *ShortURLHandler) GetLinkStats(w http.ResponseWriter, r *http.Request) {
+	link, ok := h.ownedLink(w, r)
+	if !ok {
+		return
+	}
+
+	stats, err := h.storage.Clicks().Stats(r.Context(), link.Hash)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	resp := LinkStatsResp{Hash: link.Hash, Clicks: stats.Clicks, Countries: stats.Countries}
+
+	seen := make(map[string]bool)
+	for _, d := range link.Destinations {
+		resp.Variants = append(resp.Variants, VariantStatsResp{URL: d.URL, Weight: d.Weight, Clicks: stats.Variants[d.URL]})
+		seen[d.URL] = true
+	}
+
+	var removed []VariantStatsResp
+	for variant, n := range stats.Variants {
+		if !seen[variant] {
+			removed = append(removed, VariantStatsResp{URL: variant, Clicks: n})
+		}
+	}
+	sort.Slice(removed, func(i, j int) bool { return removed[i].URL < removed[j].URL })
+	resp.Variants = append(resp.Variants, removed...)
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,155 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/vlxdisluv/shortener/internal/app/storage"
+)
+
+// maxResolveDepth limits how many of our own short links are followed
+// when a target points back at the shortener.
+const maxResolveDepth = 5
+
+type targetError struct {
+	status int
+	msg    string
+}
+
+func (e *targetError) Error() string { return e.msg }
+
+func rejectTarget(format string, args ...any) error {
+	return &targetError{status: http.StatusUnprocessableEntity, msg: fmt.Sprintf(format, args...)}
+}
+
+// targetStatus maps an error returned by checkTarget to an HTTP status.
+func targetStatus(err error) int {
+	var te *targetError
+	if errors.As(err, &te) {
+		return te.status
+	}
+	return http.StatusInternalServerError
+}
+
+// checkTarget replaces targets that point at our own short links with their
+// final destination and applies the URL policy to the result.
+func (h *ShortURLHandler) checkTarget(ctx context.Context, rawURL string) (string, error) {
+	target, err := h.resolveOwnLinks(ctx, rawURL)
+	if err != nil {
+		return "", err
+	}
+
+	if policy := h.settings().policy; policy != nil {
+		if reason, ok := policy.Allow(target); !ok {
+			return "", rejectTarget("%s", reason)
+		}
+	}
+	return target, nil
+}
+
+func (h *ShortURLHandler) resolveOwnLinks(ctx context.Context, rawURL string) (string, error) {
+	target := rawURL
+	seen := make(map[string]bool)
+
+	for depth := 0; ; depth++ {
+		hash, suffix, query, ok := h.ownLink(target)
+		if !ok {
+			return target, nil
+		}
+
+		next, err := h.storage.ShortURLs().Get(ctx, hash)
+		if err != nil {
+			if !errors.Is(err, storage.ErrNotFound) {
+				return "", err
+			}
+			if suffix != "" {
+				// Some other page of ours, not a short link.
+				return target, nil
+			}
+			return "", rejectTarget("target %s points to a short link that does not exist", rawURL)
+		}
+		if suffix != "" && !next.Passthrough {
+			// Only passthrough links take a path suffix, this one answers 404.
+			return target, nil
+		}
+
+		if seen[hash] {
+			return "", rejectTarget("target %s creates a redirect loop", rawURL)
+		}
+		if depth == maxResolveDepth {
+			return "", rejectTarget("target %s is a chain of more than %d short links", rawURL, maxResolveDepth)
+		}
+		seen[hash] = true
+
+		target = next.Original
+		if next.Passthrough {
+			// Where the redirect would send a visitor of this URL.
+			if target, err = passthroughURL(next.Original, suffix, query); err != nil {
+				return "", rejectTarget("target %s: %v", rawURL, err)
+			}
+		}
+	}
+}
+
+// ownLink splits rawURL into the short link hash, the path after it and
+// the query if it points at one of our own domains, e.g.
+// http://localhost:8080/EwHXdJf or http://localhost:8080/EwHXdJf/docs?id=1.
+func (h *ShortURLHandler) ownLink(rawURL string) (hash, suffix string, query url.Values, ok bool) {
+	own := h.settings().ownHosts
+	if len(own) == 0 {
+		return "", "", nil, false
+	}
+
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" {
+		return "", "", nil, false
+	}
+
+	if !own[strings.ToLower(u.Host)] && !own[strings.ToLower(u.Hostname())] {
+		return "", "", nil, false
+	}
+
+	hash, suffix, _ = strings.Cut(strings.TrimPrefix(u.Path, "/"), "/")
+	if hash == "" {
+		return "", "", nil, false
+	}
+	return hash, suffix, u.Query(), true
+}
+
+func ownHosts(baseURL string, aliases []string) map[string]bool {
+	hosts := make(map[string]bool)
+	if u, err := url.Parse(baseURL); err == nil && u.Host != "" {
+		hosts[strings.ToLower(u.Host)] = true
+	}
+	for _, alias := range aliases {
+		if alias = strings.ToLower(strings.TrimSpace(alias)); alias != "" {
+			hosts[alias] = true
+		}
+	}
+	return hosts
+}
+
+// checkCampaign verifies that a referenced campaign template exists.
+func (h *ShortURLHandler) checkCampaign(ctx context.Context, name string) error {
+	if name == "" {
+		return nil
+	}
+	if _, err := h.storage.Campaigns().Get(ctx, name); err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			return rejectTarget("campaign %q does not exist", name)
+		}
+		return err
+	}
+	return nil
+}
+
+func nonEmptyUTM(utm *storage.UTM) *storage.UTM {
+	if utm == nil || *utm == (storage.UTM{}) {
+		return nil
+	}
+	return utm
+}
@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/vlxdisluv/shortener/internal/app/auth"
+	"github.com/vlxdisluv/shortener/internal/app/rotation"
+	"github.com/vlxdisluv/shortener/internal/app/storage"
+	"github.com/vlxdisluv/shortener/internal/app/targeting"
+)
+
+type TargetingResp struct {
+	Hash  string                  `json:"hash"`
+	Rules []storage.TargetingRule `json:"rules"`
+}
+
+func (h *ShortURLHandler) GetTargeting(w http.ResponseWriter, r *http.Request) {
+	link, ok := h.ownedLink(w, r)
+	if !ok {
+		return
+	}
+
+	rules := link.Targeting
+	if rules == nil {
+		rules = []storage.TargetingRule{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(TargetingResp{Hash: link.Hash, Rules: rules})
+}
+
+// UpdateTargeting replaces the whole ordered rule list of a link.
+func (h *ShortURLHandler) UpdateTargeting(w http.ResponseWriter, r *http.Request) {
+	var rules []storage.TargetingRule
+	if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+		http.Error(w, "invalid JSON: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	defer r.Body.Close()
+
+	link, ok := h.ownedLink(w, r)
+	if !ok {
+		return
+	}
+
+	rules, err := h.checkTargeting(r.Context(), rules)
+	if err != nil {
+		http.Error(w, err.Error(), targetStatus(err))
+		return
+	}
+
+	before := *link
+	link.Targeting = rules
+	if err := h.updateLink(r.Context(), &before, link); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if rules == nil {
+		rules = []storage.TargetingRule{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_ = json.NewEncoder(w).Encode(TargetingResp{Hash: link.Hash, Rules: rules})
+}
+
+// ownedLink loads the link named in the URL and makes sure the caller owns
+// it. On failure the error response is already written.
+func (h *ShortURLHandler) ownedLink(w http.ResponseWriter, r *http.Request) (*storage.ShortURL, bool) {
+	hash := chi.URLParam(r, "hash")
+
+	link, err := h.storage.ShortURLs().Get(r.Context(), hash)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, fmt.Sprintf("short url does not exist for %s", hash), http.StatusNotFound)
+			return nil, false
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	userID, ok := auth.UserID(r.Context())
+	if !ok || link.UserID == "" || link.UserID != userID {
+		http.Error(w, "only the owner can manage this short url", http.StatusForbidden)
+		return nil, false
+	}
+	return link, true
+}
+
+// checkTargeting validates rules and runs every destination through the same
+// checks as a link target.
+func (h *ShortURLHandler) checkTargeting(ctx context.Context, rules []storage.TargetingRule) ([]storage.TargetingRule, error) {
+	if len(rules) == 0 {
+		return nil, nil
+	}
+
+	checked := make([]storage.TargetingRule, len(rules))
+	for i, rule := range rules {
+		if err := targeting.Validate(rule); err != nil {
+			return nil, rejectTarget("targeting rule %d: %s", i, err)
+		}
+		destination, err := h.checkTarget(ctx, rule.Destination)
+		if err != nil {
+			if targetStatus(err) == http.StatusInternalServerError {
+				return nil, err
+			}
+			return nil, rejectTarget("targeting rule %d: %s", i, err)
+		}
+		rule.Destination = destination
+		checked[i] = rule
+	}
+	return checked, nil
+}
+
+// checkDestinations validates weighted A/B destinations the same way as
+// targeting rule destinations.
+func (h *ShortURLHandler) checkDestinations(ctx context.Context, destinations []storage.Destination) ([]storage.Destination, error) {
+	if len(destinations) == 0 {
+		return nil, nil
+	}
+	if err := rotation.Validate(destinations); err != nil {
+		return nil, rejectTarget("%s", err)
+	}
+
+	checked := make([]storage.Destination, len(destinations))
+	for i, d := range destinations {
+		target, err := h.checkTarget(ctx, d.URL)
+		if err != nil {
+			if targetStatus(err) == http.StatusInternalServerError {
+				return nil, err
+			}
+			return nil, rejectTarget("destination %d: %s", i, err)
+		}
+		checked[i] = storage.Destination{URL: target, Weight: d.Weight}
+	}
+	return checked, nil
+}
@@ -0,0 +1,247 @@
+// Package importer loads links in bulk from CSV or NDJSON files.
+package importer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+
+	"github.com/vlxdisluv/shortener/internal/app/shortener"
+	"github.com/vlxdisluv/shortener/internal/app/storage"
+)
+
+// DefaultChunkSize is the number of rows saved in one transaction.
+const DefaultChunkSize = 500
+
+// Row outcomes in the report.
+const (
+	StatusCreated = "created"
+	StatusExists  = "exists"
+	StatusFailed  = "failed"
+)
+
+// ErrInput marks errors in the imported file that stop the import, as
+// opposed to storage errors.
+var ErrInput = errors.New("invalid import file")
+
+var aliasPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// reservedAliases would shadow routes of the server.
+var reservedAliases = map[string]bool{"api": true, "ping": true}
+
+type Storage interface {
+	ShortURLs() storage.ShortURLRepository
+	Counters() storage.CounterRepository
+	UnitOfWork() storage.UnitOfWork
+}
+
+// CheckFunc validates a link before it is saved and may normalize it, e.g.
+// apply the URL policy to the target. Errors are reported for the row.
+type CheckFunc func(ctx context.Context, link *storage.ShortURL) error
+
+// Result is the outcome of one row.
+type Result struct {
+	Line        int
+	OriginalURL string
+	Hash        string
+	Status      string
+	Error       string
+}
+
+// Summary counts the outcomes of a whole import.
+type Summary struct {
+	Created int
+	Exists  int
+	Failed  int
+}
+
+type Importer struct {
+	storage   Storage
+	check     CheckFunc
+	userID    string
+	chunkSize int
+}
+
+type Option func(*Importer)
+
+func WithCheck(check CheckFunc) Option {
+	return func(im *Importer) { im.check = check }
+}
+
+// WithUserID makes the imported links owned by userID.
+func WithUserID(userID string) Option {
+	return func(im *Importer) { im.userID = userID }
+}
+
+func WithChunkSize(n int) Option {
+	return func(im *Importer) {
+		if n > 0 {
+			im.chunkSize = n
+		}
+	}
+}
+
+func New(s Storage, opts ...Option) *Importer {
+	im := &Importer{storage: s, chunkSize: DefaultChunkSize}
+	for _, opt := range opts {
+		opt(im)
+	}
+	return im
+}
+
+// Run reads rows until EOF and saves them chunk by chunk. report is called
+// for every row once its chunk is committed. Problems with single rows are
+// reported and skipped; Run only stops on read, storage or report errors.
+func (im *Importer) Run(ctx context.Context, rows RowReader, report func(Result) error) (Summary, error) {
+	var summary Summary
+	chunk := make([]Row, 0, im.chunkSize)
+
+	flush := func() error {
+		results, err := im.saveChunk(ctx, chunk)
+		if err != nil {
+			return err
+		}
+		chunk = chunk[:0]
+		for _, res := range results {
+			switch res.Status {
+			case StatusCreated:
+				summary.Created++
+			case StatusExists:
+				summary.Exists++
+			default:
+				summary.Failed++
+			}
+			if err := report(res); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	for {
+		row, err := rows.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return summary, fmt.Errorf("%w: %v", ErrInput, err)
+		}
+		chunk = append(chunk, row)
+		if len(chunk) == im.chunkSize {
+			if err := flush(); err != nil {
+				return summary, err
+			}
+		}
+	}
+	if len(chunk) > 0 {
+		if err := flush(); err != nil {
+			return summary, err
+		}
+	}
+	return summary, nil
+}
+
+func (im *Importer) saveChunk(ctx context.Context, rows []Row) ([]Result, error) {
+	tx, err := im.storage.UnitOfWork().Begin(ctx)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback(ctx)
+
+	shortURLRepo := im.storage.ShortURLs().WithTx(tx)
+	counterRepo := im.storage.Counters().WithTx(tx)
+
+	results := make([]Result, 0, len(rows))
+	for _, row := range rows {
+		res, err := im.saveRow(ctx, shortURLRepo, counterRepo, row)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", row.Line, err)
+		}
+		results = append(results, res)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// saveRow returns an error only for storage failures; everything wrong with
+// the row itself ends up in the result.
+func (im *Importer) saveRow(ctx context.Context, shortURLRepo storage.ShortURLRepository, counterRepo storage.CounterRepository, row Row) (Result, error) {
+	res := Result{Line: row.Line, OriginalURL: row.OriginalURL}
+	fail := func(format string, args ...any) (Result, error) {
+		res.Status, res.Error = StatusFailed, fmt.Sprintf(format, args...)
+		return res, nil
+	}
+
+	if row.Err != nil {
+		return fail("%s", row.Err)
+	}
+	if row.OriginalURL == "" {
+		return fail("original_url is required")
+	}
+	if row.Alias != "" {
+		if err := checkAlias(row.Alias); err != nil {
+			return fail("%s", err)
+		}
+	}
+
+	link := &storage.ShortURL{
+		Hash:       row.Alias,
+		Original:   row.OriginalURL,
+		Tags:       row.Tags,
+		ValidUntil: row.ExpiresAt,
+		UserID:     im.userID,
+	}
+	if im.check != nil {
+		if err := im.check(ctx, link); err != nil {
+			return fail("%s", err)
+		}
+	}
+
+	if hash, err := shortURLRepo.GetByOriginal(ctx, link.Original); err == nil {
+		res.Hash, res.Status = hash, StatusExists
+		return res, nil
+	} else if !errors.Is(err, storage.ErrNotFound) {
+		return res, err
+	}
+
+	if link.Hash == "" {
+		id, err := counterRepo.Next(ctx)
+		if err != nil {
+			return res, err
+		}
+		link.Hash = shortener.Generate(id, 7)
+	}
+
+	if err := shortURLRepo.Save(ctx, link); err != nil {
+		if errors.Is(err, storage.ErrConflict) {
+			if row.Alias != "" {
+				return fail("alias %q is already taken", row.Alias)
+			}
+			return fail("url already exists")
+		}
+		return res, err
+	}
+	res.Hash, res.Status = link.Hash, StatusCreated
+	return res, nil
+}
+
+// checkAlias keeps custom hashes from clashing with routes and with hashes
+// the shortener generates itself, which are 7 or more base58 characters.
+func checkAlias(alias string) error {
+	if !aliasPattern.MatchString(alias) {
+		return fmt.Errorf("alias must be 1-64 letters, digits, '-' or '_'")
+	}
+	if reservedAliases[strings.ToLower(alias)] {
+		return fmt.Errorf("alias %q is reserved", alias)
+	}
+	if len(alias) >= 7 && shortener.IsGenerated(alias) {
+		return fmt.Errorf("alias %q could clash with a generated hash, use fewer than 7 characters or add '-' or '_'", alias)
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+package importer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vlxdisluv/shortener/internal/app/storage"
+	"github.com/vlxdisluv/shortener/internal/app/storage/file"
+)
+
+type fileStorage struct {
+	short   *file.ShortURLRepository
+	counter *file.CounterRepository
+}
+
+func (s *fileStorage) ShortURLs() storage.ShortURLRepository { return s.short }
+func (s *fileStorage) Counters() storage.CounterRepository   { return s.counter }
+func (s *fileStorage) UnitOfWork() storage.UnitOfWork        { return file.NewNoopUnitOfWork() }
+
+func newFileStorage(t *testing.T) *fileStorage {
+	dir := t.TempDir()
+	short, err := file.NewShortURLRepository(filepath.Join(dir, "db.json"), nil)
+	require.NoError(t, err)
+	counter, err := file.NewCounterRepository(filepath.Join(dir, "db.json.seq"))
+	require.NoError(t, err)
+	return &fileStorage{short: short, counter: counter}
+}
+
+func TestNewReader(t *testing.T) {
+	t.Run("csv", func(t *testing.T) {
+		in := "original_url,alias,tags,expires_at\n" +
+			"https://example.com/a,,news;promo,\n" +
+			"https://example.com/b,old-b,,2030-01-01T00:00:00Z\n" +
+			"https://example.com/c,,,tomorrow\n"
+		rows := readAll(t, in, CSV)
+		require.Len(t, rows, 3)
+		assert.Equal(t, Row{Line: 2, OriginalURL: "https://example.com/a", Tags: []string{"news", "promo"}}, rows[0])
+		assert.Equal(t, "old-b", rows[1].Alias)
+		require.NotNil(t, rows[1].ExpiresAt)
+		assert.Equal(t, 2030, rows[1].ExpiresAt.Year())
+		assert.Error(t, rows[2].Err)
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		in := `{"original_url":"https://example.com/a","tags":["news"]}` + "\n\n" +
+			`{"original_url":"https://example.com/b","unknown":1}` + "\n"
+		rows := readAll(t, in, NDJSON)
+		require.Len(t, rows, 2)
+		assert.Equal(t, Row{Line: 1, OriginalURL: "https://example.com/a", Tags: []string{"news"}}, rows[0])
+		assert.Equal(t, 3, rows[1].Line)
+		assert.Error(t, rows[1].Err)
+	})
+
+	t.Run("invalid csv header", func(t *testing.T) {
+		_, err := NewReader(strings.NewReader("url,alias\n"), CSV)
+		assert.Error(t, err)
+	})
+}
+
+func readAll(t *testing.T, in, format string) []Row {
+	r, err := NewReader(strings.NewReader(in), format)
+	require.NoError(t, err)
+	var rows []Row
+	for {
+		row, err := r.Next()
+		if err == io.EOF {
+			return rows
+		}
+		require.NoError(t, err)
+		rows = append(rows, row)
+	}
+}
+
+func TestRun(t *testing.T) {
+	s := newFileStorage(t)
+	require.NoError(t, s.short.Save(context.Background(), &storage.ShortURL{Hash: "taken", Original: "https://example.com/existing"}))
+
+	in := "original_url,alias\n" +
+		"https://example.com/1,\n" +
+		"https://example.com/existing,\n" +
+		"https://example.com/2,taken\n" +
+		"https://example.com/3,api\n" +
+		",\n" +
+		"https://example.com/4,spring-sale\n" +
+		"https://example.com/blocked,\n"
+	rows, err := NewReader(strings.NewReader(in), CSV)
+	require.NoError(t, err)
+
+	check := func(_ context.Context, link *storage.ShortURL) error {
+		if strings.Contains(link.Original, "blocked") {
+			return fmt.Errorf("domain is blocked")
+		}
+		return nil
+	}
+
+	var report bytes.Buffer
+	rw, err := NewReportWriter(&report, CSV, func(hash string) string { return "https://sho.rt/" + hash })
+	require.NoError(t, err)
+
+	im := New(s, WithUserID("u1"), WithCheck(check), WithChunkSize(2))
+	summary, err := im.Run(context.Background(), rows, rw.Write)
+	require.NoError(t, err)
+	require.NoError(t, rw.Flush())
+
+	assert.Equal(t, Summary{Created: 2, Exists: 1, Failed: 4}, summary)
+
+	link, err := s.short.Get(context.Background(), "spring-sale")
+	require.NoError(t, err)
+	assert.Equal(t, "u1", link.UserID)
+
+	lines := strings.Split(strings.TrimSpace(report.String()), "\n")
+	require.Len(t, lines, 8)
+	assert.Equal(t, "line,original_url,status,short_url,error", lines[0])
+	assert.Equal(t, "3,https://example.com/existing,exists,https://sho.rt/taken,", lines[2])
+	assert.Equal(t, `4,https://example.com/2,failed,,"alias ""taken"" is already taken"`, lines[3])
+	assert.Equal(t, "7,https://example.com/4,created,https://sho.rt/spring-sale,", lines[6])
+}
@@ -0,0 +1,169 @@
+package importer
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const (
+	CSV    = "csv"
+	NDJSON = "ndjson"
+)
+
+// Row is one link to import. Err is set when the row could not be parsed;
+// such rows are reported as failed and the import goes on.
+type Row struct {
+	Line        int
+	OriginalURL string
+	Alias       string
+	Tags        []string
+	ExpiresAt   *time.Time
+	Err         error
+}
+
+// RowReader streams rows from an import file. Next returns io.EOF after the
+// last row.
+type RowReader interface {
+	Next() (Row, error)
+}
+
+// NewReader reads rows in the given format, CSV or NDJSON.
+func NewReader(r io.Reader, format string) (RowReader, error) {
+	switch format {
+	case CSV:
+		return newCSVReader(r)
+	case NDJSON:
+		return &ndjsonReader{scanner: newLineScanner(r)}, nil
+	default:
+		return nil, fmt.Errorf("format must be csv or ndjson")
+	}
+}
+
+// csvReader expects a header naming the columns original_url, alias, tags
+// and expires_at; only original_url is required. Tags are separated by ';'.
+type csvReader struct {
+	r       *csv.Reader
+	columns map[string]int
+}
+
+var csvColumns = []string{"original_url", "alias", "tags", "expires_at"}
+
+func newCSVReader(r io.Reader) (*csvReader, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.TrimLeadingSpace = true
+	cr.ReuseRecord = true
+
+	header, err := cr.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return nil, fmt.Errorf("csv header is missing")
+		}
+		return nil, fmt.Errorf("csv header: %w", err)
+	}
+
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(strings.TrimPrefix(name, "\ufeff")))
+		known := false
+		for _, c := range csvColumns {
+			known = known || c == name
+		}
+		if !known {
+			return nil, fmt.Errorf("unknown csv column %q, expected %s", name, strings.Join(csvColumns, ", "))
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["original_url"]; !ok {
+		return nil, fmt.Errorf("csv column original_url is missing")
+	}
+	return &csvReader{r: cr, columns: columns}, nil
+}
+
+func (c *csvReader) Next() (Row, error) {
+	record, err := c.r.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return Row{Line: parseErr.StartLine, Err: parseErr.Err}, nil
+		}
+		return Row{}, err
+	}
+	line, _ := c.r.FieldPos(0)
+
+	field := func(name string) string {
+		if i, ok := c.columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	row := Row{Line: line, OriginalURL: field("original_url"), Alias: field("alias")}
+	if tags := field("tags"); tags != "" {
+		row.Tags = strings.Split(tags, ";")
+	}
+	if v := field("expires_at"); v != "" {
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			row.Err = fmt.Errorf("expires_at must be an RFC 3339 timestamp")
+			return row, nil
+		}
+		row.ExpiresAt = &t
+	}
+	return row, nil
+}
+
+// maxLineSize bounds a single NDJSON line.
+const maxLineSize = 1 << 20
+
+func newLineScanner(r io.Reader) *bufio.Scanner {
+	s := bufio.NewScanner(r)
+	s.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	return s
+}
+
+type ndjsonRow struct {
+	OriginalURL string     `json:"original_url"`
+	Alias       string     `json:"alias"`
+	Tags        []string   `json:"tags"`
+	ExpiresAt   *time.Time `json:"expires_at"`
+}
+
+type ndjsonReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func (n *ndjsonReader) Next() (Row, error) {
+	for n.scanner.Scan() {
+		n.line++
+		text := strings.TrimSpace(n.scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		dec := json.NewDecoder(strings.NewReader(text))
+		dec.DisallowUnknownFields()
+		var v ndjsonRow
+		if err := dec.Decode(&v); err != nil {
+			return Row{Line: n.line, Err: fmt.Errorf("invalid JSON: %w", err)}, nil
+		}
+		return Row{
+			Line:        n.line,
+			OriginalURL: strings.TrimSpace(v.OriginalURL),
+			Alias:       strings.TrimSpace(v.Alias),
+			Tags:        v.Tags,
+			ExpiresAt:   v.ExpiresAt,
+		}, nil
+	}
+	if err := n.scanner.Err(); err != nil {
+		return Row{}, err
+	}
+	return Row{}, io.EOF
+}
@@ -0,0 +1,60 @@
+package importer
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"strconv"
+)
+
+// ReportWriter writes the per-row results of an import in the format of the
+// imported file.
+type ReportWriter struct {
+	csv      *csv.Writer
+	json     *json.Encoder
+	shortURL func(hash string) string
+}
+
+type reportRow struct {
+	Line        int    `json:"line"`
+	OriginalURL string `json:"original_url"`
+	Status      string `json:"status"`
+	ShortURL    string `json:"short_url,omitempty"`
+	Error       string `json:"error,omitempty"`
+}
+
+// NewReportWriter writes CSV with a header or NDJSON to w. shortURL turns a
+// hash into the address printed in the report.
+func NewReportWriter(w io.Writer, format string, shortURL func(hash string) string) (*ReportWriter, error) {
+	rw := &ReportWriter{shortURL: shortURL}
+	if format == CSV {
+		rw.csv = csv.NewWriter(w)
+		if err := rw.csv.Write([]string{"line", "original_url", "status", "short_url", "error"}); err != nil {
+			return nil, err
+		}
+		return rw, nil
+	}
+	rw.json = json.NewEncoder(w)
+	return rw, nil
+}
+
+func (rw *ReportWriter) Write(res Result) error {
+	row := reportRow{Line: res.Line, OriginalURL: res.OriginalURL, Status: res.Status, Error: res.Error}
+	if res.Hash != "" {
+		row.ShortURL = rw.shortURL(res.Hash)
+	}
+
+	if rw.csv != nil {
+		return rw.csv.Write([]string{strconv.Itoa(row.Line), row.OriginalURL, row.Status, row.ShortURL, row.Error})
+	}
+	return rw.json.Encode(row)
+}
+
+// Flush writes buffered CSV rows.
+func (rw *ReportWriter) Flush() error {
+	if rw.csv != nil {
+		rw.csv.Flush()
+		return rw.csv.Error()
+	}
+	return nil
+}
@@ -1,6 +1,8 @@
 package logger
 
 import (
+	"net/http"
+
 	"github.com/vlxdisluv/shortener/config"
 	"go.uber.org/zap"
 )
@@ -10,11 +12,16 @@ import (
 // By default, a no-op logger is set, which logs nothing.
 var Log *zap.Logger = zap.NewNop()
 
+// level is shared by every logger built by Initialize, so SetLevel takes
+// effect without rebuilding them.
+var level = zap.NewAtomicLevel()
+
 func Initialize(cfg *config.Config) error {
 	lvl, err := zap.ParseAtomicLevel(cfg.LogLevel)
 	if err != nil {
 		return err
 	}
+	level.SetLevel(lvl.Level())
 
 	var zapCfg zap.Config
 	if cfg.Environment == "production" {
@@ -24,7 +31,7 @@ func Initialize(cfg *config.Config) error {
 	}
 
 	// Set desired levels and outputs: info/debug to stdout, errors to stderr
-	zapCfg.Level = lvl
+	zapCfg.Level = level
 	zapCfg.OutputPaths = []string{"stdout"}
 	zapCfg.ErrorOutputPaths = []string{"stderr"}
 
@@ -36,3 +43,19 @@ func Initialize(cfg *config.Config) error {
 	Log = zl
 	return nil
 }
+
+// SetLevel changes the level of the running logger, e.g. on a config reload.
+func SetLevel(l string) error {
+	lvl, err := zap.ParseAtomicLevel(l)
+	if err != nil {
+		return err
+	}
+	level.SetLevel(lvl.Level())
+	return nil
+}
+
+// LevelHandler reports the current level on GET and changes it on PUT with
+// a body such as {"level":"debug"}.
+func LevelHandler() http.Handler {
+	return level
+}
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/vlxdisluv/shortener/internal/app/auth"
+	"github.com/vlxdisluv/shortener/internal/app/logger"
+	"go.uber.org/zap"
+)
+
+const userCookieName = "user_id"
+
+// Authenticate identifies the caller by a signed user_id cookie. Callers
+// without a valid cookie get a new user id and cookie.
+func Authenticate(signer *auth.Signer) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if c, err := r.Cookie(userCookieName); err == nil {
+				if userID, ok := signer.Verify(c.Value); ok {
+					next.ServeHTTP(w, r.WithContext(auth.WithUserID(r.Context(), userID)))
+					return
+				}
+			}
+
+			userID, err := auth.NewUserID()
+			if err != nil {
+				logger.Log.Error("failed to generate user id", zap.Error(err))
+				w.WriteHeader(http.StatusInternalServerError)
+				return
+			}
+
+			http.SetCookie(w, &http.Cookie{
+				Name:     userCookieName,
+				Value:    signer.Sign(userID),
+				Path:     "/",
+				HttpOnly: true,
+				SameSite: http.SameSiteLaxMode,
+			})
+
+			next.ServeHTTP(w, r.WithContext(auth.WithUserID(r.Context(), userID)))
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package middleware
 
 import (
+	"expvar"
+	"strconv"
+
 	chiMiddleware "github.com/go-chi/chi/v5/middleware"
 	"github.com/vlxdisluv/shortener/internal/app/logger"
 	"go.uber.org/zap"
@@ -37,6 +40,10 @@ func newLoggingResponseWriter(w http.ResponseWriter) *loggingResponseWriter {
 	return &loggingResponseWriter{ResponseWriter: w}
 }
 
+// responses counts answered requests by status code, published with the
+// other runtime metrics on the admin listener's /debug/vars.
+var responses = expvar.NewMap("http_responses")
+
 func RequestLogger(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		lrw := newLoggingResponseWriter(w)
@@ -47,6 +54,12 @@ func RequestLogger(next http.Handler) http.Handler {
 
 		requestID := chiMiddleware.GetReqID(r.Context())
 
+		status := lrw.Status()
+		if status == 0 {
+			status = http.StatusOK
+		}
+		responses.Add(strconv.Itoa(status), 1)
+
 		logger.Log.Info("incoming HTTP request",
 			zap.String("request_id", requestID),
 			zap.String("method", r.Method),
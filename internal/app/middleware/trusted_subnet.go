@@ -0,0 +1,24 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+)
+
+// TrustedSubnet lets through requests whose client address, as found by
+// clientIP, is inside subnet. A nil subnet lets nobody through.
+func TrustedSubnet(subnet *net.IPNet, clientIP func(*http.Request) net.IP) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if subnet == nil {
+				http.Error(w, "internal API is disabled, set TRUSTED_SUBNET", http.StatusForbidden)
+				return
+			}
+			if ip := clientIP(r); ip == nil || !subnet.Contains(ip) {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,284 @@
+package policy
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vlxdisluv/shortener/internal/app/logger"
+	"go.uber.org/zap"
+)
+
+type action string
+
+const (
+	actionAllow action = "allow"
+	actionDeny  action = "deny"
+)
+
+type kind string
+
+const (
+	kindHost  kind = "host"
+	kindRegex kind = "regex"
+	kindCIDR  kind = "cidr"
+)
+
+type rule struct {
+	action  action
+	kind    kind
+	pattern string
+	line    int
+
+	re    *regexp.Regexp
+	ipNet *net.IPNet
+}
+
+func (r rule) String() string {
+	return fmt.Sprintf("%s %s %s (line %d)", r.action, r.kind, r.pattern, r.line)
+}
+
+// match reports whether the rule applies to the given URL. Host rules
+// starting with "*." match any subdomain but not the apex domain itself.
+func (r rule) match(raw string, host string, ip net.IP) bool {
+	switch r.kind {
+	case kindHost:
+		if host == "" {
+			return false
+		}
+		if suffix, ok := strings.CutPrefix(r.pattern, "*"); ok {
+			return strings.HasSuffix(host, suffix)
+		}
+		return host == r.pattern
+	case kindRegex:
+		return r.re.MatchString(raw)
+	case kindCIDR:
+		return ip != nil && r.ipNet.Contains(ip)
+	}
+	return false
+}
+
+type ruleSet struct {
+	allow []rule
+	deny  []rule
+}
+
+// Engine decides whether a target URL may be shortened. Rules are read from
+// a text file with one rule per line:
+//
+//	# comment
+//	deny  host  evil.example
+//	deny  host  *.evil.example
+//	deny  regex ^https?://[^/]+/.*\.exe$
+//	deny  cidr  10.0.0.0/8
+//	allow host  example.com
+//
+// Deny rules always win. When at least one allow rule is present, a URL must
+// match one of them to be accepted.
+type Engine struct {
+	path string
+
+	mu    sync.RWMutex
+	rules ruleSet
+
+	modTime time.Time
+	size    int64
+}
+
+func Load(path string) (*Engine, error) {
+	e := &Engine{path: path}
+	if _, err := e.Reload(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// Reload re-reads the rules file if it changed since the last load.
+// On a parse error the previously loaded rules stay in effect.
+func (e *Engine) Reload() (bool, error) {
+	fi, err := os.Stat(e.path)
+	if err != nil {
+		return false, fmt.Errorf("stat policy file: %w", err)
+	}
+
+	e.mu.RLock()
+	unchanged := fi.ModTime().Equal(e.modTime) && fi.Size() == e.size
+	e.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	f, err := os.Open(e.path)
+	if err != nil {
+		return false, fmt.Errorf("open policy file: %w", err)
+	}
+	defer f.Close()
+
+	rules, err := parse(f)
+	if err != nil {
+		return false, err
+	}
+
+	e.mu.Lock()
+	e.rules = rules
+	e.modTime = fi.ModTime()
+	e.size = fi.Size()
+	e.mu.Unlock()
+
+	return true, nil
+}
+
+// Watch polls the rules file and reloads it on change until ctx is done.
+func (e *Engine) Watch(ctx context.Context, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			changed, err := e.Reload()
+			if err != nil {
+				logger.Log.Error("url policy reload failed, keeping previous rules", zap.Error(err))
+				continue
+			}
+			if changed {
+				e.mu.RLock()
+				logger.Log.Info("url policy reloaded",
+					zap.String("path", e.path),
+					zap.Int("allow", len(e.rules.allow)),
+					zap.Int("deny", len(e.rules.deny)),
+				)
+				e.mu.RUnlock()
+			}
+		}
+	}
+}
+
+// Allow reports whether rawURL may be shortened. If not, reason explains
+// which rule rejected it.
+func (e *Engine) Allow(rawURL string) (string, bool) {
+	raw, host, ip, err := target(rawURL)
+	if err != nil {
+		return err.Error(), false
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if r, ok := e.firstMatch(e.rules.deny, raw, host, ip); ok {
+		return "target is blocked by rule " + r.String(), false
+	}
+
+	if len(e.rules.allow) == 0 {
+		return "", true
+	}
+	if _, ok := e.firstMatch(e.rules.allow, raw, host, ip); ok {
+		return "", true
+	}
+	return fmt.Sprintf("host %q is not in the allowlist", host), false
+}
+
+// Disabled reports whether an already stored link matches a deny rule.
+// Allow rules are not applied retroactively, so narrowing the allowlist
+// never breaks existing links.
+func (e *Engine) Disabled(rawURL string) (string, bool) {
+	raw, host, ip, err := target(rawURL)
+	if err != nil {
+		return "", false
+	}
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	if r, ok := e.firstMatch(e.rules.deny, raw, host, ip); ok {
+		return "target is blocked by rule " + r.String(), true
+	}
+	return "", false
+}
+
+func (e *Engine) firstMatch(rules []rule, raw, host string, ip net.IP) (rule, bool) {
+	for _, r := range rules {
+		if r.match(raw, host, ip) {
+			return r, true
+		}
+	}
+	return rule{}, false
+}
+
+func target(rawURL string) (raw string, host string, ip net.IP, err error) {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil {
+		return "", "", nil, fmt.Errorf("malformed url: %w", err)
+	}
+	if u.Host == "" {
+		return "", "", nil, fmt.Errorf("url %q has no host", rawURL)
+	}
+
+	host = strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+	return u.String(), host, net.ParseIP(host), nil
+}
+
+func parse(r io.Reader) (ruleSet, error) {
+	var rs ruleSet
+
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			return ruleSet{}, fmt.Errorf("policy line %d: expected \"<allow|deny> <host|regex|cidr> <pattern>\"", n)
+		}
+
+		rl := rule{action: action(fields[0]), kind: kind(fields[1]), pattern: fields[2], line: n}
+
+		switch rl.kind {
+		case kindHost:
+			rl.pattern = strings.TrimSuffix(strings.ToLower(rl.pattern), ".")
+			if strings.Contains(strings.TrimPrefix(rl.pattern, "*."), "*") {
+				return ruleSet{}, fmt.Errorf("policy line %d: only a leading \"*.\" wildcard is supported", n)
+			}
+		case kindRegex:
+			re, err := regexp.Compile(rl.pattern)
+			if err != nil {
+				return ruleSet{}, fmt.Errorf("policy line %d: %w", n, err)
+			}
+			rl.re = re
+		case kindCIDR:
+			_, ipNet, err := net.ParseCIDR(rl.pattern)
+			if err != nil {
+				return ruleSet{}, fmt.Errorf("policy line %d: %w", n, err)
+			}
+			rl.ipNet = ipNet
+		default:
+			return ruleSet{}, fmt.Errorf("policy line %d: unknown rule kind %q", n, rl.kind)
+		}
+
+		switch rl.action {
+		case actionAllow:
+			rs.allow = append(rs.allow, rl)
+		case actionDeny:
+			rs.deny = append(rs.deny, rl)
+		default:
+			return ruleSet{}, fmt.Errorf("policy line %d: unknown action %q", n, rl.action)
+		}
+	}
+
+	if err := sc.Err(); err != nil {
+		return ruleSet{}, fmt.Errorf("read policy file: %w", err)
+	}
+	return rs, nil
+}
@@ -0,0 +1,99 @@
+package policy
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeRules(t *testing.T, path, rules string) {
+	t.Helper()
+	require.NoError(t, os.WriteFile(path, []byte(rules), 0o600))
+}
+
+func TestEngineAllow(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.txt")
+	writeRules(t, path, `
+# phishing
+deny  host  evil.example
+deny  host  *.phish.example
+deny  regex \.exe$
+deny  cidr  10.0.0.0/8
+`)
+
+	e, err := Load(path)
+	require.NoError(t, err)
+
+	tests := []struct {
+		url     string
+		allowed bool
+	}{
+		{"https://google.com", true},
+		{"https://EVIL.example/login", false},
+		{"https://a.b.phish.example", false},
+		{"https://phish.example", true},
+		{"https://files.example/setup.exe", false},
+		{"http://10.1.2.3/admin", false},
+		{"http://192.168.0.1/", true},
+		{"not a url", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			reason, ok := e.Allow(tt.url)
+			assert.Equal(t, tt.allowed, ok, reason)
+			if !ok {
+				assert.NotEmpty(t, reason)
+			}
+		})
+	}
+}
+
+func TestEngineAllowlist(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.txt")
+	writeRules(t, path, "allow host example.com\nallow host *.example.com\ndeny host bad.example.com\n")
+
+	e, err := Load(path)
+	require.NoError(t, err)
+
+	_, ok := e.Allow("https://example.com/a")
+	assert.True(t, ok)
+	_, ok = e.Allow("https://docs.example.com/a")
+	assert.True(t, ok)
+	_, ok = e.Allow("https://bad.example.com/a")
+	assert.False(t, ok)
+	_, ok = e.Allow("https://other.org/a")
+	assert.False(t, ok)
+
+	_, disabled := e.Disabled("https://other.org/a")
+	assert.False(t, disabled, "allow rules must not disable existing links")
+	_, disabled = e.Disabled("https://bad.example.com/a")
+	assert.True(t, disabled)
+}
+
+func TestEngineReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "policy.txt")
+	writeRules(t, path, "deny host a.example\n")
+
+	e, err := Load(path)
+	require.NoError(t, err)
+
+	_, disabled := e.Disabled("https://b.example")
+	assert.False(t, disabled)
+
+	writeRules(t, path, "deny host a.example\ndeny host b.example\n")
+	changed, err := e.Reload()
+	require.NoError(t, err)
+	assert.True(t, changed)
+
+	_, disabled = e.Disabled("https://b.example")
+	assert.True(t, disabled)
+
+	writeRules(t, path, "deny nonsense b.example c\n")
+	_, err = e.Reload()
+	assert.Error(t, err)
+	_, disabled = e.Disabled("https://b.example")
+	assert.True(t, disabled, "previous rules must stay active after a failed reload")
+}
@@ -0,0 +1,59 @@
+package qr
+
+import (
+	"container/list"
+	"fmt"
+	"sync"
+)
+
+type entry struct {
+	key   string
+	image []byte
+}
+
+// Cache keeps the most recently rendered images so that popular codes are
+// not encoded again on every request.
+type Cache struct {
+	size int
+
+	mu      sync.Mutex
+	order   *list.List
+	entries map[string]*list.Element
+}
+
+func NewCache(size int) *Cache {
+	return &Cache{size: size, order: list.New(), entries: make(map[string]*list.Element)}
+}
+
+// Render returns the cached image for content and o, rendering it on a miss.
+func (c *Cache) Render(content string, o Options) ([]byte, error) {
+	if err := o.Validate(); err != nil {
+		return nil, err
+	}
+	key := fmt.Sprintf("%s|%s|%d|%s|%d|%v|%v", content, o.Format, o.Size, o.Level, o.Margin, o.Foreground, o.Background)
+
+	c.mu.Lock()
+	if el, ok := c.entries[key]; ok {
+		c.order.MoveToFront(el)
+		c.mu.Unlock()
+		return el.Value.(*entry).image, nil
+	}
+	c.mu.Unlock()
+
+	img, err := Render(content, o)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.entries[key]; !ok {
+		c.entries[key] = c.order.PushFront(&entry{key: key, image: img})
+		if c.order.Len() > c.size {
+			oldest := c.order.Back()
+			c.order.Remove(oldest)
+			delete(c.entries, oldest.Value.(*entry).key)
+		}
+	}
+	return img, nil
+}
@@ -0,0 +1,94 @@
+package qr
+
+import (
+	"bytes"
+	"image/color"
+	"image/png"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRender(t *testing.T) {
+	t.Run("png", func(t *testing.T) {
+		o := DefaultOptions()
+		o.Size = 300
+
+		data, err := Render("http://localhost:8080/EwHXdJfB", o)
+		require.NoError(t, err)
+
+		img, err := png.Decode(bytes.NewReader(data))
+		require.NoError(t, err)
+		assert.Equal(t, 300, img.Bounds().Dx())
+		assert.Equal(t, 300, img.Bounds().Dy())
+		// The corner lies in the quiet zone, the finder pattern starts right after it.
+		assert.Equal(t, color.RGBA{R: 0xff, G: 0xff, B: 0xff, A: 0xff}, color.RGBAModel.Convert(img.At(0, 0)))
+	})
+
+	t.Run("svg", func(t *testing.T) {
+		o := DefaultOptions()
+		o.Format = "SVG"
+		o.Foreground = color.RGBA{R: 0x11, G: 0x22, B: 0x33, A: 0xff}
+
+		data, err := Render("http://localhost:8080/EwHXdJfB", o)
+		require.NoError(t, err)
+		svg := string(data)
+		assert.True(t, strings.HasPrefix(svg, "<svg "))
+		assert.Contains(t, svg, `fill="#112233"`)
+	})
+
+	t.Run("invalid options", func(t *testing.T) {
+		for _, o := range []Options{
+			{Format: "gif", Size: DefaultSize, Level: "M"},
+			{Format: PNG, Size: 10, Level: "M"},
+			{Format: PNG, Size: DefaultSize, Level: "X"},
+			{Format: PNG, Size: DefaultSize, Level: "M", Margin: -1},
+		} {
+			_, err := Render("http://localhost:8080/EwHXdJfB", o)
+			assert.Error(t, err, "%+v", o)
+		}
+	})
+}
+
+func TestParseColor(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    color.RGBA
+		wantErr bool
+	}{
+		{in: "#000", want: color.RGBA{A: 0xff}},
+		{in: "ff8000", want: color.RGBA{R: 0xff, G: 0x80, A: 0xff}},
+		{in: "ffffff00", want: color.RGBA{R: 0xff, G: 0xff, B: 0xff}},
+		{in: "zzzzzz", wantErr: true},
+		{in: "12345", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseColor(tt.in)
+			if tt.wantErr {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestCache(t *testing.T) {
+	c := NewCache(1)
+	o := DefaultOptions()
+
+	first, err := c.Render("http://localhost:8080/a", o)
+	require.NoError(t, err)
+	again, err := c.Render("http://localhost:8080/a", o)
+	require.NoError(t, err)
+	assert.Same(t, &first[0], &again[0])
+
+	_, err = c.Render("http://localhost:8080/b", o)
+	require.NoError(t, err)
+	assert.Equal(t, 1, c.order.Len())
+}
@@ -0,0 +1,95 @@
+package realip
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// Resolver finds the visitor's address behind trusted reverse proxies.
+type Resolver struct {
+	trusted []*net.IPNet
+}
+
+// New parses the trusted proxy CIDRs. A bare IP is treated as a /32 or /128.
+func New(trustedProxies []string) (*Resolver, error) {
+	r := &Resolver{}
+	for _, p := range trustedProxies {
+		if !strings.Contains(p, "/") {
+			if ip := net.ParseIP(p); ip != nil && ip.To4() != nil {
+				p += "/32"
+			} else {
+				p += "/128"
+			}
+		}
+		_, ipNet, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("trusted proxy %q: %w", p, err)
+		}
+		r.trusted = append(r.trusted, ipNet)
+	}
+	return r, nil
+}
+
+// ClientIP returns the address of the visitor. X-Forwarded-For and X-Real-IP
+// are only honoured when the direct peer is a trusted proxy, and the
+// forwarded chain is walked from the right so a client cannot spoof it.
+func (r *Resolver) ClientIP(req *http.Request) net.IP {
+	peer := remoteIP(req)
+	if r == nil || !r.isTrusted(peer) {
+		return peer
+	}
+
+	if xff := req.Header.Get("X-Forwarded-For"); xff != "" {
+		hops := strings.Split(xff, ",")
+		for i := len(hops) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(hops[i]))
+			if ip == nil {
+				break
+			}
+			if !r.isTrusted(ip) {
+				return ip
+			}
+		}
+	}
+
+	if ip := net.ParseIP(strings.TrimSpace(req.Header.Get("X-Real-IP"))); ip != nil {
+		return ip
+	}
+	return peer
+}
+
+// RealIP returns the peer address, or X-Real-IP when the peer is a trusted
+// proxy. Unlike ClientIP it never reads X-Forwarded-For: it decides access,
+// and X-Real-IP is the one header the proxy sets rather than appends to.
+func (r *Resolver) RealIP(req *http.Request) net.IP {
+	peer := remoteIP(req)
+	if r == nil || !r.isTrusted(peer) {
+		return peer
+	}
+	if ip := net.ParseIP(strings.TrimSpace(req.Header.Get("X-Real-IP"))); ip != nil {
+		return ip
+	}
+	return peer
+}
+
+func (r *Resolver) isTrusted(ip net.IP) bool {
+	if ip == nil {
+		return false
+	}
+	for _, n := range r.trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func remoteIP(req *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(req.RemoteAddr)
+	if err != nil {
+		host = req.RemoteAddr
+	}
+	return net.ParseIP(host)
+}
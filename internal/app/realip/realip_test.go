@@ -0,0 +1,74 @@
+package realip
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientIP(t *testing.T) {
+	r, err := New([]string{"10.0.0.0/8", "192.168.1.1"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    string
+		xReal  string
+		want   string
+	}{
+		{name: "direct client", remote: "203.0.113.7:5000", want: "203.0.113.7"},
+		{name: "untrusted peer cannot spoof", remote: "203.0.113.7:5000", xff: "1.2.3.4", want: "203.0.113.7"},
+		{name: "trusted proxy", remote: "10.1.1.1:80", xff: "198.51.100.2", want: "198.51.100.2"},
+		{name: "spoofed left-most hop is ignored", remote: "10.1.1.1:80", xff: "1.2.3.4, 198.51.100.2, 192.168.1.1", want: "198.51.100.2"},
+		{name: "x-real-ip from trusted proxy", remote: "192.168.1.1:80", xReal: "198.51.100.9", want: "198.51.100.9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remote
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if tt.xReal != "" {
+				req.Header.Set("X-Real-IP", tt.xReal)
+			}
+			assert.Equal(t, tt.want, r.ClientIP(req).String())
+		})
+	}
+}
+
+func TestRealIP(t *testing.T) {
+	r, err := New([]string{"10.0.0.0/8"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name   string
+		remote string
+		xff    string
+		xReal  string
+		want   string
+	}{
+		{name: "direct client", remote: "203.0.113.7:5000", xReal: "10.1.1.1", want: "203.0.113.7"},
+		{name: "x-real-ip from trusted proxy", remote: "10.1.1.1:80", xReal: "198.51.100.9", want: "198.51.100.9"},
+		{name: "x-forwarded-for is ignored", remote: "10.1.1.1:80", xff: "198.51.100.2", want: "10.1.1.1"},
+		{name: "x-real-ip wins over x-forwarded-for", remote: "10.1.1.1:80", xff: "198.51.100.2", xReal: "198.51.100.9", want: "198.51.100.9"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/", nil)
+			req.RemoteAddr = tt.remote
+			if tt.xff != "" {
+				req.Header.Set("X-Forwarded-For", tt.xff)
+			}
+			if tt.xReal != "" {
+				req.Header.Set("X-Real-IP", tt.xReal)
+			}
+			assert.Equal(t, tt.want, r.RealIP(req).String())
+		})
+	}
+}
@@ -0,0 +1,46 @@
+package rotation
+
+import (
+	"fmt"
+	"hash/fnv"
+
+	"github.com/vlxdisluv/shortener/internal/app/storage"
+)
+
+// Pick returns the index of the destination assigned to the visitor key.
+// The same key always gets the same destination as long as the weights
+// do not change.
+func Pick(destinations []storage.Destination, key string) int {
+	var total uint64
+	for _, d := range destinations {
+		total += uint64(d.Weight)
+	}
+	if total == 0 {
+		return 0
+	}
+
+	h := fnv.New64a()
+	_, _ = h.Write([]byte(key))
+	bucket := h.Sum64() % total
+
+	for i, d := range destinations {
+		if bucket < uint64(d.Weight) {
+			return i
+		}
+		bucket -= uint64(d.Weight)
+	}
+	return len(destinations) - 1
+}
+
+// Validate checks that every destination has a URL and a positive weight.
+func Validate(destinations []storage.Destination) error {
+	for i, d := range destinations {
+		if d.URL == "" {
+			return fmt.Errorf("destination %d: url is required", i)
+		}
+		if d.Weight <= 0 {
+			return fmt.Errorf("destination %d: weight must be positive", i)
+		}
+	}
+	return nil
+}
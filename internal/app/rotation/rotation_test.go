@@ -0,0 +1,32 @@
+package rotation
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vlxdisluv/shortener/internal/app/storage"
+)
+
+func TestPick(t *testing.T) {
+	destinations := []storage.Destination{
+		{URL: "https://example.com/a", Weight: 80},
+		{URL: "https://example.com/b", Weight: 20},
+	}
+
+	t.Run("sticky", func(t *testing.T) {
+		first := Pick(destinations, "visitor-1")
+		for i := 0; i < 10; i++ {
+			assert.Equal(t, first, Pick(destinations, "visitor-1"))
+		}
+	})
+
+	t.Run("weighted split", func(t *testing.T) {
+		counts := make([]int, len(destinations))
+		for i := 0; i < 10000; i++ {
+			counts[Pick(destinations, fmt.Sprintf("visitor-%d", i))]++
+		}
+		assert.InDelta(t, 8000, counts[0], 300)
+		assert.InDelta(t, 2000, counts[1], 300)
+	})
+}
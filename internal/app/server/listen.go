@@ -0,0 +1,98 @@
+package server
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vlxdisluv/shortener/internal/app/logger"
+	"go.uber.org/zap"
+)
+
+// shutdownTimeout bounds how long in-flight requests may take to finish once
+// the server is asked to stop.
+const shutdownTimeout = 10 * time.Second
+
+// listener is one of the HTTP servers run by Start.
+type listener struct {
+	name string
+	addr string // host:port or unix:/path/to.sock
+	srv  *http.Server
+	tls  bool // serve with srv.TLSConfig
+}
+
+// listen opens addr. A socket file left behind by a previous run is removed
+// first; any other file at the path is left alone and makes listen fail.
+func listen(addr string) (net.Listener, error) {
+	path, ok := strings.CutPrefix(addr, "unix:")
+	if !ok {
+		return net.Listen("tcp", addr)
+	}
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&fs.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	return net.Listen("unix", path)
+}
+
+// serve runs every listener until ctx is done or one of them fails, then
+// shuts them all down, letting in-flight requests finish.
+func serve(ctx context.Context, ls []listener) error {
+	nls := make([]net.Listener, 0, len(ls))
+	for _, l := range ls {
+		nl, err := listen(l.addr)
+		if err != nil {
+			for _, nl := range nls {
+				nl.Close()
+			}
+			return fmt.Errorf("%s listener: %w", l.name, err)
+		}
+		nls = append(nls, nl)
+	}
+
+	errc := make(chan error, len(ls))
+	for i, l := range ls {
+		go func() {
+			var err error
+			if l.tls {
+				err = l.srv.ServeTLS(nls[i], "", "")
+			} else {
+				err = l.srv.Serve(nls[i])
+			}
+			if !errors.Is(err, http.ErrServerClosed) {
+				errc <- fmt.Errorf("%s listener: %w", l.name, err)
+			}
+		}()
+	}
+
+	var err error
+	select {
+	case <-ctx.Done():
+		logger.Log.Info("server shutting down")
+	case err = <-errc:
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	for _, l := range ls {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := l.srv.Shutdown(shutdownCtx); err != nil {
+				logger.Log.Warn("listener did not shut down cleanly", zap.String("listener", l.name), zap.Error(err))
+			}
+		}()
+	}
+	wg.Wait()
+	return err
+}
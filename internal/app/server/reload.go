@@ -0,0 +1,200 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+
+	"github.com/vlxdisluv/shortener/config"
+	"github.com/vlxdisluv/shortener/internal/app/handlers"
+	"github.com/vlxdisluv/shortener/internal/app/logger"
+	"github.com/vlxdisluv/shortener/internal/app/policy"
+	"go.uber.org/zap"
+)
+
+// reloadable are the settings a running server picks up on reload; the
+// others need a restart. applyReloadable must copy the same fields.
+var reloadable = map[string]bool{
+	"LOG_LEVEL":               true,
+	"BASE_URL":                true,
+	"ALIAS_DOMAINS":           true,
+	"REDIRECT_TYPE":           true,
+	"COMING_SOON_URL":         true,
+	"URL_POLICY_FILE":         true,
+	"POLICY_RELOAD_INTERVAL":  true,
+	"IMPORT_CHUNK_SIZE":       true,
+	"PASSWORD_MAX_ATTEMPTS":   true,
+	"PASSWORD_ATTEMPT_WINDOW": true,
+	"QR_CACHE_SIZE":           true,
+}
+
+func applyReloadable(cur, next *config.Config) *config.Config {
+	c := *cur
+	c.LogLevel = next.LogLevel
+	c.BaseURL = next.BaseURL
+	c.AliasDomains = next.AliasDomains
+	c.RedirectType = next.RedirectType
+	c.ComingSoonURL = next.ComingSoonURL
+	c.URLPolicyFile = next.URLPolicyFile
+	c.PolicyReloadInterval = next.PolicyReloadInterval
+	c.ImportChunkSize = next.ImportChunkSize
+	c.PasswordMaxAttempts = next.PasswordMaxAttempts
+	c.PasswordAttemptWindow = next.PasswordAttemptWindow
+	c.QRCacheSize = next.QRCacheSize
+	return &c
+}
+
+// handlerOptions are the reloadable handler settings taken from cfg, except
+// those in stateOptions.
+func handlerOptions(cfg *config.Config, pw *policyWatch) []handlers.Option {
+	opts := []handlers.Option{
+		handlers.WithOwnDomains(cfg.BaseURL, cfg.AliasDomains),
+		handlers.WithBaseURL(cfg.BaseURL),
+		handlers.WithDefaultRedirectType(cfg.RedirectType),
+		handlers.WithComingSoonURL(cfg.ComingSoonURL),
+		handlers.WithImportChunkSize(cfg.ImportChunkSize),
+	}
+	if pw != nil {
+		opts = append(opts, handlers.WithURLPolicy(pw.engine))
+	} else {
+		opts = append(opts, handlers.WithURLPolicy(nil))
+	}
+	return opts
+}
+
+// stateOptions are the reloadable settings whose handler parts keep state:
+// the password attempt counts and the rendered QR codes. A reload applies
+// them only for the settings in changed, so it does not drop that state.
+// A nil changed applies all of them.
+func stateOptions(cfg *config.Config, changed map[string]bool) []handlers.Option {
+	var opts []handlers.Option
+	if changed == nil || changed["PASSWORD_MAX_ATTEMPTS"] || changed["PASSWORD_ATTEMPT_WINDOW"] {
+		opts = append(opts, handlers.WithPasswordThrottle(cfg.PasswordMaxAttempts, cfg.PasswordAttemptWindow))
+	}
+	if changed == nil || changed["QR_CACHE_SIZE"] {
+		opts = append(opts, handlers.WithQRCacheSize(cfg.QRCacheSize))
+	}
+	return opts
+}
+
+// policyWatch is a loaded URL policy together with the goroutine that
+// reloads it when the file changes.
+type policyWatch struct {
+	engine *policy.Engine
+	cancel context.CancelFunc
+}
+
+// watchPolicy loads the rules of cfg.URLPolicyFile, nil if none is set.
+func watchPolicy(ctx context.Context, cfg *config.Config) (*policyWatch, error) {
+	if cfg.URLPolicyFile == "" {
+		return nil, nil
+	}
+	pe, err := policy.Load(cfg.URLPolicyFile)
+	if err != nil {
+		return nil, err
+	}
+	// The watch also ends with the server's ctx.
+	ctx, cancel := context.WithCancel(ctx)
+	go pe.Watch(ctx, cfg.PolicyReloadInterval)
+	return &policyWatch{engine: pe, cancel: cancel}, nil
+}
+
+func (pw *policyWatch) stop() {
+	if pw != nil {
+		pw.cancel()
+	}
+}
+
+// reloader re-reads the configuration and applies the reloadable settings
+// to the running server.
+type reloader struct {
+	ctx  context.Context
+	load func() (*config.Config, error)
+	h    *handlers.ShortURLHandler
+
+	mu     sync.Mutex
+	cfg    *config.Config // the settings in effect
+	policy *policyWatch
+}
+
+// Reload applies what changed since the last load. Settings that need a
+// restart are reported and keep their current values. Nothing is applied if
+// the new configuration is invalid.
+func (rl *reloader) Reload() (applied, restartRequired []config.Change, err error) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	next, err := rl.load()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	changes := config.Diff(rl.cfg, next)
+	changed := make(map[string]bool)
+	policyChanged := false
+	for _, c := range changes {
+		if !reloadable[c.Setting] {
+			restartRequired = append(restartRequired, c)
+			continue
+		}
+		applied = append(applied, c)
+		changed[c.Setting] = true
+		if c.Setting == "URL_POLICY_FILE" || c.Setting == "POLICY_RELOAD_INTERVAL" {
+			policyChanged = true
+		}
+	}
+
+	// Load the new rules before changing anything, so that a broken file
+	// leaves the server as it was.
+	pw := rl.policy
+	if policyChanged {
+		if pw, err = watchPolicy(rl.ctx, next); err != nil {
+			return nil, nil, fmt.Errorf("load url policy: %w", err)
+		}
+	}
+	if err := logger.SetLevel(next.LogLevel); err != nil {
+		if policyChanged {
+			pw.stop()
+		}
+		return nil, nil, err
+	}
+
+	rl.h.Reconfigure(append(handlerOptions(next, pw), stateOptions(next, changed)...)...)
+	if policyChanged {
+		rl.policy.stop()
+		rl.policy = pw
+	}
+	rl.cfg = applyReloadable(rl.cfg, next)
+
+	for _, c := range applied {
+		logger.Log.Info("config setting changed",
+			zap.String("setting", c.Setting), zap.String("old", c.Old), zap.String("new", c.New))
+	}
+	for _, c := range restartRequired {
+		logger.Log.Warn("config setting changed, restart to apply it",
+			zap.String("setting", c.Setting), zap.String("old", c.Old), zap.String("new", c.New))
+	}
+	logger.Log.Info("config reloaded", zap.Int("applied", len(applied)), zap.Int("restartRequired", len(restartRequired)))
+	return applied, restartRequired, nil
+}
+
+// reloadOnHangup reloads the configuration on every SIGHUP until ctx is done.
+func (rl *reloader) reloadOnHangup(ctx context.Context) {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	defer signal.Stop(hup)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-hup:
+			if _, _, err := rl.Reload(); err != nil {
+				logger.Log.Error("config reload failed, keeping current configuration", zap.Error(err))
+			}
+		}
+	}
+}
@@ -0,0 +1,18 @@
+package server
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vlxdisluv/shortener/config"
+)
+
+func TestStateOptions(t *testing.T) {
+	cfg := config.Default()
+
+	assert.Len(t, stateOptions(cfg, nil), 2, "startup applies all")
+	assert.Empty(t, stateOptions(cfg, map[string]bool{"BASE_URL": true, "LOG_LEVEL": true}),
+		"unrelated changes must keep the password attempts and the QR cache")
+	assert.Len(t, stateOptions(cfg, map[string]bool{"PASSWORD_ATTEMPT_WINDOW": true}), 1)
+	assert.Len(t, stateOptions(cfg, map[string]bool{"QR_CACHE_SIZE": true, "PASSWORD_MAX_ATTEMPTS": true}), 2)
+}
@@ -2,29 +2,89 @@ package server
 
 import (
 	"context"
+	"fmt"
+	"net"
 	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 
 	"github.com/go-chi/chi/v5"
 	chiMiddleware "github.com/go-chi/chi/v5/middleware"
 	storagefactory "github.com/vlxdisluv/shortener/internal/app/storage/factory"
 
 	"github.com/vlxdisluv/shortener/config"
+	"github.com/vlxdisluv/shortener/internal/app/auth"
+	"github.com/vlxdisluv/shortener/internal/app/geo"
 	"github.com/vlxdisluv/shortener/internal/app/handlers"
 	"github.com/vlxdisluv/shortener/internal/app/logger"
 	customMiddleware "github.com/vlxdisluv/shortener/internal/app/middleware"
+	"github.com/vlxdisluv/shortener/internal/app/realip"
 
 	"go.uber.org/zap"
 )
 
-func Start(cfg *config.Config) {
-	storage, err := storagefactory.New(context.Background(), cfg)
+// Start serves the public and, if configured, the admin listener until
+// SIGINT or SIGTERM, then shuts them down gracefully.
+func Start(cfg *config.Config) error {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	storage, err := storagefactory.New(ctx, cfg)
 	if err != nil {
-		logger.Log.Error("server failed to init storage", zap.Error(err))
-		return
+		return fmt.Errorf("init storage: %w", err)
 	}
 	defer storage.Close(context.Background())
 
-	h := handlers.NewShortURLHandler(storage)
+	if !handlers.IsRedirectType(cfg.RedirectType) {
+		return fmt.Errorf("invalid default redirect type %d", cfg.RedirectType)
+	}
+
+	realIP, err := realip.New(cfg.TrustedProxies)
+	if err != nil {
+		return fmt.Errorf("invalid trusted proxies: %w", err)
+	}
+
+	var trustedSubnet *net.IPNet
+	if cfg.TrustedSubnet != "" {
+		if _, trustedSubnet, err = net.ParseCIDR(cfg.TrustedSubnet); err != nil {
+			return fmt.Errorf("invalid trusted subnet: %w", err)
+		}
+	}
+
+	pw, err := watchPolicy(ctx, cfg)
+	if err != nil {
+		return fmt.Errorf("load url policy: %w", err)
+	}
+
+	opts := append(handlerOptions(cfg, pw), stateOptions(cfg, nil)...)
+	opts = append(opts, handlers.WithClientIPResolver(realIP))
+
+	if cfg.GeoIPDatabase != "" {
+		geoDB, err := geo.Open(cfg.GeoIPDatabase)
+		if err != nil {
+			return fmt.Errorf("open geoip database: %w", err)
+		}
+		defer geoDB.Close()
+		opts = append(opts, handlers.WithCountryResolver(geoDB))
+	}
+
+	authSecret := cfg.AuthSecret
+	if authSecret == "" {
+		if authSecret, err = auth.NewSecret(); err != nil {
+			return fmt.Errorf("generate auth secret: %w", err)
+		}
+		logger.Log.Warn("AUTH_SECRET is not set, user cookies will not survive a restart")
+	}
+	signer := auth.NewSigner(authSecret)
+
+	opts = append(opts, handlers.WithSigner(signer.Derive("link-unlock")))
+
+	h := handlers.NewShortURLHandler(storage, opts...)
+	rl := &reloader{ctx: ctx, load: config.Reload, h: h, cfg: cfg, policy: pw}
+	go rl.reloadOnHangup(ctx)
+	rh := handlers.NewReloadHandler(rl)
+	ch := handlers.NewCampaignHandler(storage)
 	hh := handlers.NewHealthHandler(storage.HealthCheck())
 
 	r := chi.NewRouter()
@@ -32,20 +92,96 @@ func Start(cfg *config.Config) {
 	r.Use(chiMiddleware.Recoverer)
 	r.Use(customMiddleware.RequestLogger)
 	r.Use(customMiddleware.GzipCompressor)
+	if cfg.TLSEnabled() && cfg.HSTSMaxAge > 0 {
+		r.Use(customMiddleware.HSTS(cfg.HSTSMaxAge))
+	}
 
-	r.Post("/", h.CreateShortURLFromRawBody)
 	r.Get("/{hash}", h.GetShortURL)
-	r.Post("/api/shorten", h.CreateShortURLFromJSON)
-	r.Post("/api/shorten/batch", h.CreateShortURLsBatch)
-	r.Get("/ping", hh.DBHealth)
+	r.Get("/{hash}/*", h.GetShortURL)
+	r.Get("/{hash}+", h.PreviewShortURL)
+	r.Post("/{hash}", h.UnlockShortURL)
+	r.Post("/{hash}/*", h.UnlockShortURL)
+
+	// QR codes are public, unlike the rest of /api/urls. GetShortURL serves
+	// them under /{hash}/qr too, except for passthrough links.
+	r.Get("/api/urls/{hash}/qr", h.GetQRCode)
+
+	r.Group(func(r chi.Router) {
+		r.Use(customMiddleware.Authenticate(signer))
+
+		r.Post("/", h.CreateShortURLFromRawBody)
+		r.Post("/api/shorten", h.CreateShortURLFromJSON)
+		r.Post("/api/shorten/batch", h.CreateShortURLsBatch)
+		r.Post("/api/import", h.ImportURLs)
+		r.Get("/api/user/urls", h.GetUserURLs)
+		r.Get("/api/urls", h.ListURLs)
+		r.Get("/api/urls/{hash}", h.GetLinkInfo)
+		r.Patch("/api/urls/{hash}", h.UpdateShortURL)
+		r.Get("/api/urls/{hash}/history", h.GetHistory)
+		r.Post("/api/urls/{hash}/history/{id}/rollback", h.RollbackShortURL)
+		r.Get("/api/urls/{hash}/targeting", h.GetTargeting)
+		r.Put("/api/urls/{hash}/targeting", h.UpdateTargeting)
+		r.Get("/api/urls/{hash}/schedule", h.GetSchedule)
+		r.Put("/api/urls/{hash}/schedule", h.UpdateSchedule)
+		r.Get("/api/urls/{hash}/stats", h.GetLinkStats)
+	})
+
+	// Campaign templates are global, so only the admin API may change them.
+	r.Get("/api/campaigns", ch.ListCampaigns)
+	r.Get("/api/campaigns/{name}", ch.GetCampaign)
+
+	// Dashboards reach the statistics through the proxy, so they are served
+	// here and guarded by the client address instead of the admin listener.
+	r.With(customMiddleware.TrustedSubnet(trustedSubnet, realIP.RealIP)).
+		Get("/api/internal/stats", h.GetInternalStats)
+
+	// Without a separate admin listener the internal endpoints stay on the
+	// public one, except profiling and metrics, which are never public.
+	admin := r
+	if cfg.AdminAddr != "" {
+		admin = chi.NewRouter()
+		admin.Use(chiMiddleware.RequestID)
+		admin.Use(chiMiddleware.Recoverer)
+		admin.Use(customMiddleware.RequestLogger)
+
+		admin.Mount("/debug", chiMiddleware.Profiler())
+	}
+
+	admin.Group(func(r chi.Router) {
+		r.Use(customMiddleware.RequireAdmin(cfg.AdminToken))
+
+		r.Get("/api/export", h.ExportURLs)
+		r.Post("/api/admin/reload", rh.ReloadConfig)
+		r.Post("/api/campaigns", ch.CreateCampaign)
+		r.Put("/api/campaigns/{name}", ch.UpdateCampaign)
+		r.Delete("/api/campaigns/{name}", ch.DeleteCampaign)
+		r.Method(http.MethodGet, "/api/admin/log-level", logger.LevelHandler())
+		r.Method(http.MethodPut, "/api/admin/log-level", logger.LevelHandler())
+	})
+	admin.Get("/ping", hh.DBHealth)
+
+	public := listener{name: "public", addr: cfg.Addr, srv: &http.Server{Handler: r}, tls: cfg.TLSEnabled()}
+	if public.tls {
+		if public.srv.TLSConfig, err = tlsConfig(ctx, cfg); err != nil {
+			return fmt.Errorf("load tls certificate: %w", err)
+		}
+	}
+	listeners := []listener{public}
+	if cfg.AdminAddr != "" {
+		listeners = append(listeners, listener{name: "admin", addr: cfg.AdminAddr, srv: &http.Server{Handler: admin}})
+	}
+	if public.tls && cfg.HTTPRedirectAddr != "" {
+		listeners = append(listeners, listener{name: "https redirect", addr: cfg.HTTPRedirectAddr,
+			srv: &http.Server{Handler: redirectToHTTPS(cfg.Addr)}})
+	}
 
 	logger.Log.Info("Server started successfully",
 		zap.String("address", cfg.Addr),
+		zap.String("adminAddress", cfg.AdminAddr),
 		zap.String("baseURL", cfg.BaseURL),
 		zap.String("logLevel", cfg.LogLevel),
+		zap.Bool("tls", cfg.TLSEnabled()),
 	)
 
-	if err := http.ListenAndServe(cfg.Addr, r); err != nil {
-		logger.Log.Fatal("server failed to start", zap.Error(err))
-	}
+	return serve(ctx, listeners)
 }
@@ -1,5 +1,10 @@
 package shortener
 
+import (
+	"math"
+	"strings"
+)
+
 const (
 	// alphabet58 is the base58 alphabet without ambiguous characters
 	alphabet58 = "123456789ABCDEFGHJKLMNPQRSTUVWXYZabcdefghijkmnopqrstuvwxyz"
@@ -38,3 +43,25 @@ func Generate(num uint64, length int) string {
 
 	return padLeft(string(chars), length, alphabet58[0])
 }
+
+// IsGenerated reports whether s only uses the characters of generated hashes.
+func IsGenerated(s string) bool {
+	return s != "" && strings.Trim(s, alphabet58) == ""
+}
+
+// Decode returns the counter value a generated hash was made from. It fails
+// for hashes that Generate cannot produce, such as custom aliases.
+func Decode(hash string) (uint64, bool) {
+	if len(hash) < 7 || !IsGenerated(hash) {
+		return 0, false
+	}
+	var num uint64
+	for i := 0; i < len(hash); i++ {
+		digit := uint64(strings.IndexByte(alphabet58, hash[i]))
+		if num > (math.MaxUint64-digit)/base58 {
+			return 0, false
+		}
+		num = num*base58 + digit
+	}
+	return num, true
+}
@@ -14,19 +14,45 @@ import (
 )
 
 type Storage struct {
-	short   storage.ShortURLRepository
-	counter storage.CounterRepository
-	hc      storage.HealthCheckRepository
+	short     storage.ShortURLRepository
+	counter   storage.CounterRepository
+	campaigns storage.CampaignRepository
+	clicks    storage.ClickRepository
+	revisions storage.RevisionRepository
+	hc        storage.HealthCheckRepository
 
 	unitOfWork storage.UnitOfWork
 
 	closer func(context.Context)
 }
 
-func New(ctx context.Context, cfg *config.Config) (*Storage, error) {
+// Option configures New.
+type Option func(*options)
+
+type options struct {
+	readOnly bool
+}
+
+// ReadOnly tells New that the caller only reads. The file storage is then
+// not locked, so it can be read while the server runs.
+func ReadOnly() Option {
+	return func(o *options) { o.readOnly = true }
+}
+
+// New opens the storage configured by cfg. The file storage is locked
+// against other processes until Close unless ReadOnly is given; a second
+// writer fails with file.ErrLocked.
+func New(ctx context.Context, cfg *config.Config, opts ...Option) (*Storage, error) {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
 	if cfg.DatabaseDSN != "" {
-		if err := postgres.RunMigrations(ctx, cfg.DatabaseDSN); err != nil {
-			return nil, fmt.Errorf("run migrations: %w", err)
+		if cfg.AutoMigrate {
+			if err := postgres.RunMigrations(ctx, cfg.DatabaseDSN); err != nil {
+				return nil, fmt.Errorf("run migrations: %w", err)
+			}
 		}
 
 		poolConfig, err := pgxpool.ParseConfig(cfg.DatabaseDSN)
@@ -51,6 +77,24 @@ func New(ctx context.Context, cfg *config.Config) (*Storage, error) {
 			return nil, fmt.Errorf("create pg counter repo: %w", err)
 		}
 
+		campaigns, err := postgres.NewCampaignRepository(pool)
+		if err != nil {
+			logger.Log.Error("server failed to init pg campaign repository", zap.Error(err))
+			return nil, fmt.Errorf("create pg campaign repo: %w", err)
+		}
+
+		clicks, err := postgres.NewClickRepository(pool)
+		if err != nil {
+			logger.Log.Error("server failed to init pg click repository", zap.Error(err))
+			return nil, fmt.Errorf("create pg click repo: %w", err)
+		}
+
+		revisions, err := postgres.NewRevisionRepository(pool)
+		if err != nil {
+			logger.Log.Error("server failed to init pg revision repository", zap.Error(err))
+			return nil, fmt.Errorf("create pg revision repo: %w", err)
+		}
+
 		hc, err := postgres.NewHealthCheckerRepository(pool)
 		if err != nil {
 			logger.Log.Error("server failed to init pg health checker repository", zap.Error(err))
@@ -62,13 +106,46 @@ func New(ctx context.Context, cfg *config.Config) (*Storage, error) {
 		return &Storage{
 			short:      short,
 			counter:    counter,
+			campaigns:  campaigns,
+			clicks:     clicks,
+			revisions:  revisions,
 			hc:         hc,
 			unitOfWork: uow,
 			closer:     func(context.Context) { pool.Close() },
 		}, nil
 	}
 
-	short, err := file.NewShortURLRepository(cfg.FileStoragePath)
+	if o.readOnly {
+		return newFile(cfg)
+	}
+
+	lock, err := file.Lock(cfg.FileStoragePath)
+	if err != nil {
+		return nil, err
+	}
+	s, err := newFile(cfg)
+	if err != nil {
+		lock.Close()
+		return nil, err
+	}
+	closeFiles := s.closer
+	s.closer = func(ctx context.Context) {
+		closeFiles(ctx)
+		if err := lock.Close(); err != nil {
+			logger.Log.Warn("file storage unlock failed", zap.Error(err))
+		}
+	}
+	return s, nil
+}
+
+func newFile(cfg *config.Config) (*Storage, error) {
+	clicks, err := file.NewClickRepository(cfg.FileStoragePath + ".clicks")
+	if err != nil {
+		logger.Log.Error("server failed to init file click repository", zap.Error(err))
+		return nil, fmt.Errorf("create file click repo: %w", err)
+	}
+
+	short, err := file.NewShortURLRepository(cfg.FileStoragePath, clicks)
 	if err != nil {
 		logger.Log.Error("server failed to init file short url repository", zap.Error(err))
 		return nil, fmt.Errorf("create file short url repo: %w", err)
@@ -81,6 +158,18 @@ func New(ctx context.Context, cfg *config.Config) (*Storage, error) {
 		return nil, fmt.Errorf("create file counter repo: %w", err)
 	}
 
+	campaigns, err := file.NewCampaignRepository(cfg.FileStoragePath + ".campaigns")
+	if err != nil {
+		logger.Log.Error("server failed to init file campaign repository", zap.Error(err))
+		return nil, fmt.Errorf("create file campaign repo: %w", err)
+	}
+
+	revisions, err := file.NewRevisionRepository(cfg.FileStoragePath + ".revisions")
+	if err != nil {
+		logger.Log.Error("server failed to init file revision repository", zap.Error(err))
+		return nil, fmt.Errorf("create file revision repo: %w", err)
+	}
+
 	hc, err := file.NewHealthCheckerRepository()
 	if err != nil {
 		logger.Log.Error("server failed to init file health checker repository", zap.Error(err))
@@ -92,6 +181,9 @@ func New(ctx context.Context, cfg *config.Config) (*Storage, error) {
 	return &Storage{
 		short:      short,
 		counter:    counter,
+		campaigns:  campaigns,
+		clicks:     clicks,
+		revisions:  revisions,
 		unitOfWork: noopUow,
 		hc:         hc,
 		closer: func(context.Context) {
@@ -101,6 +193,15 @@ func New(ctx context.Context, cfg *config.Config) (*Storage, error) {
 			if err := counter.Close(); err != nil {
 				logger.Log.Warn("file counter repo close failed", zap.Error(err))
 			}
+			if err := campaigns.Close(); err != nil {
+				logger.Log.Warn("file campaign repo close failed", zap.Error(err))
+			}
+			if err := clicks.Close(); err != nil {
+				logger.Log.Warn("file click repo close failed", zap.Error(err))
+			}
+			if err := revisions.Close(); err != nil {
+				logger.Log.Warn("file revision repo close failed", zap.Error(err))
+			}
 		},
 	}, nil
 }
@@ -109,6 +210,12 @@ func (s *Storage) ShortURLs() storage.ShortURLRepository { return s.short }
 
 func (s *Storage) Counters() storage.CounterRepository { return s.counter }
 
+func (s *Storage) Campaigns() storage.CampaignRepository { return s.campaigns }
+
+func (s *Storage) Clicks() storage.ClickRepository { return s.clicks }
+
+func (s *Storage) Revisions() storage.RevisionRepository { return s.revisions }
+
 func (s *Storage) HealthCheck() storage.HealthCheckRepository { return s.hc }
 
 func (s *Storage) UnitOfWork() storage.UnitOfWork { return s.unitOfWork }
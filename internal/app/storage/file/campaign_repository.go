@@ -0,0 +1,138 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+
+	"github.com/vlxdisluv/shortener/internal/app/logger"
+	"github.com/vlxdisluv/shortener/internal/app/storage"
+	"github.com/vlxdisluv/shortener/internal/app/storage/file/internal/filestore"
+	"go.uber.org/zap"
+)
+
+type CampaignRepository struct {
+	mu        sync.RWMutex
+	campaigns map[string]storage.UTM
+	fileStore *filestore.Store
+}
+
+// campaignEntry is appended on every change; the last entry for a name wins.
+type campaignEntry struct {
+	Name    string      `json:"name"`
+	UTM     storage.UTM `json:"utm"`
+	Deleted bool        `json:"deleted,omitempty"`
+}
+
+func NewCampaignRepository(path string) (*CampaignRepository, error) {
+	fs, err := filestore.LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &CampaignRepository{
+		campaigns: make(map[string]storage.UTM),
+		fileStore: fs,
+	}
+
+	for {
+		raw, err := fs.ReadRaw()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			_ = fs.Close()
+			return nil, err
+		}
+
+		var e campaignEntry
+		if err := json.Unmarshal(raw, &e); err != nil || e.Name == "" {
+			logger.Log.Warn("campaigns: skipping invalid entry", zap.Binary("fileRaw", raw))
+			continue
+		}
+
+		if e.Deleted {
+			delete(r.campaigns, e.Name)
+			continue
+		}
+		r.campaigns[e.Name] = e.UTM
+	}
+
+	return r, nil
+}
+
+func (r *CampaignRepository) Create(_ context.Context, c *storage.Campaign) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.campaigns[c.Name]; exists {
+		return storage.ErrConflict
+	}
+	return r.write(campaignEntry{Name: c.Name, UTM: c.UTM})
+}
+
+func (r *CampaignRepository) Update(_ context.Context, c *storage.Campaign) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.campaigns[c.Name]; !exists {
+		return storage.ErrNotFound
+	}
+	return r.write(campaignEntry{Name: c.Name, UTM: c.UTM})
+}
+
+func (r *CampaignRepository) Get(_ context.Context, name string) (*storage.Campaign, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	utm, ok := r.campaigns[name]
+	if !ok {
+		return nil, storage.ErrNotFound
+	}
+	return &storage.Campaign{Name: name, UTM: utm}, nil
+}
+
+func (r *CampaignRepository) List(_ context.Context) ([]storage.Campaign, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	campaigns := make([]storage.Campaign, 0, len(r.campaigns))
+	for name, utm := range r.campaigns {
+		campaigns = append(campaigns, storage.Campaign{Name: name, UTM: utm})
+	}
+	sort.Slice(campaigns, func(i, j int) bool { return campaigns[i].Name < campaigns[j].Name })
+	return campaigns, nil
+}
+
+func (r *CampaignRepository) Delete(_ context.Context, name string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.campaigns[name]; !exists {
+		return storage.ErrNotFound
+	}
+	return r.write(campaignEntry{Name: name, Deleted: true})
+}
+
+// write persists e and applies it to the in-memory map. Callers hold mu.
+func (r *CampaignRepository) write(e campaignEntry) error {
+	if err := r.fileStore.Append(e); err != nil {
+		return err
+	}
+	if err := r.fileStore.Sync(); err != nil {
+		return err
+	}
+
+	if e.Deleted {
+		delete(r.campaigns, e.Name)
+	} else {
+		r.campaigns[e.Name] = e.UTM
+	}
+	return nil
+}
+
+func (r *CampaignRepository) Close() error {
+	return r.fileStore.Close()
+}
@@ -0,0 +1,171 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/vlxdisluv/shortener/internal/app/logger"
+	"github.com/vlxdisluv/shortener/internal/app/storage"
+	"github.com/vlxdisluv/shortener/internal/app/storage/file/internal/filestore"
+	"go.uber.org/zap"
+)
+
+// ClickRepository appends every click to a log file and keeps per-link and
+// per-day counters in memory. Clicks are not fsynced one by one: losing the last
+// few on a crash is acceptable for statistics.
+type ClickRepository struct {
+	mu        sync.RWMutex
+	stats     map[string]*storage.LinkStats
+	daily     map[time.Time]int64 // clicks by UTC day
+	fileStore *filestore.Store
+	path      string
+}
+
+type clickEntry struct {
+	Hash    string    `json:"hash"`
+	Variant string    `json:"variant,omitempty"`
+	Country string    `json:"country,omitempty"`
+	Time    time.Time `json:"time"`
+}
+
+func NewClickRepository(path string) (*ClickRepository, error) {
+	fs, err := filestore.LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &ClickRepository{
+		stats:     make(map[string]*storage.LinkStats),
+		daily:     make(map[time.Time]int64),
+		fileStore: fs,
+		path:      path,
+	}
+
+	err = readClicks(fs, func(c storage.Click) error {
+		r.count(c)
+		return nil
+	})
+	if err != nil {
+		_ = fs.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+func readClicks(fs *filestore.Store, fn func(storage.Click) error) error {
+	for {
+		raw, err := fs.ReadRaw()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		var e clickEntry
+		if err := json.Unmarshal(raw, &e); err != nil || e.Hash == "" {
+			logger.Log.Warn("clicks: skipping invalid entry", zap.Binary("fileRaw", raw))
+			continue
+		}
+		if err := fn(storage.Click{Hash: e.Hash, Variant: e.Variant, Country: e.Country, Time: e.Time}); err != nil {
+			return err
+		}
+	}
+}
+
+func (r *ClickRepository) Record(_ context.Context, c storage.Click) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if err := r.fileStore.Append(clickEntry{Hash: c.Hash, Variant: c.Variant, Country: c.Country, Time: c.Time}); err != nil {
+		return err
+	}
+	r.count(c)
+	return nil
+}
+
+// count adds c to the in-memory counters. Callers hold mu.
+func (r *ClickRepository) count(c storage.Click) {
+	s, ok := r.stats[c.Hash]
+	if !ok {
+		s = &storage.LinkStats{Variants: make(map[string]int64), Countries: make(map[string]int64)}
+		r.stats[c.Hash] = s
+	}
+	s.Clicks++
+	if c.Variant != "" {
+		s.Variants[c.Variant]++
+	}
+	if c.Country != "" {
+		s.Countries[c.Country]++
+	}
+	r.daily[utcDay(c.Time)]++
+}
+
+func utcDay(t time.Time) time.Time {
+	return t.UTC().Truncate(24 * time.Hour)
+}
+
+func (r *ClickRepository) Stats(_ context.Context, hash string) (*storage.LinkStats, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stats := &storage.LinkStats{Variants: make(map[string]int64), Countries: make(map[string]int64)}
+	if s, ok := r.stats[hash]; ok {
+		stats.Clicks = s.Clicks
+		for variant, n := range s.Variants {
+			stats.Variants[variant] = n
+		}
+		for country, n := range s.Countries {
+			stats.Countries[country] = n
+		}
+	}
+	return stats, nil
+}
+
+// CountSince counts whole UTC days, since is rounded down to midnight.
+func (r *ClickRepository) CountSince(_ context.Context, since time.Time) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	from := utcDay(since)
+	var n int64
+	for day, clicks := range r.daily {
+		if !day.Before(from) {
+			n += clicks
+		}
+	}
+	return n, nil
+}
+
+// Each reads the log again, only the counters are kept in memory.
+func (r *ClickRepository) Each(ctx context.Context, fn func(storage.Click) error) error {
+	fs, err := filestore.LoadFile(r.path)
+	if err != nil {
+		return err
+	}
+	defer fs.Close()
+
+	return readClicks(fs, func(c storage.Click) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		return fn(c)
+	})
+}
+
+func (r *ClickRepository) Count(hash string) int64 {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if s, ok := r.stats[hash]; ok {
+		return s.Clicks
+	}
+	return 0
+}
+
+func (r *ClickRepository) Close() error {
+	return r.fileStore.Close()
+}
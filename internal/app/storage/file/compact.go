@@ -0,0 +1,138 @@
+package file
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/vlxdisluv/shortener/internal/app/storage"
+)
+
+// CompactStats describes the link file before and after Compact.
+type CompactStats struct {
+	LinesBefore int
+	Links       int
+	BytesBefore int64
+	BytesAfter  int64
+}
+
+// Compact rewrites the link file at path so that it holds one line per link,
+// dropping superseded versions and deleted links, and shrinks the counter
+// file next to it to its last value. The files are replaced atomically; no
+// server may have them open while Compact runs.
+func Compact(path string) (CompactStats, error) {
+	var stats CompactStats
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return stats, err
+	}
+	stats.BytesBefore = info.Size()
+	if stats.LinesBefore, err = countLines(path); err != nil {
+		return stats, err
+	}
+
+	repo, err := NewShortURLRepository(path, nil)
+	if err != nil {
+		return stats, err
+	}
+	var buf bytes.Buffer
+	err = repo.Each(context.Background(), func(u *storage.ShortURL) error {
+		line, err := EncodeEntry(*u)
+		if err != nil {
+			return err
+		}
+		buf.Write(line)
+		stats.Links++
+		return nil
+	})
+	if closeErr := repo.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return stats, err
+	}
+	if err := replaceFile(path, buf.Bytes(), info.Mode()); err != nil {
+		return stats, err
+	}
+	stats.BytesAfter = int64(buf.Len())
+
+	seqPath := path + ".seq"
+	seqInfo, err := os.Stat(seqPath)
+	if errors.Is(err, os.ErrNotExist) {
+		return stats, nil
+	}
+	if err != nil {
+		return stats, err
+	}
+	counter, err := NewCounterRepository(seqPath)
+	if err != nil {
+		return stats, err
+	}
+	value := counter.value
+	if err := counter.Close(); err != nil {
+		return stats, err
+	}
+	line, err := json.Marshal(counterEntry{Value: value})
+	if err != nil {
+		return stats, err
+	}
+	return stats, replaceFile(seqPath, append(line, '\n'), seqInfo.Mode())
+}
+
+func countLines(path string) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	n := 0
+	r := bufio.NewReader(f)
+	for {
+		_, err := r.ReadSlice('\n')
+		if err == nil {
+			n++
+			continue
+		}
+		if errors.Is(err, bufio.ErrBufferFull) {
+			continue
+		}
+		if err == io.EOF {
+			return n, nil
+		}
+		return n, err
+	}
+}
+
+// replaceFile writes data to a temporary file next to path and renames it
+// over path, so a crash leaves either the old or the new content.
+func replaceFile(path string, data []byte, mode os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".compact-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -65,6 +65,30 @@ func (r *CounterRepository) Next(_ context.Context) (uint64, error) {
 	return r.value, nil
 }
 
+func (r *CounterRepository) Current(_ context.Context) (uint64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.value, nil
+}
+
+func (r *CounterRepository) AtLeast(_ context.Context, value uint64) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.value >= value {
+		return nil
+	}
+	if err := r.fileStore.Append(counterEntry{Value: value}); err != nil {
+		return err
+	}
+	if err := r.fileStore.Sync(); err != nil {
+		return err
+	}
+	r.value = value
+	return nil
+}
+
 func (r *CounterRepository) Close() error {
 	return r.fileStore.Close()
 }
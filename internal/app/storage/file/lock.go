@@ -0,0 +1,41 @@
+package file
+
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+// ErrLocked is returned by Lock while another process holds the store.
+var ErrLocked = errors.New("file storage is in use by another process, e.g. the server")
+
+// StoreLock keeps other processes from writing the store at a path. Every
+// process keeps its own counter and index in memory, so two writers would
+// hand out the same hashes and overwrite each other's links.
+type StoreLock struct {
+	f *os.File
+}
+
+// Lock takes an exclusive lock on the store at path, held in path+".lock"
+// until Close or until the process exits.
+func Lock(path string) (*StoreLock, error) {
+	lockPath := path + ".lock"
+	f, err := os.OpenFile(lockPath, os.O_RDWR|os.O_CREATE, 0666)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f); err != nil {
+		f.Close()
+		if errors.Is(err, ErrLocked) {
+			return nil, fmt.Errorf("%s: %w", lockPath, err)
+		}
+		return nil, fmt.Errorf("lock %s: %w", lockPath, err)
+	}
+	return &StoreLock{f: f}, nil
+}
+
+// Close releases the lock. The lock file is left in place, removing it
+// could let two processes lock different files of the same name.
+func (l *StoreLock) Close() error {
+	return l.f.Close()
+}
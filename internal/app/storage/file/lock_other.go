@@ -0,0 +1,9 @@
+//go:build !unix
+
+package file
+
+import "os"
+
+// lockFile does nothing where flock is not available; the store is then
+// not protected against a second writer.
+func lockFile(*os.File) error { return nil }
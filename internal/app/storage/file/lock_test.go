@@ -0,0 +1,26 @@
+//go:build unix
+
+package file
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLock(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.json")
+
+	lock, err := Lock(path)
+	require.NoError(t, err)
+
+	_, err = Lock(path)
+	assert.ErrorIs(t, err, ErrLocked)
+
+	require.NoError(t, lock.Close())
+	lock, err = Lock(path)
+	require.NoError(t, err)
+	require.NoError(t, lock.Close())
+}
@@ -0,0 +1,188 @@
+package file
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vlxdisluv/shortener/internal/app/logger"
+	"github.com/vlxdisluv/shortener/internal/app/storage"
+	"github.com/vlxdisluv/shortener/internal/app/storage/file/internal/filestore"
+	"go.uber.org/zap"
+)
+
+// RevisionRepository is an append-only log of link changes.
+type RevisionRepository struct {
+	mu        sync.RWMutex
+	revisions map[string][]storage.Revision // oldest first
+	ids       map[int64]bool
+	lastID    int64
+	fileStore *filestore.Store
+}
+
+type revisionEntry struct {
+	ID     int64            `json:"id"`
+	Hash   string           `json:"hash"`
+	OldURL string           `json:"old_url"`
+	NewURL string           `json:"new_url"`
+	UserID string           `json:"user_id,omitempty"`
+	Time   time.Time        `json:"time"`
+	Before storage.ShortURL `json:"before"`
+}
+
+func NewRevisionRepository(path string) (*RevisionRepository, error) {
+	fs, err := filestore.LoadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	r := &RevisionRepository{
+		revisions: make(map[string][]storage.Revision),
+		ids:       make(map[int64]bool),
+		fileStore: fs,
+	}
+
+	for {
+		raw, err := fs.ReadRaw()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			_ = fs.Close()
+			return nil, err
+		}
+
+		var e revisionEntry
+		if err := json.Unmarshal(raw, &e); err != nil || e.Hash == "" || e.ID == 0 {
+			logger.Log.Warn("revisions: skipping invalid entry", zap.Binary("fileRaw", raw))
+			continue
+		}
+		r.add(e)
+	}
+
+	return r, nil
+}
+
+func (r *RevisionRepository) Record(_ context.Context, rev *storage.Revision) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	e := revisionEntry{
+		ID:     r.lastID + 1,
+		Hash:   rev.Hash,
+		OldURL: rev.OldURL,
+		NewURL: rev.NewURL,
+		UserID: rev.UserID,
+		Time:   time.Now().UTC(),
+		Before: rev.Before,
+	}
+	if err := r.append(e); err != nil {
+		return err
+	}
+
+	rev.ID, rev.Time = e.ID, e.Time
+	return nil
+}
+
+func (r *RevisionRepository) Restore(_ context.Context, rev *storage.Revision) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.ids[rev.ID] {
+		return storage.ErrConflict
+	}
+	return r.append(revisionEntry{
+		ID:     rev.ID,
+		Hash:   rev.Hash,
+		OldURL: rev.OldURL,
+		NewURL: rev.NewURL,
+		UserID: rev.UserID,
+		Time:   rev.Time,
+		Before: rev.Before,
+	})
+}
+
+// append writes e to the log and the index. Callers hold mu.
+func (r *RevisionRepository) append(e revisionEntry) error {
+	if err := r.fileStore.Append(e); err != nil {
+		return err
+	}
+	if err := r.fileStore.Sync(); err != nil {
+		return err
+	}
+	r.add(e)
+	return nil
+}
+
+func (r *RevisionRepository) List(_ context.Context, hash string) ([]storage.Revision, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	stored := r.revisions[hash]
+	revisions := make([]storage.Revision, len(stored))
+	for i, rev := range stored {
+		revisions[len(stored)-1-i] = rev
+	}
+	return revisions, nil
+}
+
+func (r *RevisionRepository) Get(_ context.Context, hash string, id int64) (*storage.Revision, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	for _, rev := range r.revisions[hash] {
+		if rev.ID == id {
+			return &rev, nil
+		}
+	}
+	return nil, storage.ErrNotFound
+}
+
+func (r *RevisionRepository) Each(ctx context.Context, fn func(*storage.Revision) error) error {
+	r.mu.RLock()
+	var revisions []storage.Revision
+	for _, stored := range r.revisions {
+		revisions = append(revisions, stored...)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].ID < revisions[j].ID })
+	for i := range revisions {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := fn(&revisions[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// add applies e to the in-memory index. Callers hold mu.
+func (r *RevisionRepository) add(e revisionEntry) {
+	r.revisions[e.Hash] = append(r.revisions[e.Hash], storage.Revision{
+		ID:     e.ID,
+		Hash:   e.Hash,
+		OldURL: e.OldURL,
+		NewURL: e.NewURL,
+		UserID: e.UserID,
+		Time:   e.Time,
+		Before: e.Before,
+	})
+	r.ids[e.ID] = true
+	if e.ID > r.lastID {
+		r.lastID = e.ID
+	}
+}
+
+func (r *RevisionRepository) Close() error {
+	return r.fileStore.Close()
+}
+
+// no-op
+func (r *RevisionRepository) WithTx(_ storage.Tx) storage.RevisionRepository {
+	return r
+}
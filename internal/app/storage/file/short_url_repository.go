@@ -3,8 +3,13 @@ package file
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
+	"slices"
+	"sort"
+	"strings"
 	"sync"
+	"time"
 
 	"github.com/vlxdisluv/shortener/internal/app/logger"
 	"github.com/vlxdisluv/shortener/internal/app/storage"
@@ -12,26 +17,107 @@ import (
 	"go.uber.org/zap"
 )
 
+// ClickCounter reports how many clicks were recorded for a link. The file
+// ClickRepository implements it.
+type ClickCounter interface {
+	Count(hash string) int64
+}
+
 type ShortURLRepository struct {
-	mu        sync.RWMutex
-	hashMap   map[string]string
-	fileStore *filestore.Store
+	mu         sync.RWMutex
+	hashMap    map[string]storage.ShortURL
+	byOriginal map[string]string // original URL -> hash
+	fileStore  *filestore.Store
+	clicks     ClickCounter
 }
 
 type entry struct {
-	Hash string `json:"hash"`
-	URL  string `json:"url"`
+	Hash         string       `json:"hash"`
+	URL          string       `json:"url"`
+	RedirectType int          `json:"redirect_type,omitempty"`
+	Passthrough  bool         `json:"passthrough,omitempty"`
+	UTM          *storage.UTM `json:"utm,omitempty"`
+	Campaign     string       `json:"campaign,omitempty"`
+
+	Targeting    []storage.TargetingRule `json:"targeting,omitempty"`
+	Destinations []storage.Destination   `json:"destinations,omitempty"`
+	PasswordHash string                  `json:"password_hash,omitempty"`
+	MaxClicks    int                     `json:"max_clicks,omitempty"`
+	Uses         int                     `json:"uses,omitempty"`
+	ValidFrom    *time.Time              `json:"valid_from,omitempty"`
+	ValidUntil   *time.Time              `json:"valid_until,omitempty"`
+	Title        string                  `json:"title,omitempty"`
+	Description  string                  `json:"description,omitempty"`
+	Notes        string                  `json:"notes,omitempty"`
+	Tags         []string                `json:"tags,omitempty"`
+	UserID       string                  `json:"user_id,omitempty"`
+	CreatedAt    time.Time               `json:"created_at"`
+	// Deleted marks a tombstone that removes the link when the file is
+	// loaded.
+	Deleted bool `json:"deleted,omitempty"`
+}
+
+func newEntry(u storage.ShortURL) entry {
+	return entry{
+		Hash:         u.Hash,
+		URL:          u.Original,
+		RedirectType: u.RedirectType,
+		Passthrough:  u.Passthrough,
+		UTM:          u.UTM,
+		Campaign:     u.Campaign,
+		Targeting:    u.Targeting,
+		Destinations: u.Destinations,
+		PasswordHash: u.PasswordHash,
+		MaxClicks:    u.MaxClicks,
+		Uses:         u.Uses,
+		ValidFrom:    u.ValidFrom,
+		ValidUntil:   u.ValidUntil,
+		Title:        u.Title,
+		Description:  u.Description,
+		Notes:        u.Notes,
+		Tags:         u.Tags,
+		UserID:       u.UserID,
+		CreatedAt:    u.CreatedAt,
+	}
+}
+
+func (e entry) shortURL() storage.ShortURL {
+	return storage.ShortURL{
+		Hash:         e.Hash,
+		Original:     e.URL,
+		RedirectType: e.RedirectType,
+		Passthrough:  e.Passthrough,
+		UTM:          e.UTM,
+		Campaign:     e.Campaign,
+		Targeting:    e.Targeting,
+		Destinations: e.Destinations,
+		PasswordHash: e.PasswordHash,
+		MaxClicks:    e.MaxClicks,
+		Uses:         e.Uses,
+		ValidFrom:    e.ValidFrom,
+		ValidUntil:   e.ValidUntil,
+		Title:        e.Title,
+		Description:  e.Description,
+		Notes:        e.Notes,
+		Tags:         e.Tags,
+		UserID:       e.UserID,
+		CreatedAt:    e.CreatedAt,
+	}
 }
 
-func NewShortURLRepository(path string) (*ShortURLRepository, error) {
+// NewShortURLRepository loads the links stored at path. clicks may be nil,
+// then every link reports zero clicks.
+func NewShortURLRepository(path string, clicks ClickCounter) (*ShortURLRepository, error) {
 	fs, err := filestore.LoadFile(path)
 	if err != nil {
 		return nil, err
 	}
 
 	r := &ShortURLRepository{
-		hashMap:   make(map[string]string),
-		fileStore: fs,
+		hashMap:    make(map[string]storage.ShortURL),
+		byOriginal: make(map[string]string),
+		fileStore:  fs,
+		clicks:     clicks,
 	}
 
 	for {
@@ -51,55 +137,328 @@ func NewShortURLRepository(path string) (*ShortURLRepository, error) {
 			continue
 		}
 
+		if e.Deleted {
+			delete(r.hashMap, e.Hash)
+			continue
+		}
+
 		if e.URL == "" || e.Hash == "" {
 			logger.Log.Warn("skipping incomplete entry: %q", zap.Binary("fileRaw", raw))
 			continue
 		}
 
-		r.hashMap[e.Hash] = e.URL
+		r.hashMap[e.Hash] = e.shortURL()
+	}
+
+	for hash, u := range r.hashMap {
+		r.byOriginal[u.Original] = hash
 	}
 
 	return r, nil
 }
 
-func (r *ShortURLRepository) Save(_ context.Context, hash, original string) error {
+func (r *ShortURLRepository) Save(_ context.Context, u *storage.ShortURL) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	if _, exists := r.hashMap[hash]; exists {
+	if _, exists := r.hashMap[u.Hash]; exists {
 		return storage.ErrConflict
 	}
 
-	r.hashMap[hash] = original
-	if err := r.fileStore.Append(entry{Hash: hash, URL: original}); err != nil {
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = time.Now().UTC()
+	}
+	r.hashMap[u.Hash] = *u
+	if _, exists := r.byOriginal[u.Original]; !exists {
+		r.byOriginal[u.Original] = u.Hash
+	}
+	if err := r.fileStore.Append(newEntry(*u)); err != nil {
 		return err
 	}
 	return r.fileStore.Sync()
 }
 
-func (r *ShortURLRepository) Get(_ context.Context, hash string) (string, error) {
+func (r *ShortURLRepository) Get(_ context.Context, hash string) (*storage.ShortURL, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	url, ok := r.hashMap[hash]
+	u, ok := r.hashMap[hash]
 	if !ok {
-		return "", storage.ErrNotFound
+		return nil, storage.ErrNotFound
 	}
-	return url, nil
+	u.Clicks = r.clickCount(hash)
+	return &u, nil
 }
 
-func (r *ShortURLRepository) GetByOriginal(_ context.Context, original string) (string, error) {
+// Update appends the new state of the link to the file; on load the last
+// entry for a hash wins.
+func (r *ShortURLRepository) Update(_ context.Context, u *storage.ShortURL) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	old, exists := r.hashMap[u.Hash]
+	if !exists {
+		return storage.ErrNotFound
+	}
+
+	updated := *u
+	updated.UserID = old.UserID
+	updated.Uses = old.Uses
+	updated.CreatedAt = old.CreatedAt
+
+	if err := r.fileStore.Append(newEntry(updated)); err != nil {
+		return err
+	}
+	if err := r.fileStore.Sync(); err != nil {
+		return err
+	}
+	r.hashMap[u.Hash] = updated
+	if old.Original != updated.Original {
+		if r.byOriginal[old.Original] == u.Hash {
+			delete(r.byOriginal, old.Original)
+		}
+		if _, exists := r.byOriginal[updated.Original]; !exists {
+			r.byOriginal[updated.Original] = u.Hash
+		}
+	}
+	return nil
+}
+
+func (r *ShortURLRepository) ListByUser(_ context.Context, userID string, f storage.LinkFilter) ([]storage.ShortURL, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	search := strings.ToLower(f.Search)
+
+	var links []storage.ShortURL
+	for _, u := range r.hashMap {
+		if u.UserID != userID {
+			continue
+		}
+		if f.Tag != "" && !slices.Contains(u.Tags, f.Tag) {
+			continue
+		}
+		if search != "" && !strings.Contains(strings.ToLower(u.Title), search) &&
+			!strings.Contains(strings.ToLower(u.Description), search) &&
+			!strings.Contains(strings.ToLower(u.Notes), search) {
+			continue
+		}
+		u.Clicks = r.clickCount(u.Hash)
+		links = append(links, u)
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].Hash < links[j].Hash })
+	return links, nil
+}
+
+// List filters and sorts the whole map for every page, which is fine for
+// the sizes the file backend is meant for.
+func (r *ShortURLRepository) List(_ context.Context, q storage.ListQuery) ([]storage.ShortURL, error) {
+	less, err := listOrder(q.Sort)
+	if err != nil {
+		return nil, err
+	}
+
+	r.mu.RLock()
+	links := r.matching(q)
+	r.mu.RUnlock()
+
+	if q.Desc {
+		sort.Slice(links, func(i, j int) bool { return less(links[j], links[i]) })
+	} else {
+		sort.Slice(links, func(i, j int) bool { return less(links[i], links[j]) })
+	}
+
+	start := 0
+	if q.After != nil {
+		after := storage.ShortURL{Hash: q.After.Hash, CreatedAt: q.After.CreatedAt, Clicks: q.After.Clicks}
+		start = sort.Search(len(links), func(i int) bool {
+			if q.Desc {
+				return less(links[i], after)
+			}
+			return less(after, links[i])
+		})
+	}
+	links = links[start:]
+	if len(links) > q.Limit {
+		links = links[:q.Limit]
+	}
+	return links, nil
+}
+
+func (r *ShortURLRepository) Count(_ context.Context, q storage.ListQuery) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return int64(len(r.matching(q))), nil
+}
+
+func (r *ShortURLRepository) CountAll(_ context.Context) (int64, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	return int64(len(r.hashMap)), nil
+}
+
+func (r *ShortURLRepository) CountUsers(_ context.Context) (int64, error) {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	// TODO can be improved from O(n) to O(1)
-	for hash, url := range r.hashMap {
-		if url == original {
-			return hash, nil
+	users := make(map[string]bool)
+	for _, u := range r.hashMap {
+		if u.UserID != "" {
+			users[u.UserID] = true
+		}
+	}
+	return int64(len(users)), nil
+}
+
+// matching returns the links selected by the filters of q. Callers hold mu.
+func (r *ShortURLRepository) matching(q storage.ListQuery) []storage.ShortURL {
+	search := strings.ToLower(q.Search)
+
+	var links []storage.ShortURL
+	for _, u := range r.hashMap {
+		if u.UserID != q.UserID {
+			continue
 		}
+		if search != "" && !strings.Contains(strings.ToLower(u.Original), search) {
+			continue
+		}
+		if q.CreatedFrom != nil && u.CreatedAt.Before(*q.CreatedFrom) {
+			continue
+		}
+		if q.CreatedTo != nil && !u.CreatedAt.Before(*q.CreatedTo) {
+			continue
+		}
+		u.Clicks = r.clickCount(u.Hash)
+		links = append(links, u)
+	}
+	return links
+}
+
+// listOrder returns the ascending order of a sort, with the hash as tie
+// breaker like the postgres indexes.
+func listOrder(sortBy string) (func(a, b storage.ShortURL) bool, error) {
+	switch sortBy {
+	case storage.SortHash:
+		return func(a, b storage.ShortURL) bool { return a.Hash < b.Hash }, nil
+	case storage.SortCreatedAt:
+		return func(a, b storage.ShortURL) bool {
+			if !a.CreatedAt.Equal(b.CreatedAt) {
+				return a.CreatedAt.Before(b.CreatedAt)
+			}
+			return a.Hash < b.Hash
+		}, nil
+	case storage.SortClicks:
+		return func(a, b storage.ShortURL) bool {
+			if a.Clicks != b.Clicks {
+				return a.Clicks < b.Clicks
+			}
+			return a.Hash < b.Hash
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown sort order %q", sortBy)
+}
+
+func (r *ShortURLRepository) clickCount(hash string) int64 {
+	if r.clicks == nil {
+		return 0
+	}
+	return r.clicks.Count(hash)
+}
+
+// Delete appends a tombstone for the link.
+func (r *ShortURLRepository) Delete(_ context.Context, hash string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, exists := r.hashMap[hash]
+	if !exists {
+		return storage.ErrNotFound
+	}
+	if err := r.fileStore.Append(entry{Hash: hash, Deleted: true}); err != nil {
+		return err
+	}
+	if err := r.fileStore.Sync(); err != nil {
+		return err
+	}
+	delete(r.hashMap, hash)
+	if r.byOriginal[u.Original] == hash {
+		delete(r.byOriginal, u.Original)
+	}
+	return nil
+}
+
+// Each works on a copy of the links, so fn may take its time without
+// blocking writers.
+func (r *ShortURLRepository) Each(ctx context.Context, fn func(*storage.ShortURL) error) error {
+	r.mu.RLock()
+	links := make([]storage.ShortURL, 0, len(r.hashMap))
+	for _, u := range r.hashMap {
+		links = append(links, u)
+	}
+	r.mu.RUnlock()
+
+	sort.Slice(links, func(i, j int) bool { return links[i].Hash < links[j].Hash })
+	for i := range links {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		links[i].Clicks = r.clickCount(links[i].Hash)
+		if err := fn(&links[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// EncodeEntry returns u in the line format of the links file, including
+// the trailing newline.
+func EncodeEntry(u storage.ShortURL) ([]byte, error) {
+	b, err := json.Marshal(newEntry(u))
+	if err != nil {
+		return nil, err
+	}
+	return append(b, '\n'), nil
+}
+
+// Consume appends the link with the new use count, so a limited link adds
+// at most MaxClicks entries to the file.
+func (r *ShortURLRepository) Consume(_ context.Context, hash string) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	u, exists := r.hashMap[hash]
+	if !exists {
+		return 0, storage.ErrNotFound
+	}
+	if u.MaxClicks == 0 {
+		return -1, nil
+	}
+	if u.Uses >= u.MaxClicks {
+		return 0, storage.ErrExhausted
+	}
+
+	u.Uses++
+	if err := r.fileStore.Append(newEntry(u)); err != nil {
+		return 0, err
+	}
+	if err := r.fileStore.Sync(); err != nil {
+		return 0, err
+	}
+	r.hashMap[hash] = u
+	return u.MaxClicks - u.Uses, nil
+}
+
+func (r *ShortURLRepository) GetByOriginal(_ context.Context, original string) (string, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	hash, ok := r.byOriginal[original]
+	if !ok {
+		return "", storage.ErrNotFound
 	}
-	
-	return "", storage.ErrNotFound
+	return hash, nil
 }
 
 func (r *ShortURLRepository) Close() error {
@@ -0,0 +1,63 @@
+package file
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vlxdisluv/shortener/internal/app/storage"
+)
+
+func TestConsumeConcurrent(t *testing.T) {
+	const maxClicks, clicks = 10, 100
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "db.json")
+
+	repo, err := NewShortURLRepository(path, nil)
+	require.NoError(t, err)
+	require.NoError(t, repo.Save(ctx, &storage.ShortURL{Hash: "EwHXdJfB", Original: "https://example.com", MaxClicks: maxClicks}))
+
+	var mu sync.Mutex
+	var served, exhausted int
+	left := make(map[int]bool)
+	var wg sync.WaitGroup
+	for i := 0; i < clicks; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			n, err := repo.Consume(ctx, "EwHXdJfB")
+
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				served++
+				left[n] = true
+			case errors.Is(err, storage.ErrExhausted):
+				exhausted++
+			default:
+				t.Errorf("consume: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(t, maxClicks, served)
+	assert.Equal(t, clicks-maxClicks, exhausted)
+	assert.Len(t, left, maxClicks, "every served click sees a different count")
+	require.NoError(t, repo.Close())
+
+	repo, err = NewShortURLRepository(path, nil)
+	require.NoError(t, err)
+	defer repo.Close()
+
+	u, err := repo.Get(ctx, "EwHXdJfB")
+	require.NoError(t, err)
+	assert.Equal(t, maxClicks, u.Uses, "the use count survives a reload")
+	_, err = repo.Consume(ctx, "EwHXdJfB")
+	assert.ErrorIs(t, err, storage.ErrExhausted)
+}
@@ -0,0 +1,92 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgerrcode"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/vlxdisluv/shortener/internal/app/storage"
+)
+
+type CampaignRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewCampaignRepository(pool *pgxpool.Pool) (*CampaignRepository, error) {
+	return &CampaignRepository{pool: pool}, nil
+}
+
+func (r *CampaignRepository) Create(ctx context.Context, c *storage.Campaign) error {
+	const q = `INSERT INTO campaigns(name, utm) VALUES ($1, $2)`
+	if _, err := r.pool.Exec(ctx, q, c.Name, c.UTM); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgerrcode.IsIntegrityConstraintViolation(pgErr.Code) {
+			return storage.ErrConflict
+		}
+		return err
+	}
+	return nil
+}
+
+func (r *CampaignRepository) Update(ctx context.Context, c *storage.Campaign) error {
+	const q = `UPDATE campaigns SET utm = $2 WHERE name = $1`
+	tag, err := r.pool.Exec(ctx, q, c.Name, c.UTM)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+func (r *CampaignRepository) Get(ctx context.Context, name string) (*storage.Campaign, error) {
+	const q = `SELECT name, utm FROM campaigns WHERE name = $1`
+	var c storage.Campaign
+	if err := r.pool.QueryRow(ctx, q, name).Scan(&c.Name, &c.UTM); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+func (r *CampaignRepository) List(ctx context.Context) ([]storage.Campaign, error) {
+	const q = `SELECT name, utm FROM campaigns ORDER BY name`
+	rows, err := r.pool.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var campaigns []storage.Campaign
+	for rows.Next() {
+		var c storage.Campaign
+		if err := rows.Scan(&c.Name, &c.UTM); err != nil {
+			return nil, err
+		}
+		campaigns = append(campaigns, c)
+	}
+	return campaigns, rows.Err()
+}
+
+func (r *CampaignRepository) Delete(ctx context.Context, name string) error {
+	const q = `DELETE FROM campaigns WHERE name = $1`
+	tag, err := r.pool.Exec(ctx, q, name)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+// Close is a no-op, the pool is owned by the storage factory.
+func (r *CampaignRepository) Close() error {
+	return nil
+}
@@ -0,0 +1,83 @@
+package postgres
+
+import (
+	"context"
+	"time"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/vlxdisluv/shortener/internal/app/storage"
+)
+
+type ClickRepository struct {
+	pool *pgxpool.Pool
+}
+
+func NewClickRepository(pool *pgxpool.Pool) (*ClickRepository, error) {
+	return &ClickRepository{pool: pool}, nil
+}
+
+// Record also bumps short_urls.views, which the link listing sorts by.
+func (r *ClickRepository) Record(ctx context.Context, c storage.Click) error {
+	const q = `WITH click AS (
+			INSERT INTO clicks(hash, variant, country, created_at) VALUES ($1, $2, $3, $4)
+		)
+		UPDATE short_urls SET views = views + 1 WHERE hash = $1`
+	_, err := r.pool.Exec(ctx, q, c.Hash, c.Variant, c.Country, c.Time)
+	return err
+}
+
+func (r *ClickRepository) Stats(ctx context.Context, hash string) (*storage.LinkStats, error) {
+	const q = `SELECT variant, country, count(*) FROM clicks WHERE hash = $1 GROUP BY variant, country`
+	rows, err := r.pool.Query(ctx, q, hash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	stats := &storage.LinkStats{Variants: make(map[string]int64), Countries: make(map[string]int64)}
+	for rows.Next() {
+		var variant, country string
+		var n int64
+		if err := rows.Scan(&variant, &country, &n); err != nil {
+			return nil, err
+		}
+		stats.Clicks += n
+		if variant != "" {
+			stats.Variants[variant] += n
+		}
+		if country != "" {
+			stats.Countries[country] += n
+		}
+	}
+	return stats, rows.Err()
+}
+
+func (r *ClickRepository) CountSince(ctx context.Context, since time.Time) (int64, error) {
+	var n int64
+	err := r.pool.QueryRow(ctx, `SELECT count(*) FROM clicks WHERE created_at >= $1`, since).Scan(&n)
+	return n, err
+}
+
+func (r *ClickRepository) Each(ctx context.Context, fn func(storage.Click) error) error {
+	rows, err := r.pool.Query(ctx, `SELECT hash, variant, country, created_at FROM clicks ORDER BY id`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c storage.Click
+		if err := rows.Scan(&c.Hash, &c.Variant, &c.Country, &c.Time); err != nil {
+			return err
+		}
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Close is a no-op, the pool is owned by the storage factory.
+func (r *ClickRepository) Close() error {
+	return nil
+}
@@ -45,6 +45,24 @@ func (r *CounterRepository) Next(ctx context.Context) (uint64, error) {
 	return id, nil
 }
 
+func (r *CounterRepository) Current(ctx context.Context) (uint64, error) {
+	const q = `SELECT CASE WHEN is_called THEN last_value ELSE last_value - 1 END FROM url_counter`
+	var value int64
+	if err := r.ex.QueryRow(ctx, q).Scan(&value); err != nil {
+		return 0, err
+	}
+	return uint64(value), nil
+}
+
+func (r *CounterRepository) AtLeast(ctx context.Context, value uint64) error {
+	// Before the first nextval last_value is the start value, which has not
+	// been handed out yet.
+	const q = `SELECT setval('url_counter', $1)
+		WHERE $1 > (SELECT CASE WHEN is_called THEN last_value ELSE last_value - 1 END FROM url_counter)`
+	_, err := r.ex.Exec(ctx, q, int64(value))
+	return err
+}
+
 // Close implements the Repository interface.
 // For the Postgres repository this is a no-op, because the repository
 // does not own the database connection pool. The pool must be closed
@@ -3,7 +3,13 @@ package postgres
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/golang-migrate/migrate/v4"
 	mgpg "github.com/golang-migrate/migrate/v4/database/postgres"
@@ -12,30 +18,127 @@ import (
 	appmigrations "github.com/vlxdisluv/shortener"
 )
 
+const migrationsDir = "db/migrations"
+
+// MigrationState is the schema version of a database next to the newest
+// version embedded in the binary.
+type MigrationState struct {
+	// Version is zero when no migration has been applied.
+	Version uint
+	// Dirty is set when a migration failed halfway; fix the schema by hand
+	// and force the version.
+	Dirty  bool
+	Latest uint
+}
+
 func RunMigrations(_ context.Context, dsn string) error {
+	m, closeFn, err := newMigrate(dsn)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
+		return fmt.Errorf("migrate up: %w", err)
+	}
+	return nil
+}
+
+// MigrateDown rolls back the last steps migrations.
+func MigrateDown(_ context.Context, dsn string, steps int) error {
+	m, closeFn, err := newMigrate(dsn)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	if err := m.Steps(-steps); err != nil && err != migrate.ErrNoChange {
+		return fmt.Errorf("migrate down: %w", err)
+	}
+	return nil
+}
+
+// ForceMigration records version as applied and clears the dirty flag
+// without running any migration.
+func ForceMigration(_ context.Context, dsn string, version int) error {
+	m, closeFn, err := newMigrate(dsn)
+	if err != nil {
+		return err
+	}
+	defer closeFn()
+
+	if err := m.Force(version); err != nil {
+		return fmt.Errorf("migrate force: %w", err)
+	}
+	return nil
+}
+
+func MigrationStatus(_ context.Context, dsn string) (MigrationState, error) {
+	var state MigrationState
+
+	latest, err := latestMigration()
+	if err != nil {
+		return state, err
+	}
+	state.Latest = latest
+
+	m, closeFn, err := newMigrate(dsn)
+	if err != nil {
+		return state, err
+	}
+	defer closeFn()
+
+	state.Version, state.Dirty, err = m.Version()
+	if err != nil && !errors.Is(err, migrate.ErrNilVersion) {
+		return state, fmt.Errorf("migrate version: %w", err)
+	}
+	return state, nil
+}
+
+func newMigrate(dsn string) (*migrate.Migrate, func(), error) {
 	sqlDB, err := sql.Open("pgx", dsn)
 	if err != nil {
-		return fmt.Errorf("open sql db: %w", err)
+		return nil, nil, fmt.Errorf("open sql db: %w", err)
 	}
-	defer sqlDB.Close()
 
 	driver, err := mgpg.WithInstance(sqlDB, &mgpg.Config{})
 	if err != nil {
-		return fmt.Errorf("migrate db driver: %w", err)
+		sqlDB.Close()
+		return nil, nil, fmt.Errorf("migrate db driver: %w", err)
 	}
 
-	src, err := iofs.New(appmigrations.FS, "db/migrations")
+	src, err := iofs.New(appmigrations.FS, migrationsDir)
 	if err != nil {
-		return fmt.Errorf("migrate iofs: %w", err)
+		sqlDB.Close()
+		return nil, nil, fmt.Errorf("migrate iofs: %w", err)
 	}
 
 	m, err := migrate.NewWithInstance("iofs", src, "postgres", driver)
 	if err != nil {
-		return fmt.Errorf("migrate instance: %w", err)
+		sqlDB.Close()
+		return nil, nil, fmt.Errorf("migrate instance: %w", err)
 	}
+	return m, func() { m.Close() }, nil
+}
 
-	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
-		return fmt.Errorf("migrate up: %w", err)
+// latestMigration returns the highest version among the embedded migrations.
+func latestMigration() (uint, error) {
+	names, err := fs.Glob(appmigrations.FS, path.Join(migrationsDir, "*.up.sql"))
+	if err != nil {
+		return 0, err
 	}
-	return nil
+	versions := make([]uint, 0, len(names))
+	for _, name := range names {
+		prefix, _, _ := strings.Cut(path.Base(name), "_")
+		v, err := strconv.ParseUint(prefix, 10, 64)
+		if err != nil {
+			return 0, fmt.Errorf("migration %s: bad version", name)
+		}
+		versions = append(versions, uint(v))
+	}
+	if len(versions) == 0 {
+		return 0, nil
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] < versions[j] })
+	return versions[len(versions)-1], nil
 }
@@ -0,0 +1,110 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/vlxdisluv/shortener/internal/app/storage"
+)
+
+type RevisionRepository struct {
+	ex   storage.Execer
+	pool *pgxpool.Pool
+}
+
+func NewRevisionRepository(pool *pgxpool.Pool) (*RevisionRepository, error) {
+	return &RevisionRepository{ex: pool, pool: pool}, nil
+}
+
+func (r *RevisionRepository) WithTx(tx storage.Tx) storage.RevisionRepository {
+	if tw, ok := tx.(txWrapper); ok {
+		return &RevisionRepository{ex: tw.tx, pool: r.pool}
+	}
+	return r
+}
+
+func (r *RevisionRepository) Record(ctx context.Context, rev *storage.Revision) error {
+	const q = `INSERT INTO short_url_revisions(hash, old_url, new_url, user_id, snapshot)
+		VALUES ($1, $2, $3, $4, $5) RETURNING id, created_at`
+	return r.ex.QueryRow(ctx, q, rev.Hash, rev.OldURL, rev.NewURL, rev.UserID, rev.Before).Scan(&rev.ID, &rev.Time)
+}
+
+// Restore also moves the ID sequence past rev.ID, so that Record does not
+// hand it out again.
+func (r *RevisionRepository) Restore(ctx context.Context, rev *storage.Revision) error {
+	const q = `INSERT INTO short_url_revisions(id, hash, old_url, new_url, user_id, snapshot, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7) ON CONFLICT (id) DO NOTHING`
+	tag, err := r.ex.Exec(ctx, q, rev.ID, rev.Hash, rev.OldURL, rev.NewURL, rev.UserID, rev.Before, rev.Time)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return storage.ErrConflict
+	}
+	const seq = `SELECT setval('short_url_revisions_id_seq', $1)
+		WHERE $1 > (SELECT CASE WHEN is_called THEN last_value ELSE last_value - 1 END FROM short_url_revisions_id_seq)`
+	_, err = r.ex.Exec(ctx, seq, rev.ID)
+	return err
+}
+
+func (r *RevisionRepository) Each(ctx context.Context, fn func(*storage.Revision) error) error {
+	const q = `SELECT id, hash, old_url, new_url, user_id, created_at, snapshot
+		FROM short_url_revisions ORDER BY id`
+	rows, err := r.pool.Query(ctx, q)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var rev storage.Revision
+		if err := rows.Scan(&rev.ID, &rev.Hash, &rev.OldURL, &rev.NewURL, &rev.UserID, &rev.Time, &rev.Before); err != nil {
+			return err
+		}
+		if err := fn(&rev); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (r *RevisionRepository) List(ctx context.Context, hash string) ([]storage.Revision, error) {
+	const q = `SELECT id, hash, old_url, new_url, user_id, created_at, snapshot
+		FROM short_url_revisions WHERE hash = $1 ORDER BY id DESC`
+	rows, err := r.pool.Query(ctx, q, hash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []storage.Revision
+	for rows.Next() {
+		var rev storage.Revision
+		if err := rows.Scan(&rev.ID, &rev.Hash, &rev.OldURL, &rev.NewURL, &rev.UserID, &rev.Time, &rev.Before); err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	return revisions, rows.Err()
+}
+
+func (r *RevisionRepository) Get(ctx context.Context, hash string, id int64) (*storage.Revision, error) {
+	const q = `SELECT id, hash, old_url, new_url, user_id, created_at, snapshot
+		FROM short_url_revisions WHERE hash = $1 AND id = $2`
+	var rev storage.Revision
+	err := r.ex.QueryRow(ctx, q, hash, id).Scan(&rev.ID, &rev.Hash, &rev.OldURL, &rev.NewURL, &rev.UserID, &rev.Time, &rev.Before)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, err
+	}
+	return &rev, nil
+}
+
+// Close is a no-op, the pool is owned by the storage factory.
+func (r *RevisionRepository) Close() error {
+	return nil
+}
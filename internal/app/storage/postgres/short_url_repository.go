@@ -3,6 +3,9 @@ package postgres
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strings"
+	"time"
 
 	"github.com/jackc/pgerrcode"
 	"github.com/jackc/pgx/v5"
@@ -36,9 +39,38 @@ func (r *ShortURLRepository) WithTx(tx storage.Tx) storage.ShortURLRepository {
 	return r
 }
 
-func (r *ShortURLRepository) Save(ctx context.Context, hash string, original string) error {
-	const q = `INSERT INTO short_urls(hash, original) VALUES ($1, $2) ON CONFLICT (hash) DO NOTHING`
-	tag, err := r.ex.Exec(ctx, q, hash, original)
+// shortURLColumns lists the columns read by scanShortURL, in order.
+const shortURLColumns = `hash, original, redirect_type, passthrough, utm, campaign, targeting, destinations, password_hash, max_clicks, uses, valid_from, valid_until,
+	title, description, notes, tags, user_id, created_at, views`
+
+func scanShortURL(row pgx.Row) (*storage.ShortURL, error) {
+	var u storage.ShortURL
+	err := row.Scan(&u.Hash, &u.Original, &u.RedirectType, &u.Passthrough, &u.UTM, &u.Campaign,
+		&u.Targeting, &u.Destinations, &u.PasswordHash, &u.MaxClicks, &u.Uses,
+		&u.ValidFrom, &u.ValidUntil, &u.Title, &u.Description, &u.Notes, &u.Tags,
+		&u.UserID, &u.CreatedAt, &u.Clicks)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, storage.ErrNotFound
+		}
+		return nil, err
+	}
+	return &u, nil
+}
+
+// Save reports a duplicate hash or original URL as storage.ErrConflict
+// without aborting the surrounding transaction, so batches can go on. The
+// link starts with no views; ClickRepository.Record counts them.
+func (r *ShortURLRepository) Save(ctx context.Context, u *storage.ShortURL) error {
+	const q = `INSERT INTO short_urls(` + shortURLColumns + `)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16, $17, $18, $19, 0)
+		ON CONFLICT DO NOTHING`
+	if u.CreatedAt.IsZero() {
+		u.CreatedAt = time.Now().UTC()
+	}
+	tag, err := r.ex.Exec(ctx, q, u.Hash, u.Original, u.RedirectType, u.Passthrough, u.UTM, u.Campaign,
+		u.Targeting, u.Destinations, u.PasswordHash, u.MaxClicks, u.Uses, u.ValidFrom, u.ValidUntil,
+		u.Title, u.Description, u.Notes, u.Tags, u.UserID, u.CreatedAt)
 	if err != nil {
 		var pgErr *pgconn.PgError
 		if errors.As(err, &pgErr) && pgerrcode.IsIntegrityConstraintViolation(pgErr.Code) {
@@ -52,16 +84,212 @@ func (r *ShortURLRepository) Save(ctx context.Context, hash string, original str
 	return nil
 }
 
-func (r *ShortURLRepository) Get(ctx context.Context, hash string) (string, error) {
-	const q = `SELECT original FROM short_urls WHERE hash = $1`
-	var original string
-	if err := r.ex.QueryRow(ctx, q, hash).Scan(&original); err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return "", storage.ErrNotFound
+func (r *ShortURLRepository) Get(ctx context.Context, hash string) (*storage.ShortURL, error) {
+	const q = `SELECT ` + shortURLColumns + ` FROM short_urls WHERE hash = $1`
+	return scanShortURL(r.ex.QueryRow(ctx, q, hash))
+}
+
+func (r *ShortURLRepository) Update(ctx context.Context, u *storage.ShortURL) error {
+	const q = `UPDATE short_urls
+		SET original = $2, redirect_type = $3, passthrough = $4, utm = $5, campaign = $6, targeting = $7,
+			destinations = $8, password_hash = $9, max_clicks = $10, valid_from = $11, valid_until = $12,
+			title = $13, description = $14, notes = $15, tags = $16
+		WHERE hash = $1`
+	tag, err := r.ex.Exec(ctx, q, u.Hash, u.Original, u.RedirectType, u.Passthrough, u.UTM, u.Campaign,
+		u.Targeting, u.Destinations, u.PasswordHash, u.MaxClicks, u.ValidFrom, u.ValidUntil,
+		u.Title, u.Description, u.Notes, u.Tags)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgerrcode.IsIntegrityConstraintViolation(pgErr.Code) {
+			err = storage.ErrConflict
 		}
-		return "", err
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+// sortColumns maps storage sort orders to columns; each has an index on
+// (user_id, column, hash) so pages are read with a keyset scan.
+var sortColumns = map[string]string{
+	storage.SortCreatedAt: "created_at",
+	storage.SortClicks:    "views",
+	storage.SortHash:      "hash",
+}
+
+func (r *ShortURLRepository) List(ctx context.Context, q storage.ListQuery) ([]storage.ShortURL, error) {
+	column, ok := sortColumns[q.Sort]
+	if !ok {
+		return nil, fmt.Errorf("unknown sort order %q", q.Sort)
+	}
+	where, args := listConditions(q)
+
+	cmp, dir := ">", "ASC"
+	if q.Desc {
+		cmp, dir = "<", "DESC"
+	}
+	if q.After != nil {
+		switch q.Sort {
+		case storage.SortHash:
+			args = append(args, q.After.Hash)
+			where += fmt.Sprintf(" AND hash %s $%d", cmp, len(args))
+		case storage.SortCreatedAt:
+			args = append(args, q.After.CreatedAt, q.After.Hash)
+			where += fmt.Sprintf(" AND (created_at, hash) %s ($%d, $%d)", cmp, len(args)-1, len(args))
+		case storage.SortClicks:
+			args = append(args, q.After.Clicks, q.After.Hash)
+			where += fmt.Sprintf(" AND (views, hash) %s ($%d, $%d)", cmp, len(args)-1, len(args))
+		}
+	}
+
+	order := fmt.Sprintf("%s %s", column, dir)
+	if column != "hash" {
+		order += ", hash " + dir
+	}
+	args = append(args, q.Limit)
+	query := fmt.Sprintf(`SELECT %s FROM short_urls WHERE %s ORDER BY %s LIMIT $%d`, shortURLColumns, where, order, len(args))
+
+	rows, err := r.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []storage.ShortURL
+	for rows.Next() {
+		u, err := scanShortURL(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, *u)
+	}
+	return links, rows.Err()
+}
+
+func (r *ShortURLRepository) Count(ctx context.Context, q storage.ListQuery) (int64, error) {
+	where, args := listConditions(q)
+	var n int64
+	err := r.pool.QueryRow(ctx, `SELECT count(*) FROM short_urls WHERE `+where, args...).Scan(&n)
+	return n, err
+}
+
+func (r *ShortURLRepository) CountAll(ctx context.Context) (int64, error) {
+	var n int64
+	err := r.pool.QueryRow(ctx, `SELECT count(*) FROM short_urls`).Scan(&n)
+	return n, err
+}
+
+func (r *ShortURLRepository) CountUsers(ctx context.Context) (int64, error) {
+	var n int64
+	err := r.pool.QueryRow(ctx, `SELECT count(DISTINCT user_id) FROM short_urls WHERE user_id <> ''`).Scan(&n)
+	return n, err
+}
+
+// listConditions builds the WHERE clause shared by List and Count.
+func listConditions(q storage.ListQuery) (string, []any) {
+	where := "user_id = $1"
+	args := []any{q.UserID}
+	if q.Search != "" {
+		args = append(args, "%"+likeEscaper.Replace(q.Search)+"%")
+		where += fmt.Sprintf(" AND original ILIKE $%d", len(args))
+	}
+	if q.CreatedFrom != nil {
+		args = append(args, *q.CreatedFrom)
+		where += fmt.Sprintf(" AND created_at >= $%d", len(args))
+	}
+	if q.CreatedTo != nil {
+		args = append(args, *q.CreatedTo)
+		where += fmt.Sprintf(" AND created_at < $%d", len(args))
+	}
+	return where, args
+}
+
+func (r *ShortURLRepository) Delete(ctx context.Context, hash string) error {
+	tag, err := r.ex.Exec(ctx, `DELETE FROM short_urls WHERE hash = $1`, hash)
+	if err != nil {
+		return err
+	}
+	if tag.RowsAffected() == 0 {
+		return storage.ErrNotFound
+	}
+	return nil
+}
+
+// Each streams the links from a single query instead of loading them all.
+func (r *ShortURLRepository) Each(ctx context.Context, fn func(*storage.ShortURL) error) error {
+	rows, err := r.pool.Query(ctx, `SELECT `+shortURLColumns+` FROM short_urls ORDER BY hash`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		u, err := scanShortURL(rows)
+		if err != nil {
+			return err
+		}
+		if err := fn(u); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// ListByUser uses the user_id index; tags are matched through the GIN index
+// on the tags array.
+func (r *ShortURLRepository) ListByUser(ctx context.Context, userID string, f storage.LinkFilter) ([]storage.ShortURL, error) {
+	const q = `SELECT ` + shortURLColumns + ` FROM short_urls
+		WHERE user_id = $1
+			AND ($2 = '' OR tags @> ARRAY[$2])
+			AND ($3 = '' OR title ILIKE $3 OR description ILIKE $3 OR notes ILIKE $3)
+		ORDER BY hash`
+	var pattern string
+	if f.Search != "" {
+		pattern = "%" + likeEscaper.Replace(f.Search) + "%"
+	}
+
+	rows, err := r.pool.Query(ctx, q, userID, f.Tag, pattern)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var links []storage.ShortURL
+	for rows.Next() {
+		u, err := scanShortURL(rows)
+		if err != nil {
+			return nil, err
+		}
+		links = append(links, *u)
+	}
+	return links, rows.Err()
+}
+
+// likeEscaper makes user input match literally inside a LIKE pattern.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// Consume relies on the row lock taken by UPDATE, so concurrent redirects
+// can never use the same click twice.
+func (r *ShortURLRepository) Consume(ctx context.Context, hash string) (int, error) {
+	const q = `UPDATE short_urls SET uses = uses + 1
+		WHERE hash = $1 AND (max_clicks = 0 OR uses < max_clicks)
+		RETURNING max_clicks, uses`
+	var maxClicks, uses int
+	if err := r.ex.QueryRow(ctx, q, hash).Scan(&maxClicks, &uses); err != nil {
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return 0, err
+		}
+		if _, err := r.Get(ctx, hash); err != nil {
+			return 0, err
+		}
+		return 0, storage.ErrExhausted
+	}
+	if maxClicks == 0 {
+		return -1, nil
 	}
-	return original, nil
+	return maxClicks - uses, nil
 }
 
 func (r *ShortURLRepository) GetByOriginal(ctx context.Context, original string) (string, error) {
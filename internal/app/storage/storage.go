@@ -3,6 +3,7 @@ package storage
 import (
 	"context"
 	"errors"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgconn"
@@ -11,8 +12,161 @@ import (
 var (
 	ErrNotFound = errors.New("not found")
 	ErrConflict = errors.New("conflict")
+	// ErrExhausted is returned by ShortURLRepository.Consume when a link has
+	// no clicks left.
+	ErrExhausted = errors.New("exhausted")
 )
 
+// ShortURL is a stored short link together with its attributes. The JSON
+// form is used for revision snapshots.
+type ShortURL struct {
+	Hash     string `json:"hash"`
+	Original string `json:"url"`
+	// RedirectType is the HTTP status used to redirect (301, 302, 307 or 308).
+	// Zero means the service-wide default.
+	RedirectType int `json:"redirect_type,omitempty"`
+	// Passthrough forwards the visitor's extra path and query to Original.
+	Passthrough bool `json:"passthrough,omitempty"`
+	// UTM parameters and the name of a campaign template added to Original
+	// at redirect time. Original itself is never modified.
+	UTM      *UTM   `json:"utm,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+	// Targeting rules are evaluated in order; the first matching rule's
+	// destination replaces Original.
+	Targeting []TargetingRule `json:"targeting,omitempty"`
+	// Destinations split traffic by weight instead of sending everyone to
+	// Original. Targeting rules are applied first.
+	Destinations []Destination `json:"destinations,omitempty"`
+	// PasswordHash is the bcrypt hash of the link password, empty if the
+	// link is not protected.
+	PasswordHash string `json:"password_hash,omitempty"`
+	// MaxClicks limits how many redirects the link serves, zero means no
+	// limit. Uses counts the redirects served so far.
+	MaxClicks int `json:"max_clicks,omitempty"`
+	Uses      int `json:"uses,omitempty"`
+	// ValidFrom and ValidUntil limit when the link redirects. Nil means no
+	// bound on that side.
+	ValidFrom  *time.Time `json:"valid_from,omitempty"`
+	ValidUntil *time.Time `json:"valid_until,omitempty"`
+	// Title, Description, Notes and Tags help owners find their links; they
+	// do not affect redirects. Tags are normalized by the caller.
+	Title       string   `json:"title,omitempty"`
+	Description string   `json:"description,omitempty"`
+	Notes       string   `json:"notes,omitempty"`
+	Tags        []string `json:"tags,omitempty"`
+	// UserID is the owner that created the link, empty for anonymous links.
+	UserID string `json:"user_id,omitempty"`
+	// CreatedAt is set by Save when empty.
+	CreatedAt time.Time `json:"created_at"`
+	// Clicks is the number of recorded redirects. It is maintained by the
+	// ClickRepository and ignored by Save and Update.
+	Clicks int64 `json:"-"`
+}
+
+// Sort orders accepted by ShortURLRepository.List.
+const (
+	SortCreatedAt = "created_at"
+	SortClicks    = "clicks"
+	SortHash      = "hash"
+)
+
+// ListQuery selects one page of a user's links.
+type ListQuery struct {
+	UserID string
+	// Search is a case-insensitive substring of the original URL.
+	Search string
+	// CreatedFrom is inclusive, CreatedTo exclusive.
+	CreatedFrom *time.Time
+	CreatedTo   *time.Time
+
+	Sort string
+	Desc bool
+	// After is the last link of the previous page, nil for the first page.
+	After *ListCursor
+	Limit int
+}
+
+// ListCursor is the position of a link in a listing. Only the field of the
+// sort order and Hash, the tie breaker, are used.
+type ListCursor struct {
+	CreatedAt time.Time
+	Clicks    int64
+	Hash      string
+}
+
+// LinkFilter narrows down a listing of links. Empty fields match everything.
+type LinkFilter struct {
+	Tag string
+	// Search is a case-insensitive substring of the title, description or notes.
+	Search string
+}
+
+// Revision records one change of a link made through the API.
+type Revision struct {
+	ID     int64
+	Hash   string
+	OldURL string
+	NewURL string
+	// UserID is who made the change.
+	UserID string
+	Time   time.Time
+	// Before is the link as it was before the change. Rolling back to the
+	// revision restores it.
+	Before ShortURL
+}
+
+// Destination is one weighted variant of a link under an A/B test.
+type Destination struct {
+	URL    string `json:"url"`
+	Weight int    `json:"weight"`
+}
+
+// Click is a single redirect served for a link.
+type Click struct {
+	Hash string
+	// Variant is the destination URL picked by weighted rotation, empty for
+	// links without destinations.
+	Variant string
+	// Country is the visitor's ISO 3166-1 alpha-2 code, empty if unknown.
+	Country string
+	Time    time.Time
+}
+
+// LinkStats aggregates the clicks of one link.
+type LinkStats struct {
+	Clicks    int64
+	Variants  map[string]int64
+	Countries map[string]int64
+}
+
+// TargetingRule sends visitors matching all of its conditions to
+// Destination. Values inside one condition are alternatives.
+type TargetingRule struct {
+	Destination string            `json:"destination"`
+	Browsers    []string          `json:"browsers,omitempty"`
+	OS          []string          `json:"os,omitempty"`
+	Languages   []string          `json:"languages,omitempty"`
+	Countries   []string          `json:"countries,omitempty"`
+	From        *time.Time        `json:"from,omitempty"`
+	Until       *time.Time        `json:"until,omitempty"`
+	Query       map[string]string `json:"query,omitempty"`
+}
+
+// UTM holds Google Analytics campaign parameters.
+type UTM struct {
+	Source   string `json:"source,omitempty"`
+	Medium   string `json:"medium,omitempty"`
+	Campaign string `json:"campaign,omitempty"`
+	Term     string `json:"term,omitempty"`
+	Content  string `json:"content,omitempty"`
+}
+
+// Campaign is a named UTM template that links can refer to.
+type Campaign struct {
+	Name string
+	UTM  UTM
+}
+
 type BatchURL struct {
 	CorrelationID string
 	URL           string
@@ -24,15 +178,78 @@ type Execer interface {
 }
 
 type ShortURLRepository interface {
-	Save(ctx context.Context, hash string, original string) error
+	Save(ctx context.Context, u *ShortURL) error
 	GetByOriginal(ctx context.Context, original string) (string, error)
-	Get(ctx context.Context, hash string) (string, error)
+	Get(ctx context.Context, hash string) (*ShortURL, error)
+	// Update replaces the attributes of an existing link.
+	Update(ctx context.Context, u *ShortURL) error
+	// Delete removes a link. Its clicks and revisions are kept.
+	Delete(ctx context.Context, hash string) error
+	// List returns one page of links ordered by q.Sort and then by hash.
+	List(ctx context.Context, q ListQuery) ([]ShortURL, error)
+	// Count returns the number of links matching q, ignoring its cursor and limit.
+	Count(ctx context.Context, q ListQuery) (int64, error)
+	// CountAll returns the number of links of all users, anonymous ones included.
+	CountAll(ctx context.Context) (int64, error)
+	// CountUsers returns the number of users that own at least one link.
+	CountUsers(ctx context.Context) (int64, error)
+	// ListByUser returns the links owned by userID that match f.
+	ListByUser(ctx context.Context, userID string, f LinkFilter) ([]ShortURL, error)
+	// Each calls fn for every link of every user in hash order and stops at
+	// the first error.
+	Each(ctx context.Context, fn func(*ShortURL) error) error
+	// Consume atomically counts one redirect against the link's MaxClicks and
+	// returns the number of clicks left, or -1 for links without a limit. It
+	// fails with ErrExhausted once the limit is reached.
+	Consume(ctx context.Context, hash string) (int, error)
 	Close() error
 	WithTx(tx Tx) ShortURLRepository
 }
 
+type CampaignRepository interface {
+	Create(ctx context.Context, c *Campaign) error
+	Update(ctx context.Context, c *Campaign) error
+	Get(ctx context.Context, name string) (*Campaign, error)
+	List(ctx context.Context) ([]Campaign, error)
+	Delete(ctx context.Context, name string) error
+	Close() error
+}
+
+type ClickRepository interface {
+	Record(ctx context.Context, c Click) error
+	Stats(ctx context.Context, hash string) (*LinkStats, error)
+	// CountSince returns the number of clicks on all links since the given
+	// time, which backends may round down to midnight UTC.
+	CountSince(ctx context.Context, since time.Time) (int64, error)
+	// Each calls fn for every click in the order they were recorded and
+	// stops at the first error.
+	Each(ctx context.Context, fn func(Click) error) error
+	Close() error
+}
+
+type RevisionRepository interface {
+	// Record stores rev and sets its ID and Time.
+	Record(ctx context.Context, rev *Revision) error
+	// List returns the revisions of a link, newest first.
+	List(ctx context.Context, hash string) ([]Revision, error)
+	Get(ctx context.Context, hash string, id int64) (*Revision, error)
+	// Each calls fn for every revision of every link in ID order and stops
+	// at the first error.
+	Each(ctx context.Context, fn func(*Revision) error) error
+	// Restore stores a revision copied from another storage, keeping its ID
+	// and Time. It fails with ErrConflict if the ID is taken.
+	Restore(ctx context.Context, rev *Revision) error
+	Close() error
+	WithTx(tx Tx) RevisionRepository
+}
+
 type CounterRepository interface {
 	Next(ctx context.Context) (uint64, error)
+	// Current returns the last value handed out by Next, zero if none.
+	Current(ctx context.Context) (uint64, error)
+	// AtLeast makes sure Next returns values greater than value, e.g. after
+	// links were copied in from another storage.
+	AtLeast(ctx context.Context, value uint64) error
 	Close() error
 	WithTx(tx Tx) CounterRepository
 }
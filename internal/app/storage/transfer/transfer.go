@@ -0,0 +1,363 @@
+// Package transfer copies the links of one storage backend into another,
+// together with their clicks and edit history.
+package transfer
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/vlxdisluv/shortener/internal/app/shortener"
+	"github.com/vlxdisluv/shortener/internal/app/storage"
+)
+
+// ChunkSize is the number of links saved in one destination transaction.
+const ChunkSize = 500
+
+type Storage interface {
+	ShortURLs() storage.ShortURLRepository
+	Counters() storage.CounterRepository
+	Campaigns() storage.CampaignRepository
+	Clicks() storage.ClickRepository
+	Revisions() storage.RevisionRepository
+	UnitOfWork() storage.UnitOfWork
+}
+
+// Report describes what a copy did.
+type Report struct {
+	Campaigns int
+	Copied    int
+	// Skipped links already were in the destination, e.g. from an
+	// interrupted earlier run.
+	Skipped int
+	// Clicks and Revisions count the history copied. Entries already in the
+	// destination are not counted.
+	Clicks    int
+	Revisions int
+	// Counter is the value the destination counter was raised to.
+	Counter uint64
+}
+
+// Copy copies campaigns, links, clicks and revisions from src to dst. Links
+// that already exist in dst unchanged are skipped, so an interrupted copy is
+// resumed by running it again; a different link under the same hash or URL
+// is an error. The destination counter is raised past the highest generated
+// hash after every chunk, so new links never collide with copied ones, and
+// finally to the source counter, so hashes of deleted links are not handed
+// out again.
+func Copy(ctx context.Context, src, dst Storage, progress func(Report)) (Report, error) {
+	var report Report
+
+	campaigns, err := src.Campaigns().List(ctx)
+	if err != nil {
+		return report, fmt.Errorf("list campaigns: %w", err)
+	}
+	for i := range campaigns {
+		if err := copyCampaign(ctx, dst, &campaigns[i]); err != nil {
+			return report, err
+		}
+		report.Campaigns++
+	}
+
+	raiseCounter := func(value uint64) error {
+		if value <= report.Counter {
+			return nil
+		}
+		if err := dst.Counters().AtLeast(ctx, value); err != nil {
+			return fmt.Errorf("raise counter: %w", err)
+		}
+		report.Counter = value
+		return nil
+	}
+
+	var maxID uint64
+	chunk := make([]storage.ShortURL, 0, ChunkSize)
+	flush := func() error {
+		copied, err := saveChunk(ctx, dst, chunk)
+		if err != nil {
+			return err
+		}
+		report.Copied += copied
+		report.Skipped += len(chunk) - copied
+		chunk = chunk[:0]
+
+		if err := raiseCounter(maxID); err != nil {
+			return err
+		}
+		if progress != nil {
+			progress(report)
+		}
+		return nil
+	}
+
+	err = src.ShortURLs().Each(ctx, func(u *storage.ShortURL) error {
+		if id, ok := shortener.Decode(u.Hash); ok && id > maxID {
+			maxID = id
+		}
+		chunk = append(chunk, *u)
+		if len(chunk) == ChunkSize {
+			return flush()
+		}
+		return nil
+	})
+	if err == nil && len(chunk) > 0 {
+		err = flush()
+	}
+	if err != nil {
+		return report, err
+	}
+
+	current, err := src.Counters().Current(ctx)
+	if err != nil {
+		return report, fmt.Errorf("read counter: %w", err)
+	}
+	if err := raiseCounter(current); err != nil {
+		return report, err
+	}
+
+	if err := copyClicks(ctx, src, dst, &report); err != nil {
+		return report, err
+	}
+	if progress != nil {
+		progress(report)
+	}
+	if err := copyRevisions(ctx, src, dst, &report); err != nil {
+		return report, err
+	}
+	if progress != nil {
+		progress(report)
+	}
+	return report, nil
+}
+
+// copyClicks records the clicks of src in dst. Clicks are copied in the
+// order they were recorded, so when a link already has n clicks in dst, an
+// earlier run copied its first n and they are skipped.
+func copyClicks(ctx context.Context, src, dst Storage, report *Report) error {
+	skip := make(map[string]int64)
+	err := src.Clicks().Each(ctx, func(c storage.Click) error {
+		n, ok := skip[c.Hash]
+		if !ok {
+			stats, err := dst.Clicks().Stats(ctx, c.Hash)
+			if err != nil {
+				return fmt.Errorf("clicks of %s: %w", c.Hash, err)
+			}
+			n = stats.Clicks
+		}
+		if n > 0 {
+			skip[c.Hash] = n - 1
+			return nil
+		}
+		skip[c.Hash] = 0
+
+		if err := dst.Clicks().Record(ctx, c); err != nil {
+			return fmt.Errorf("click of %s: %w", c.Hash, err)
+		}
+		report.Clicks++
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("copy clicks: %w", err)
+	}
+	return nil
+}
+
+// copyRevisions restores the revisions of src in dst under their IDs, which
+// rollbacks refer to. Revisions already restored by an earlier run are
+// skipped.
+func copyRevisions(ctx context.Context, src, dst Storage, report *Report) error {
+	err := src.Revisions().Each(ctx, func(rev *storage.Revision) error {
+		err := dst.Revisions().Restore(ctx, rev)
+		if err == nil {
+			report.Revisions++
+			return nil
+		}
+		if !errors.Is(err, storage.ErrConflict) {
+			return fmt.Errorf("revision %d of %s: %w", rev.ID, rev.Hash, err)
+		}
+		if _, err := dst.Revisions().Get(ctx, rev.Hash, rev.ID); err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				return fmt.Errorf("revision %d of %s: the ID belongs to another link in the destination", rev.ID, rev.Hash)
+			}
+			return fmt.Errorf("revision %d of %s: %w", rev.ID, rev.Hash, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("copy revisions: %w", err)
+	}
+	return nil
+}
+
+func copyCampaign(ctx context.Context, dst Storage, c *storage.Campaign) error {
+	err := dst.Campaigns().Create(ctx, c)
+	if !errors.Is(err, storage.ErrConflict) {
+		if err != nil {
+			return fmt.Errorf("campaign %q: %w", c.Name, err)
+		}
+		return nil
+	}
+
+	existing, err := dst.Campaigns().Get(ctx, c.Name)
+	if err != nil {
+		return fmt.Errorf("campaign %q: %w", c.Name, err)
+	}
+	if existing.UTM != c.UTM {
+		return fmt.Errorf("campaign %q already exists in the destination with other parameters", c.Name)
+	}
+	return nil
+}
+
+// saveChunk returns how many links were new to dst.
+func saveChunk(ctx context.Context, dst Storage, links []storage.ShortURL) (int, error) {
+	tx, err := dst.UnitOfWork().Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	repo := dst.ShortURLs().WithTx(tx)
+	copied := 0
+	for i := range links {
+		u := links[i]
+		// copyClicks rebuilds the count; a backend that kept it from Save
+		// would count every click twice.
+		u.Clicks = 0
+		err := repo.Save(ctx, &u)
+		if err == nil {
+			copied++
+			continue
+		}
+		if !errors.Is(err, storage.ErrConflict) {
+			return 0, fmt.Errorf("link %s: %w", u.Hash, err)
+		}
+
+		existing, err := repo.Get(ctx, u.Hash)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotFound) {
+				return 0, fmt.Errorf("link %s: %s is already shortened under another hash in the destination", u.Hash, u.Original)
+			}
+			return 0, fmt.Errorf("link %s: %w", u.Hash, err)
+		}
+		if !bytes.Equal(canonical(existing), canonical(&links[i])) {
+			return 0, fmt.Errorf("link %s already exists in the destination with other attributes", u.Hash)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	return copied, nil
+}
+
+// Summary is the number of links and revisions in a storage and an
+// order-independent checksum over the links' attributes and click counts.
+type Summary struct {
+	Links     int
+	Revisions int
+	Checksum  string
+}
+
+// Verify summarizes src and the same links and revisions in dst; the two
+// are equal when the copy is complete. What only exists in dst is ignored.
+func Verify(ctx context.Context, src, dst Storage) (Summary, Summary, error) {
+	hashes := make(map[string]bool)
+	srcSum, err := summarize(ctx, src, func(u *storage.ShortURL) bool {
+		hashes[u.Hash] = true
+		return true
+	}, nil)
+	if err != nil {
+		return srcSum, Summary{}, fmt.Errorf("read source: %w", err)
+	}
+
+	revisions := make(map[int64]string)
+	err = src.Revisions().Each(ctx, func(rev *storage.Revision) error {
+		revisions[rev.ID] = rev.Hash
+		return nil
+	})
+	if err != nil {
+		return srcSum, Summary{}, fmt.Errorf("read source: %w", err)
+	}
+	srcSum.Revisions = len(revisions)
+
+	dstSum, err := summarize(ctx, dst, func(u *storage.ShortURL) bool { return hashes[u.Hash] },
+		func(rev *storage.Revision) bool { return revisions[rev.ID] == rev.Hash })
+	if err != nil {
+		return srcSum, dstSum, fmt.Errorf("read destination: %w", err)
+	}
+	return srcSum, dstSum, nil
+}
+
+// summarize counts the links and, if includeRevision is set, the revisions
+// of s that the filters select.
+func summarize(ctx context.Context, s Storage, includeLink func(*storage.ShortURL) bool, includeRevision func(*storage.Revision) bool) (Summary, error) {
+	var sum Summary
+	var checksum [sha256.Size]byte
+	err := s.ShortURLs().Each(ctx, func(u *storage.ShortURL) error {
+		if !includeLink(u) {
+			return nil
+		}
+		// XOR of the per-link digests does not depend on the order, which
+		// differs between backends.
+		digest := sha256.Sum256(append(canonical(u), strconv.FormatInt(u.Clicks, 10)...))
+		for i := range checksum {
+			checksum[i] ^= digest[i]
+		}
+		sum.Links++
+		return nil
+	})
+	sum.Checksum = hex.EncodeToString(checksum[:])
+	if err != nil || includeRevision == nil {
+		return sum, err
+	}
+
+	err = s.Revisions().Each(ctx, func(rev *storage.Revision) error {
+		if includeRevision(rev) {
+			sum.Revisions++
+		}
+		return nil
+	})
+	return sum, err
+}
+
+// canonical encodes the stored attributes of a link the same way for every
+// backend: Postgres keeps microseconds and returns empty arrays where the
+// file backend has nil. Clicks are not part of the link, summarize adds
+// them to the checksum separately.
+func canonical(u *storage.ShortURL) []byte {
+	c := *u
+	c.Clicks = 0
+	c.CreatedAt = normalizeTime(c.CreatedAt)
+	if c.ValidFrom != nil {
+		t := normalizeTime(*c.ValidFrom)
+		c.ValidFrom = &t
+	}
+	if c.ValidUntil != nil {
+		t := normalizeTime(*c.ValidUntil)
+		c.ValidUntil = &t
+	}
+	if len(c.Tags) == 0 {
+		c.Tags = nil
+	}
+	if len(c.Targeting) == 0 {
+		c.Targeting = nil
+	}
+	if len(c.Destinations) == 0 {
+		c.Destinations = nil
+	}
+	if c.UTM != nil && *c.UTM == (storage.UTM{}) {
+		c.UTM = nil
+	}
+	b, _ := json.Marshal(c)
+	return b
+}
+
+func normalizeTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Microsecond)
+}
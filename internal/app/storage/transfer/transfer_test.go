@@ -0,0 +1,183 @@
+package transfer
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/vlxdisluv/shortener/internal/app/shortener"
+	"github.com/vlxdisluv/shortener/internal/app/storage"
+	"github.com/vlxdisluv/shortener/internal/app/storage/file"
+)
+
+type fileStorage struct {
+	short     *file.ShortURLRepository
+	counter   *file.CounterRepository
+	campaigns *file.CampaignRepository
+	clicks    *file.ClickRepository
+	revisions *file.RevisionRepository
+}
+
+func (s *fileStorage) ShortURLs() storage.ShortURLRepository { return s.short }
+func (s *fileStorage) Counters() storage.CounterRepository   { return s.counter }
+func (s *fileStorage) Campaigns() storage.CampaignRepository { return s.campaigns }
+func (s *fileStorage) Clicks() storage.ClickRepository       { return s.clicks }
+func (s *fileStorage) Revisions() storage.RevisionRepository { return s.revisions }
+func (s *fileStorage) UnitOfWork() storage.UnitOfWork        { return file.NewNoopUnitOfWork() }
+
+func newFileStorage(t *testing.T) *fileStorage {
+	path := filepath.Join(t.TempDir(), "db.json")
+	clicks, err := file.NewClickRepository(path + ".clicks")
+	require.NoError(t, err)
+	revisions, err := file.NewRevisionRepository(path + ".revisions")
+	require.NoError(t, err)
+	short, err := file.NewShortURLRepository(path, clicks)
+	require.NoError(t, err)
+	counter, err := file.NewCounterRepository(path + ".seq")
+	require.NoError(t, err)
+	campaigns, err := file.NewCampaignRepository(path + ".campaigns")
+	require.NoError(t, err)
+	return &fileStorage{short: short, counter: counter, campaigns: campaigns, clicks: clicks, revisions: revisions}
+}
+
+func TestCopy(t *testing.T) {
+	ctx := context.Background()
+	src := newFileStorage(t)
+	require.NoError(t, src.campaigns.Create(ctx, &storage.Campaign{Name: "spring", UTM: storage.UTM{Source: "news"}}))
+	until := time.Now().Add(time.Hour)
+	for i, u := range []storage.ShortURL{
+		{Hash: shortener.Generate(41, 7), Original: "https://example.com/a", Campaign: "spring", Tags: []string{"promo"}},
+		{Hash: shortener.Generate(7, 7), Original: "https://example.com/b", ValidUntil: &until, UserID: "u1"},
+		{Hash: "old-c", Original: "https://example.com/c"},
+	} {
+		u := u
+		require.NoError(t, src.short.Save(ctx, &u), i)
+	}
+	// A deleted link's hash must not be handed out again.
+	require.NoError(t, src.counter.AtLeast(ctx, 50))
+
+	hashA := shortener.Generate(41, 7)
+	clickTime := time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, src.clicks.Record(ctx, storage.Click{Hash: hashA, Country: "DE", Time: clickTime.Add(time.Duration(i) * time.Second)}))
+	}
+	rev := &storage.Revision{Hash: hashA, OldURL: "https://example.com/old", NewURL: "https://example.com/a"}
+	require.NoError(t, src.revisions.Record(ctx, rev))
+
+	dst := newFileStorage(t)
+	// An interrupted earlier run already copied the first click.
+	require.NoError(t, dst.clicks.Record(ctx, storage.Click{Hash: hashA, Country: "DE", Time: clickTime}))
+
+	report, err := Copy(ctx, src, dst, nil)
+	require.NoError(t, err)
+	assert.Equal(t, Report{Campaigns: 1, Copied: 3, Clicks: 2, Revisions: 1, Counter: 50}, report)
+
+	next, err := dst.counter.Next(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, uint64(51), next)
+
+	stats, err := dst.clicks.Stats(ctx, hashA)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), stats.Clicks)
+	restored, err := dst.revisions.Get(ctx, hashA, rev.ID)
+	require.NoError(t, err)
+	assert.Equal(t, rev.Time, restored.Time)
+
+	srcSum, dstSum, err := Verify(ctx, src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, Summary{Links: 3, Revisions: 1, Checksum: srcSum.Checksum}, srcSum)
+	assert.Equal(t, srcSum, dstSum)
+
+	t.Run("resume", func(t *testing.T) {
+		report, err := Copy(ctx, src, dst, nil)
+		require.NoError(t, err)
+		assert.Equal(t, Report{Campaigns: 1, Skipped: 3, Counter: 50}, report)
+	})
+
+	t.Run("missing clicks fail verification", func(t *testing.T) {
+		require.NoError(t, src.clicks.Record(ctx, storage.Click{Hash: hashA, Time: time.Now()}))
+		srcSum, dstSum, err := Verify(ctx, src, dst)
+		require.NoError(t, err)
+		assert.NotEqual(t, srcSum, dstSum)
+	})
+
+	t.Run("conflicting link", func(t *testing.T) {
+		other := newFileStorage(t)
+		require.NoError(t, other.short.Save(ctx, &storage.ShortURL{Hash: "old-c", Original: "https://example.com/other"}))
+		_, err := Copy(ctx, src, other, nil)
+		assert.ErrorContains(t, err, "old-c")
+	})
+}
+
+// viewsStorage keeps each link's click count in the link itself, the way
+// Postgres keeps short_urls.views: Save writes it and Record bumps it.
+type viewsStorage struct {
+	*fileStorage
+	views map[string]int64
+}
+
+func (s *viewsStorage) ShortURLs() storage.ShortURLRepository {
+	return &viewsShortURLs{ShortURLRepository: s.short, views: s.views}
+}
+
+func (s *viewsStorage) Clicks() storage.ClickRepository {
+	return &viewsClicks{ClickRepository: s.clicks, views: s.views}
+}
+
+type viewsShortURLs struct {
+	storage.ShortURLRepository
+	views map[string]int64
+}
+
+func (r *viewsShortURLs) WithTx(storage.Tx) storage.ShortURLRepository { return r }
+
+func (r *viewsShortURLs) Save(ctx context.Context, u *storage.ShortURL) error {
+	if err := r.ShortURLRepository.Save(ctx, u); err != nil {
+		return err
+	}
+	r.views[u.Hash] = u.Clicks
+	return nil
+}
+
+func (r *viewsShortURLs) Each(ctx context.Context, fn func(*storage.ShortURL) error) error {
+	return r.ShortURLRepository.Each(ctx, func(u *storage.ShortURL) error {
+		u.Clicks = r.views[u.Hash]
+		return fn(u)
+	})
+}
+
+type viewsClicks struct {
+	storage.ClickRepository
+	views map[string]int64
+}
+
+func (r *viewsClicks) Record(ctx context.Context, c storage.Click) error {
+	if err := r.ClickRepository.Record(ctx, c); err != nil {
+		return err
+	}
+	r.views[c.Hash]++
+	return nil
+}
+
+func TestCopyClickCountInLink(t *testing.T) {
+	ctx := context.Background()
+	src := newFileStorage(t)
+	hash := shortener.Generate(1, 7)
+	require.NoError(t, src.short.Save(ctx, &storage.ShortURL{Hash: hash, Original: "https://example.com/a"}))
+	for i := 0; i < 4; i++ {
+		require.NoError(t, src.clicks.Record(ctx, storage.Click{Hash: hash, Time: time.Now()}))
+	}
+
+	dst := &viewsStorage{fileStorage: newFileStorage(t), views: make(map[string]int64)}
+	report, err := Copy(ctx, src, dst, nil)
+	require.NoError(t, err)
+	assert.Equal(t, 4, report.Clicks)
+	assert.Equal(t, int64(4), dst.views[hash])
+
+	srcSum, dstSum, err := Verify(ctx, src, dst)
+	require.NoError(t, err)
+	assert.Equal(t, srcSum, dstSum)
+}
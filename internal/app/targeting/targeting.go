@@ -0,0 +1,197 @@
+package targeting
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/vlxdisluv/shortener/internal/app/storage"
+	"golang.org/x/text/language"
+)
+
+// Known values for the browsers and os conditions of a rule.
+var (
+	Browsers = []string{"chrome", "firefox", "safari", "edge", "opera", "samsung", "bot"}
+	OSes     = []string{"ios", "android", "windows", "macos", "chromeos", "linux"}
+)
+
+// Visitor holds the request properties rules are matched against.
+type Visitor struct {
+	Browser  string
+	OS       string
+	Language language.Tag // most preferred language, language.Und if unknown
+	Country  string       // ISO 3166-1 alpha-2, empty without a geo database
+	Query    map[string][]string
+	Time     time.Time
+}
+
+func NewVisitor(r *http.Request, country string, now time.Time) Visitor {
+	ua := strings.ToLower(r.UserAgent())
+
+	v := Visitor{
+		Browser:  detectBrowser(ua),
+		OS:       detectOS(ua),
+		Language: language.Und,
+		Country:  country,
+		Query:    r.URL.Query(),
+		Time:     now,
+	}
+
+	if tags, _, err := language.ParseAcceptLanguage(r.Header.Get("Accept-Language")); err == nil && len(tags) > 0 {
+		v.Language = tags[0]
+	}
+	return v
+}
+
+// Match returns the destination of the first rule matching the visitor.
+func Match(rules []storage.TargetingRule, v Visitor) (string, bool) {
+	for _, rule := range rules {
+		if matches(rule, v) {
+			return rule.Destination, true
+		}
+	}
+	return "", false
+}
+
+func matches(rule storage.TargetingRule, v Visitor) bool {
+	if len(rule.Browsers) > 0 && !contains(rule.Browsers, v.Browser) {
+		return false
+	}
+	if len(rule.OS) > 0 && !contains(rule.OS, v.OS) {
+		return false
+	}
+	if len(rule.Languages) > 0 && !matchLanguage(rule.Languages, v.Language) {
+		return false
+	}
+	if len(rule.Countries) > 0 && !contains(rule.Countries, v.Country) {
+		return false
+	}
+	if rule.From != nil && v.Time.Before(*rule.From) {
+		return false
+	}
+	if rule.Until != nil && !v.Time.Before(*rule.Until) {
+		return false
+	}
+	for key, want := range rule.Query {
+		if !contains(v.Query[key], want) {
+			return false
+		}
+	}
+	return true
+}
+
+// Validate checks a rule's conditions; the destination is checked by the caller.
+func Validate(rule storage.TargetingRule) error {
+	if rule.Destination == "" {
+		return fmt.Errorf("destination is required")
+	}
+	if len(rule.Browsers) == 0 && len(rule.OS) == 0 && len(rule.Languages) == 0 && len(rule.Countries) == 0 &&
+		rule.From == nil && rule.Until == nil && len(rule.Query) == 0 {
+		return fmt.Errorf("rule for %s has no conditions", rule.Destination)
+	}
+	for _, b := range rule.Browsers {
+		if !contains(Browsers, b) {
+			return fmt.Errorf("unknown browser %q, expected one of %s", b, strings.Join(Browsers, ", "))
+		}
+	}
+	for _, o := range rule.OS {
+		if !contains(OSes, o) {
+			return fmt.Errorf("unknown os %q, expected one of %s", o, strings.Join(OSes, ", "))
+		}
+	}
+	for _, l := range rule.Languages {
+		if _, err := language.Parse(l); err != nil {
+			return fmt.Errorf("invalid language %q: %w", l, err)
+		}
+	}
+	for _, c := range rule.Countries {
+		if len(c) != 2 || strings.ToUpper(c) != c {
+			return fmt.Errorf("invalid country %q, expected an upper-case ISO 3166-1 alpha-2 code", c)
+		}
+	}
+	if rule.From != nil && rule.Until != nil && !rule.From.Before(*rule.Until) {
+		return fmt.Errorf("from must be before until")
+	}
+	return nil
+}
+
+// matchLanguage reports whether tag satisfies one of the rule languages.
+// A bare language ("de") matches every region of it ("de-AT"), while a
+// regional tag ("pt-BR") requires the same region.
+func matchLanguage(languages []string, tag language.Tag) bool {
+	if tag == language.Und {
+		return false
+	}
+	base, _ := tag.Base()
+	region, _ := tag.Region()
+
+	for _, l := range languages {
+		want, err := language.Parse(l)
+		if err != nil {
+			continue
+		}
+		wantBase, _ := want.Base()
+		if wantBase != base {
+			continue
+		}
+		if wantRegion, conf := want.Region(); conf == language.Exact && wantRegion != region {
+			continue
+		}
+		return true
+	}
+	return false
+}
+
+// detectBrowser detects the browser family from a lower-cased User-Agent. The
+// order matters: most browsers also claim to be Chrome and/or Safari.
+func detectBrowser(ua string) string {
+	switch {
+	case ua == "":
+		return ""
+	case strings.Contains(ua, "bot") || strings.Contains(ua, "spider") || strings.Contains(ua, "crawl"):
+		return "bot"
+	case strings.Contains(ua, "edg/") || strings.Contains(ua, "edga/") || strings.Contains(ua, "edgios/"):
+		return "edge"
+	case strings.Contains(ua, "opr/") || strings.Contains(ua, "opera"):
+		return "opera"
+	case strings.Contains(ua, "samsungbrowser/"):
+		return "samsung"
+	case strings.Contains(ua, "firefox/") || strings.Contains(ua, "fxios/"):
+		return "firefox"
+	case strings.Contains(ua, "chrome/") || strings.Contains(ua, "crios/"):
+		return "chrome"
+	case strings.Contains(ua, "safari/"):
+		return "safari"
+	}
+	return ""
+}
+
+// detectOS detects the operating system from a lower-cased User-Agent. iOS is
+// checked before macOS because iOS agents contain "like Mac OS X".
+func detectOS(ua string) string {
+	switch {
+	case strings.Contains(ua, "iphone") || strings.Contains(ua, "ipad") || strings.Contains(ua, "ipod"):
+		return "ios"
+	case strings.Contains(ua, "android"):
+		return "android"
+	case strings.Contains(ua, "windows"):
+		return "windows"
+	case strings.Contains(ua, "mac os x") || strings.Contains(ua, "macintosh"):
+		return "macos"
+	case strings.Contains(ua, "cros "):
+		return "chromeos"
+	case strings.Contains(ua, "linux"):
+		return "linux"
+	}
+	return ""
+}
+
+func contains(values []string, v string) bool {
+	for _, value := range values {
+		if value == v {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,68 @@
+package targeting
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/vlxdisluv/shortener/internal/app/storage"
+)
+
+const (
+	uaIPhone  = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Mobile/15E148 Safari/604.1"
+	uaAndroid = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36"
+	uaEdge    = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36 Edg/120.0.0.0"
+	uaMac     = "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_0) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.0 Safari/605.1.15"
+)
+
+func TestMatch(t *testing.T) {
+	launch := time.Date(2026, 5, 1, 0, 0, 0, 0, time.UTC)
+
+	rules := []storage.TargetingRule{
+		{Destination: "https://apps.apple.com/app", OS: []string{"ios"}},
+		{Destination: "https://play.google.com/app", OS: []string{"android"}},
+		{Destination: "https://example.com/launch", From: &launch, Query: map[string]string{"preview": "1"}},
+		{Destination: "https://example.com/pt-br", Languages: []string{"pt-BR"}},
+		{Destination: "https://example.com/de", Languages: []string{"de"}},
+		{Destination: "https://example.com/edge", Browsers: []string{"edge"}},
+		{Destination: "https://example.com/fr", Countries: []string{"FR", "BE"}},
+	}
+
+	tests := []struct {
+		name     string
+		ua       string
+		lang     string
+		query    string
+		country  string
+		now      time.Time
+		want     string
+		wantHits bool
+	}{
+		{name: "ios", ua: uaIPhone, want: "https://apps.apple.com/app", wantHits: true},
+		{name: "android", ua: uaAndroid, lang: "de", want: "https://play.google.com/app", wantHits: true},
+		{name: "time window and query", ua: uaMac, query: "?preview=1", now: launch, want: "https://example.com/launch", wantHits: true},
+		{name: "before time window", ua: uaMac, query: "?preview=1", now: launch.Add(-time.Hour)},
+		{name: "regional language", ua: uaMac, lang: "pt-BR,pt;q=0.8", want: "https://example.com/pt-br", wantHits: true},
+		{name: "other region of language", ua: uaMac, lang: "pt-PT"},
+		{name: "bare language matches any region", ua: uaMac, lang: "de-AT, en;q=0.5", want: "https://example.com/de", wantHits: true},
+		{name: "only preferred language counts", ua: uaMac, lang: "en, de;q=0.5"},
+		{name: "edge is not chrome", ua: uaEdge, want: "https://example.com/edge", wantHits: true},
+		{name: "country", ua: uaMac, country: "BE", want: "https://example.com/fr", wantHits: true},
+		{name: "no match", ua: uaMac, country: "US"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("GET", "/EwHXdJfB"+tt.query, nil)
+			r.Header.Set("User-Agent", tt.ua)
+			if tt.lang != "" {
+				r.Header.Set("Accept-Language", tt.lang)
+			}
+
+			got, ok := Match(rules, NewVisitor(r, tt.country, tt.now))
+			assert.Equal(t, tt.wantHits, ok)
+			assert.Equal(t, tt.want, got)
+		})
+	}
+}
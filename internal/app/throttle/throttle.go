@@ -0,0 +1,74 @@
+package throttle
+
+import (
+	"sync"
+	"time"
+)
+
+// maxKeys bounds memory use; expired windows are swept once it is reached.
+const maxKeys = 10000
+
+type window struct {
+	attempts int
+	reset    time.Time
+}
+
+// Throttle counts attempts per key in a fixed time window and blocks the
+// key once the limit is reached.
+type Throttle struct {
+	limit  int
+	period time.Duration
+
+	mu   sync.Mutex
+	keys map[string]*window
+	now  func() time.Time
+}
+
+func New(limit int, period time.Duration) *Throttle {
+	return &Throttle{
+		limit:  limit,
+		period: period,
+		keys:   make(map[string]*window),
+		now:    time.Now,
+	}
+}
+
+// Attempt counts an attempt for key and reports whether it may go ahead
+// and, if not, how long the caller has to wait. The attempt is counted
+// before it is made, so parallel attempts cannot all slip through while the
+// first ones are still being checked; call Reset when one succeeds.
+func (t *Throttle) Attempt(key string) (bool, time.Duration) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	w, ok := t.keys[key]
+	if !ok || !now.Before(w.reset) {
+		if len(t.keys) >= maxKeys {
+			t.sweep(now)
+		}
+		w = &window{reset: now.Add(t.period)}
+		t.keys[key] = w
+	}
+	if w.attempts >= t.limit {
+		return false, w.reset.Sub(now)
+	}
+	w.attempts++
+	return true, 0
+}
+
+// Reset forgets the attempts of key, e.g. after a successful one.
+func (t *Throttle) Reset(key string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.keys, key)
+}
+
+func (t *Throttle) sweep(now time.Time) {
+	for key, w := range t.keys {
+		if !now.Before(w.reset) {
+			delete(t.keys, key)
+		}
+	}
+}
@@ -0,0 +1,56 @@
+package throttle
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestThrottle(t *testing.T) {
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	th := New(3, time.Minute)
+	th.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		ok, _ := th.Attempt("abc")
+		assert.True(t, ok)
+	}
+
+	ok, wait := th.Attempt("abc")
+	assert.False(t, ok)
+	assert.Equal(t, time.Minute, wait)
+
+	ok, _ = th.Attempt("other")
+	assert.True(t, ok, "keys are throttled independently")
+
+	now = now.Add(time.Minute)
+	ok, _ = th.Attempt("abc")
+	assert.True(t, ok, "window expired")
+
+	th.Attempt("abc")
+	th.Attempt("abc")
+	th.Reset("abc")
+	ok, _ = th.Attempt("abc")
+	assert.True(t, ok)
+}
+
+func TestThrottleConcurrent(t *testing.T) {
+	th := New(5, time.Minute)
+
+	var allowed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if ok, _ := th.Attempt("abc"); ok {
+				allowed.Add(1)
+			}
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, int32(5), allowed.Load())
+}